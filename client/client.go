@@ -0,0 +1,309 @@
+// Package client is a high-level client for the chat service. It keeps a subscription per
+// joined room, reconnects with exponential backoff when the server goes away and resumes each
+// room after the last message it delivered.
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"grpc-chat/proto"
+)
+
+// systemSender is the sender of the messages generated by the server, such as join notices.
+const systemSender = "GATEWAY"
+
+type EventKind int
+
+const (
+	// EventMessage carries a message sent to the room.
+	EventMessage EventKind = iota
+	// EventSystem carries a notice from the server. Only delivered with Options.SystemMessages.
+	EventSystem
+	// EventReconnecting reports that the subscription was lost. Err is the reason.
+	EventReconnecting
+	// EventReconnected reports that the subscription was restored.
+	EventReconnected
+	// EventClosed is the last event of a room. Err is nil if the room was left.
+	EventClosed
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventMessage:
+		return "message"
+	case EventSystem:
+		return "system"
+	case EventReconnecting:
+		return "reconnecting"
+	case EventReconnected:
+		return "reconnected"
+	case EventClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+type Event struct {
+	Kind    EventKind
+	Room    string
+	Message *proto.ChatMessage
+	Err     error
+}
+
+type Options struct {
+	// InitialBackoff and MaxBackoff bound the wait between reconnection attempts. They default
+	// to 100ms and 30s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// SystemMessages delivers the server's notices as EventSystem. Heartbeats are always dropped.
+	SystemMessages bool
+	// Buffer is the capacity of the event channels. It defaults to 64.
+	Buffer int
+	// Token is the user token of the client ID, for servers that require one.
+	Token string
+}
+
+type Client struct {
+	id   string
+	chat proto.ChatServiceClient
+	opts Options
+
+	mu    sync.Mutex
+	rooms map[string]*subscription
+}
+
+type subscription struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	// lastSeq is the last sequence received from each node numbering the room's messages.
+	// Nodes number them independently, so sequences only compare within a node.
+	lastSeq map[string]uint64
+}
+
+// New creates a client sending and subscribing as clientID over conn.
+func New(conn grpc.ClientConnInterface, clientID string, opts Options) *Client {
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+	return &Client{
+		id:    clientID,
+		chat:  proto.NewChatServiceClient(conn),
+		opts:  opts,
+		rooms: map[string]*subscription{},
+	}
+}
+
+// ID returns the client ID messages are sent as.
+func (c *Client) ID() string {
+	return c.id
+}
+
+// Join subscribes to room for as long as ctx lasts. The returned channel receives the room's
+// events until the room is left, the client is closed or the server refuses the subscription,
+// and is then closed after an EventClosed.
+func (c *Client) Join(ctx context.Context, room string) (<-chan Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, joined := c.rooms[room]; joined {
+		return nil, errors.New("already joined " + room)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &subscription{cancel: cancel, done: make(chan struct{}), lastSeq: map[string]uint64{}}
+	c.rooms[room] = sub
+	events := make(chan Event, c.opts.Buffer)
+	go c.run(ctx, room, sub, events)
+	return events, nil
+}
+
+// Leave ends the subscription to room and waits for its event channel to be closed.
+func (c *Client) Leave(room string) {
+	c.mu.Lock()
+	sub := c.rooms[room]
+	c.mu.Unlock()
+	if sub == nil {
+		return
+	}
+	sub.cancel()
+	<-sub.done
+}
+
+// Send sends content to room as a text message.
+func (c *Client) Send(ctx context.Context, room string, content string) error {
+	return c.SendMessage(ctx, &proto.ChatMessage{
+		Recipient: room,
+		Content:   []byte(content),
+	})
+}
+
+// SendMessage sends msg, filling in the sender and timestamp.
+func (c *Client) SendMessage(ctx context.Context, msg *proto.ChatMessage) error {
+	msg.Sender = c.id
+	if msg.Timestamp == 0 {
+		msg.Timestamp = uint64(time.Now().Unix())
+	}
+	_, err := c.chat.SendMessage(c.outgoing(ctx), msg)
+	return err
+}
+
+// Close leaves every room and tells the server to drop any subscription left behind.
+func (c *Client) Close(ctx context.Context) error {
+	c.mu.Lock()
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	c.mu.Unlock()
+	for _, room := range rooms {
+		c.Leave(room)
+	}
+	_, err := c.chat.UnsubscribeAll(c.outgoing(ctx), &proto.ConnectionRequest{ServerID: c.id})
+	return err
+}
+
+// outgoing adds the client's user token to the metadata of a call.
+func (c *Client) outgoing(ctx context.Context) context.Context {
+	if c.opts.Token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "user-token", c.opts.Token)
+}
+
+// run keeps the room subscribed until ctx is done or the server refuses the subscription.
+func (c *Client) run(ctx context.Context, room string, sub *subscription, events chan<- Event) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.rooms, room)
+		c.mu.Unlock()
+		close(sub.done)
+		close(events)
+	}()
+	backoff := c.opts.InitialBackoff
+	reconnecting := false
+	for {
+		received, err := c.subscribe(ctx, room, sub, events, reconnecting)
+		if ctx.Err() != nil {
+			closed(events, Event{Kind: EventClosed, Room: room})
+			return
+		}
+		if !retryable(err) {
+			closed(events, Event{Kind: EventClosed, Room: room, Err: err})
+			return
+		}
+		if received {
+			backoff = c.opts.InitialBackoff
+		}
+		if !reconnecting || received {
+			emit(ctx, events, Event{Kind: EventReconnecting, Room: room, Err: err})
+		}
+		reconnecting = true
+		select {
+		case <-time.After(jitter(backoff)):
+		case <-ctx.Done():
+			closed(events, Event{Kind: EventClosed, Room: room})
+			return
+		}
+		if backoff *= 2; backoff > c.opts.MaxBackoff {
+			backoff = c.opts.MaxBackoff
+		}
+	}
+}
+
+// subscribe receives the room's messages until the stream ends, and reports whether anything
+// was received. The server resumes the subscription after the last message it delivered to
+// this client ID; messages that were delivered again anyway by the same node are dropped by
+// sequence.
+func (c *Client) subscribe(ctx context.Context, room string, sub *subscription, events chan<- Event, reconnecting bool) (bool, error) {
+	stream, err := c.chat.Subscribe(c.outgoing(ctx), &proto.RoomRequest{
+		RoomName:                 room,
+		InitialConnectionRequest: &proto.ConnectionRequest{ServerID: c.id},
+	})
+	if err != nil {
+		return false, err
+	}
+	received, sequenced := false, false
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return received, err
+		}
+		if !received && reconnecting {
+			emit(ctx, events, Event{Kind: EventReconnected, Room: room})
+		}
+		received = true
+		if msg.GetContentType() == proto.HeartbeatContentType {
+			continue
+		}
+		if seq := msg.GetSequence(); seq != 0 {
+			sequencer := msg.GetSequencer()
+			// A room that starts over at 1 was recreated on the server, e.g. after a restart
+			// without a snapshot, and none of its messages were seen before.
+			if !sequenced && seq == 1 {
+				delete(sub.lastSeq, sequencer)
+			}
+			sequenced = true
+			if seq <= sub.lastSeq[sequencer] {
+				continue
+			}
+			sub.lastSeq[sequencer] = seq
+		}
+		kind := EventMessage
+		if msg.GetSender() == systemSender {
+			if !c.opts.SystemMessages {
+				continue
+			}
+			kind = EventSystem
+		}
+		if !emit(ctx, events, Event{Kind: kind, Room: room, Message: msg}) {
+			return received, ctx.Err()
+		}
+	}
+}
+
+// emit delivers e unless ctx is done first, and reports whether it was delivered.
+func emit(ctx context.Context, events chan<- Event, e Event) bool {
+	select {
+	case events <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// closed delivers the last event of a room if the channel has room for it. The subscriber may
+// have stopped reading already, for instance after calling Leave.
+func closed(events chan<- Event, e Event) {
+	select {
+	case events <- e:
+	default:
+	}
+}
+
+// retryable reports whether a subscription that ended with err may succeed when retried.
+// Refusals such as bans, kicks and closed rooms are final.
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Unknown, codes.Internal, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// jitter spreads reconnection attempts over [d/2, d) so that clients disconnected together
+// don't come back together.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
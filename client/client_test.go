@@ -0,0 +1,213 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"grpc-chat/proto"
+)
+
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// testServer serves a chat server over bufconn, and can be stopped and started again to
+// drop every connection.
+type testServer struct {
+	mu     sync.Mutex
+	lis    *bufconn.Listener
+	server *grpc.Server
+}
+
+// newChatServer starts a server keeping its snapshot at snapshot, once it has finished restoring.
+func newChatServer(t *testing.T, snapshot string) *proto.Server {
+	t.Helper()
+	cfg := proto.DefaultConfig()
+	cfg.NodeID = "node"
+	cfg.AdminToken = "admin"
+	cfg.SnapshotFile = snapshot
+	cfg.SnapshotInterval = 0
+	s := proto.NewChatServer(cfg)
+	<-s.Ready()
+	return s
+}
+
+func (ts *testServer) serve(s *proto.Server) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.lis = bufconn.Listen(1 << 20)
+	ts.server = grpc.NewServer()
+	proto.RegisterChatServiceServer(ts.server, s)
+	go ts.server.Serve(ts.lis)
+}
+
+func (ts *testServer) stop() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.server != nil {
+		ts.server.Stop()
+		ts.server, ts.lis = nil, nil
+	}
+}
+
+// dial connects to whichever server ts is serving, retrying quickly while it is stopped.
+func (ts *testServer) dial(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(),
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoff.Config{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, Multiplier: 2}}),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			ts.mu.Lock()
+			lis := ts.lis
+			ts.mu.Unlock()
+			if lis == nil {
+				return nil, errors.New("server stopped")
+			}
+			return lis.Dial()
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		ts.stop()
+	})
+	return conn
+}
+
+var testOptions = Options{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+
+// post sends content to room from bob directly on the server, once the room exists.
+func post(t *testing.T, s *proto.Server, room, content string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := s.SendMessage(context.Background(), &proto.ChatMessage{Sender: "bob", Recipient: room, Content: []byte(content)})
+		if err == nil {
+			return
+		}
+		if status.Code(err) != codes.NotFound || time.Now().After(deadline) {
+			t.Fatalf("sending %q: %v", content, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// next returns the next event of the given kind, skipping the others.
+func next(t *testing.T, events <-chan Event, kind EventKind) Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				t.Fatalf("the events ended while waiting for %s", kind)
+			}
+			if e.Kind == kind {
+				return e
+			}
+			if e.Kind == EventClosed {
+				t.Fatalf("the room was closed while waiting for %s: %v", kind, e.Err)
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", kind)
+		}
+	}
+}
+
+func expectMessage(t *testing.T, events <-chan Event, content string) {
+	t.Helper()
+	if got := next(t, events, EventMessage).Message.GetContent(); string(got) != content {
+		t.Fatalf("received %q, want %q", got, content)
+	}
+}
+
+func TestReconnectResumesAfterTheLastMessage(t *testing.T) {
+	s := newChatServer(t, filepath.Join(t.TempDir(), "snapshot.pb"))
+	ts := &testServer{}
+	ts.serve(s)
+	alice := New(ts.dial(t), "alice", testOptions)
+	events, err := alice.Join(context.Background(), "room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	post(t, s, "room", "one")
+	expectMessage(t, events, "one")
+
+	ts.stop()
+	next(t, events, EventReconnecting)
+	post(t, s, "room", "two")
+	ts.serve(s)
+	next(t, events, EventReconnected)
+	expectMessage(t, events, "two")
+	post(t, s, "room", "three")
+	expectMessage(t, events, "three")
+	alice.Leave("room")
+}
+
+func TestReconnectResumesAcrossARestart(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "snapshot.pb")
+	before := newChatServer(t, snapshot)
+	ts := &testServer{}
+	ts.serve(before)
+	alice := New(ts.dial(t), "alice", testOptions)
+	events, err := alice.Join(context.Background(), "room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	post(t, before, "room", "one")
+	expectMessage(t, events, "one")
+
+	ts.stop()
+	next(t, events, EventReconnecting)
+	if err := before.SaveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	after := newChatServer(t, snapshot)
+	post(t, after, "room", "two")
+	ts.serve(after)
+	next(t, events, EventReconnected)
+	expectMessage(t, events, "two")
+	alice.Leave("room")
+}
+
+func TestJoinEndsWhenRefused(t *testing.T) {
+	s := newChatServer(t, filepath.Join(t.TempDir(), "snapshot.pb"))
+	ts := &testServer{}
+	ts.serve(s)
+	bob := New(ts.dial(t), "bob", testOptions)
+	if _, err := bob.Join(context.Background(), "room"); err != nil {
+		t.Fatal(err)
+	}
+	post(t, s, "room", "welcome")
+	admin := metadata.NewIncomingContext(context.Background(), metadata.Pairs("admin-token", "admin"))
+	if _, err := s.BanUser(admin, &proto.ModerationRequest{RoomName: "room", Target: "mallory"}); err != nil {
+		t.Fatal(err)
+	}
+
+	mallory := New(ts.dial(t), "mallory", testOptions)
+	events, err := mallory.Join(context.Background(), "room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := next(t, events, EventClosed); status.Code(e.Err) != codes.PermissionDenied {
+		t.Fatalf("closed with %v, want PermissionDenied", e.Err)
+	}
+	if _, open := <-events; open {
+		t.Error("the events did not end after EventClosed")
+	}
+}
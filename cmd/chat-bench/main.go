@@ -0,0 +1,314 @@
+// Command chat-bench measures how a chat server copes with load. It connects simulated
+// subscribers spread over a number of rooms, sends messages at a fixed rate and reports the
+// end-to-end latency percentiles, the messages that never arrived and how the goroutine count
+// and heap grew.
+//
+// Without -addr the server runs in-process over bufconn, with rate limits disabled, so that
+// the numbers include the server's goroutines and memory:
+//
+//	chat-bench -rooms 10 -subscribers 1000 -rate 500 -duration 30s
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"grpc-chat/client"
+	"grpc-chat/proto"
+)
+
+// sentAtKey is the metadata key carrying the send time of a message, in Unix nanoseconds.
+const sentAtKey = "bench-sent-at"
+
+type options struct {
+	addr        string
+	rooms       int
+	subscribers int
+	rate        float64
+	duration    time.Duration
+	size        int
+	concurrency int
+	warmup      time.Duration
+	drain       time.Duration
+	queueSize   int
+	tokenSecret string
+}
+
+// subscriber records the latency of every message it receives.
+type subscriber struct {
+	room      string
+	latencies []time.Duration
+	received  int
+}
+
+type stats struct {
+	goroutines int
+	heap       uint64
+}
+
+func readStats() stats {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return stats{goroutines: runtime.NumGoroutine(), heap: m.HeapAlloc}
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.addr, "addr", "", "address of the server to test; empty runs one in-process")
+	flag.IntVar(&opts.rooms, "rooms", 10, "number of rooms")
+	flag.IntVar(&opts.subscribers, "subscribers", 100, "number of subscribers, spread evenly over the rooms")
+	flag.Float64Var(&opts.rate, "rate", 100, "messages sent per second, over all rooms")
+	flag.DurationVar(&opts.duration, "duration", 10*time.Second, "how long to send for")
+	flag.IntVar(&opts.size, "size", 64, "message size in bytes")
+	flag.IntVar(&opts.concurrency, "concurrency", 16, "concurrent SendMessage calls")
+	flag.DurationVar(&opts.warmup, "warmup", time.Second, "time given to subscribers to join before sending")
+	flag.DurationVar(&opts.drain, "drain", 2*time.Second, "time to wait for deliveries after the last send")
+	flag.IntVar(&opts.queueSize, "queue-size", 0, "per-subscriber send queue of the in-process server; 0 keeps the default")
+	flag.StringVar(&opts.tokenSecret, "token-secret", "", "user_token_secret of the server, to sign the simulated users' tokens")
+	flag.Parse()
+	// The messages are sent on a ticker, whose interval has to be at least a nanosecond. The
+	// rate is compared that way round so that NaN is rejected too.
+	validRate := opts.rate > 0 && opts.rate <= 1e9
+	if opts.rooms <= 0 || opts.subscribers < opts.rooms || !validRate || opts.concurrency <= 0 {
+		fmt.Fprintln(os.Stderr, "chat-bench: need rooms > 0, subscribers >= rooms, 0 < rate <= 1e9 and concurrency > 0")
+		os.Exit(2)
+	}
+	if err := run(opts); err != nil {
+		fmt.Fprintln(os.Stderr, "chat-bench:", err)
+		os.Exit(1)
+	}
+}
+
+func run(opts options) error {
+	before := readStats()
+	conn, stop, err := connect(opts)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rooms := make([]string, opts.rooms)
+	for i := range rooms {
+		rooms[i] = "bench-" + strconv.Itoa(i)
+	}
+	subscribers := make([]*subscriber, opts.subscribers)
+	var wg sync.WaitGroup
+	var closedEarly int64
+	for i := range subscribers {
+		sub := &subscriber{room: rooms[i%len(rooms)]}
+		subscribers[i] = sub
+		id := fmt.Sprintf("bench-sub-%d", i)
+		c := client.New(conn, id, client.Options{Buffer: 1024, Token: opts.token(id)})
+		events, err := c.Join(ctx, sub.room)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for event := range events {
+				switch event.Kind {
+				case client.EventMessage:
+					sent, err := strconv.ParseInt(event.Message.GetMetadata()[sentAtKey], 10, 64)
+					if err != nil {
+						continue
+					}
+					sub.received++
+					sub.latencies = append(sub.latencies, time.Since(time.Unix(0, sent)))
+				case client.EventClosed:
+					if event.Err != nil {
+						atomic.AddInt64(&closedEarly, 1)
+					}
+				}
+			}
+		}()
+	}
+	time.Sleep(opts.warmup)
+	connected := readStats()
+
+	fmt.Printf("sending %.0f msg/s to %d rooms with %d subscribers for %s\n", opts.rate, opts.rooms, opts.subscribers, opts.duration)
+	sent, failures, skipped := send(conn, rooms, opts)
+	time.Sleep(opts.drain)
+	loaded := readStats()
+	cancel()
+	wg.Wait()
+
+	expected := 0
+	perRoom := opts.subscribers / opts.rooms
+	for i, room := range rooms {
+		members := perRoom
+		if i < opts.subscribers%opts.rooms {
+			members++
+		}
+		expected += sent[room] * members
+	}
+	var latencies []time.Duration
+	received := 0
+	for _, sub := range subscribers {
+		received += sub.received
+		latencies = append(latencies, sub.latencies...)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	total := 0
+	for _, n := range sent {
+		total += n
+	}
+	fmt.Printf("sent       %d (%.1f msg/s), %d skipped because all senders were busy\n", total, float64(total)/opts.duration.Seconds(), skipped)
+	for code, n := range failures {
+		fmt.Printf("send error %s: %d\n", code, n)
+	}
+	fmt.Printf("delivered  %d of %d (%.1f/s), %d dropped\n", received, expected, float64(received)/opts.duration.Seconds(), expected-received)
+	if n := atomic.LoadInt64(&closedEarly); n > 0 {
+		fmt.Printf("subscribers refused by the server: %d\n", n)
+	}
+	if len(latencies) > 0 {
+		fmt.Printf("latency    p50 %s  p90 %s  p99 %s  p99.9 %s  max %s\n",
+			percentile(latencies, 0.5), percentile(latencies, 0.9), percentile(latencies, 0.99),
+			percentile(latencies, 0.999), latencies[len(latencies)-1])
+	}
+	scope := "this process and the in-process server"
+	if opts.addr != "" {
+		scope = "this process only"
+	}
+	fmt.Printf("goroutines %d at start, %d with subscribers joined, %d after sending (%s)\n", before.goroutines, connected.goroutines, loaded.goroutines, scope)
+	fmt.Printf("heap       %s at start, %s with subscribers joined, %s after sending\n", bytes(before.heap), bytes(connected.heap), bytes(loaded.heap))
+	return nil
+}
+
+// connect dials opts.addr, or starts a server over bufconn when it is empty.
+func connect(opts options) (*grpc.ClientConn, func(), error) {
+	if opts.addr != "" {
+		conn, err := grpc.Dial(opts.addr, grpc.WithInsecure())
+		if err != nil {
+			return nil, nil, err
+		}
+		return conn, func() { conn.Close() }, nil
+	}
+	dir, err := os.MkdirTemp("", "chat-bench")
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg := proto.DefaultConfig()
+	cfg.SnapshotFile = dir + "/snapshot.pb"
+	cfg.SnapshotInterval = 0
+	cfg.RateLimit = proto.RateLimitConfig{
+		Sender:  proto.RateLimit{Burst: 1},
+		Room:    proto.RateLimit{Burst: 1},
+		Gateway: proto.RateLimit{Burst: 1},
+	}
+	if opts.queueSize > 0 {
+		cfg.Liveness.QueueSize = opts.queueSize
+	}
+	srv := proto.NewChatServer(cfg)
+	srv.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	<-srv.Ready()
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	proto.RegisterChatServiceServer(server, srv)
+	go server.Serve(lis)
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }))
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, func() {
+		conn.Close()
+		server.Stop()
+		os.RemoveAll(dir)
+	}, nil
+}
+
+// send spreads opts.rate messages a second over the rooms for opts.duration. It returns the
+// messages accepted per room, the failed sends by status code and the ticks skipped because
+// every sender was still waiting on a previous call.
+func send(conn *grpc.ClientConn, rooms []string, opts options) (map[string]int, map[string]int, int) {
+	chat := proto.NewChatServiceClient(conn)
+	payload := make([]byte, opts.size)
+	for i := range payload {
+		payload[i] = 'a' + byte(i%26)
+	}
+	var mu sync.Mutex
+	sent := map[string]int{}
+	failures := map[string]int{}
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.concurrency; i++ {
+		wg.Add(1)
+		go func(sender string) {
+			defer wg.Done()
+			ctx := context.Background()
+			if token := opts.token(sender); token != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "user-token", token)
+			}
+			for room := range work {
+				_, err := chat.SendMessage(ctx, &proto.ChatMessage{
+					Sender:    sender,
+					Recipient: room,
+					Content:   payload,
+					Timestamp: uint64(time.Now().Unix()),
+					Metadata:  map[string]string{sentAtKey: strconv.FormatInt(time.Now().UnixNano(), 10)},
+				})
+				mu.Lock()
+				if err != nil {
+					failures[status.Code(err).String()]++
+				} else {
+					sent[room]++
+				}
+				mu.Unlock()
+			}
+		}(fmt.Sprintf("bench-sender-%d", i))
+	}
+	skipped := 0
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.rate))
+	defer ticker.Stop()
+	deadline := time.After(opts.duration)
+	for i := 0; ; i++ {
+		select {
+		case <-deadline:
+			close(work)
+			wg.Wait()
+			return sent, failures, skipped
+		case <-ticker.C:
+			select {
+			case work <- rooms[i%len(rooms)]:
+			default:
+				skipped++
+			}
+		}
+	}
+}
+
+// token signs the user token of id when the server requires them.
+func (o options) token(id string) string {
+	if o.tokenSecret == "" {
+		return ""
+	}
+	return proto.IssueUserToken(o.tokenSecret, id)
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+func bytes(n uint64) string {
+	return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+}
@@ -0,0 +1,48 @@
+// Command chat-cli is an interactive terminal client for the chat server.
+//
+//	chat-cli -addr localhost:9000 -user alice
+//
+// Type /help once connected for the list of commands.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc"
+	"grpc-chat/client"
+	"grpc-chat/proto"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9000", "address of the chat server")
+	user := flag.String("user", os.Getenv("USER"), "name to chat as")
+	room := flag.String("room", "", "room to join at startup")
+	token := flag.String("token", os.Getenv("CHAT_USER_TOKEN"), "user token, for servers that require one")
+	flag.Parse()
+	if *user == "" {
+		fmt.Fprintln(os.Stderr, "chat-cli: -user is required")
+		os.Exit(2)
+	}
+
+	dialOpts := []grpc.DialOption{grpc.WithInsecure()}
+	if *token != "" {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(proto.UserTokenCredentials(*token)))
+	}
+	conn, err := grpc.Dial(*addr, dialOpts...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "chat-cli:", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	ui := newUI(*user, proto.NewChatServiceClient(conn), client.New(conn, *user, client.Options{SystemMessages: true}))
+	if *room != "" {
+		ui.join(*room)
+	}
+	if err := ui.run(); err != nil {
+		fmt.Fprintln(os.Stderr, "chat-cli:", err)
+		os.Exit(1)
+	}
+}
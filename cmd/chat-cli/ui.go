@@ -0,0 +1,452 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"grpc-chat/client"
+	"grpc-chat/proto"
+)
+
+const (
+	// dmPrefix starts the name of the rooms used for direct messages, which are named after
+	// both users so that either of them ends up in the same room. The server keeps everyone
+	// else out of them.
+	dmPrefix        = proto.DirectMessagePrefix
+	refreshInterval = 5 * time.Second
+	requestTimeout  = 5 * time.Second
+	// lobby holds the output of commands and errors, and is shown until a room is joined.
+	lobby = ""
+)
+
+var senderColors = []string{"red", "green", "yellow", "blue", "fuchsia", "aqua", "orange", "lime", "violet", "turquoise"}
+
+func senderColor(sender string) string {
+	h := fnv.New32a()
+	h.Write([]byte(sender))
+	return senderColors[h.Sum32()%uint32(len(senderColors))]
+}
+
+// dmRoom names the direct message room of two users.
+func dmRoom(a, b string) string {
+	users := []string{a, b}
+	sort.Strings(users)
+	return dmPrefix + users[0] + ":" + users[1]
+}
+
+// dmPeer returns the other user of a direct message room, if room is one that user is part of.
+func dmPeer(room, user string) (string, bool) {
+	users := strings.Split(strings.TrimPrefix(room, dmPrefix), ":")
+	if !strings.HasPrefix(room, dmPrefix) || len(users) != 2 {
+		return "", false
+	}
+	switch user {
+	case users[0]:
+		return users[1], true
+	case users[1]:
+		return users[0], true
+	}
+	return "", false
+}
+
+// ui owns the terminal. Its fields are only touched from tview's event loop; network calls run
+// in their own goroutines and hand their results back with QueueUpdateDraw.
+type ui struct {
+	user   string
+	chat   proto.ChatServiceClient
+	client *client.Client
+
+	app      *tview.Application
+	rooms    *tview.List
+	messages *tview.TextView
+	input    *tview.InputField
+
+	current string
+	// joined holds the rooms with a subscription, until its events end. leaving holds the
+	// joined rooms being left, and whether they were joined again in the meantime.
+	joined  map[string]bool
+	leaving map[string]bool
+	// left holds the direct message rooms the user left, which are not joined again on their own.
+	left        map[string]bool
+	serverRooms []string
+	buffers     map[string]*strings.Builder
+	unread      map[string]int
+}
+
+func newUI(user string, chat proto.ChatServiceClient, c *client.Client) *ui {
+	u := &ui{
+		user:     user,
+		chat:     chat,
+		client:   c,
+		app:      tview.NewApplication(),
+		rooms:    tview.NewList().ShowSecondaryText(false),
+		messages: tview.NewTextView().SetDynamicColors(true).SetScrollable(true).SetWrap(true),
+		input:    tview.NewInputField().SetLabel("> "),
+		joined:   map[string]bool{},
+		leaving:  map[string]bool{},
+		left:     map[string]bool{},
+		buffers:  map[string]*strings.Builder{},
+		unread:   map[string]int{},
+	}
+	u.rooms.SetBorder(true).SetTitle(" Rooms ")
+	u.messages.SetBorder(true)
+	u.rooms.SetSelectedFunc(func(_ int, _ string, room string, _ rune) {
+		if u.in(room) {
+			u.show(room)
+		} else {
+			u.join(room)
+		}
+		u.app.SetFocus(u.input)
+	})
+	u.input.SetDoneFunc(func(key tcell.Key) {
+		if key != tcell.KeyEnter {
+			return
+		}
+		line := strings.TrimSpace(u.input.GetText())
+		u.input.SetText("")
+		if line != "" {
+			u.handle(line)
+		}
+	})
+	u.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyTab {
+			if u.input.HasFocus() {
+				u.app.SetFocus(u.rooms)
+			} else {
+				u.app.SetFocus(u.input)
+			}
+			return nil
+		}
+		return event
+	})
+	layout := tview.NewFlex().
+		AddItem(u.rooms, 24, 0, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(u.messages, 0, 1, false).
+			AddItem(u.input, 1, 0, true), 0, 1, true)
+	u.app.SetRoot(layout, true).SetFocus(u.input)
+	u.show(lobby)
+	u.notice("connected as %s. Type /help for commands, Tab to switch to the room list.", user)
+	return u
+}
+
+func (u *ui) run() error {
+	go u.refreshRooms()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		_ = u.client.Close(ctx)
+	}()
+	return u.app.Run()
+}
+
+func (u *ui) handle(line string) {
+	if !strings.HasPrefix(line, "/") {
+		if u.current == lobby {
+			u.notice("join a room first with /join <room>")
+			return
+		}
+		u.send(u.current, line)
+		return
+	}
+	fields := strings.Fields(line)
+	args := fields[1:]
+	switch fields[0] {
+	case "/join":
+		if len(args) != 1 {
+			u.notice("usage: /join <room>")
+			return
+		}
+		u.join(args[0])
+	case "/leave":
+		room := u.current
+		if len(args) == 1 {
+			room = args[0]
+		}
+		u.leave(room)
+	case "/rooms":
+		u.listRooms()
+	case "/msg":
+		if len(args) < 2 {
+			u.notice("usage: /msg <user> <message>")
+			return
+		}
+		room := dmRoom(u.user, args[0])
+		if !u.in(room) {
+			u.join(room)
+		}
+		u.send(room, strings.Join(args[1:], " "))
+	case "/who":
+		u.who(u.current)
+	case "/quit":
+		u.app.Stop()
+	case "/help":
+		u.notice("/join <room>       join a room, or switch to it")
+		u.notice("/leave [room]      leave the current or given room")
+		u.notice("/rooms             list the rooms on the server")
+		u.notice("/msg <user> <text> send a direct message")
+		u.notice("/who               list the members of the current room")
+		u.notice("/quit              exit")
+		u.notice("other commands, such as /me and /roll, are run by the server in the current room")
+		u.notice("start a message with // to send it as text")
+	default:
+		// The server runs its own slash commands, and escapes // to a message starting with /.
+		if u.current == lobby {
+			u.notice("unknown command %s, type /help for the list", fields[0])
+			return
+		}
+		u.send(u.current, line)
+	}
+}
+
+// in reports whether room is joined and not being left.
+func (u *ui) in(room string) bool {
+	_, leaving := u.leaving[room]
+	return u.joined[room] && !leaving
+}
+
+// join subscribes to room, or switches to it if it is joined already. A room that is still
+// being left is joined again once the client is done leaving it.
+func (u *ui) join(room string) {
+	delete(u.left, room)
+	if _, leaving := u.leaving[room]; leaving {
+		u.leaving[room] = true
+		return
+	}
+	if u.joined[room] {
+		u.show(room)
+		return
+	}
+	events, err := u.client.Join(context.Background(), room)
+	if err != nil {
+		u.notice("joining %s: %v", room, err)
+		return
+	}
+	u.joined[room] = true
+	u.show(room)
+	u.updateRoomList()
+	go func() {
+		for event := range events {
+			event := event
+			u.app.QueueUpdateDraw(func() { u.handleEvent(event) })
+		}
+		u.app.QueueUpdateDraw(func() { u.ended(room) })
+	}()
+}
+
+// ended forgets room once its subscription's events have all been handled, and joins it again
+// if that was asked for while leaving it.
+func (u *ui) ended(room string) {
+	rejoin := u.leaving[room]
+	delete(u.joined, room)
+	delete(u.leaving, room)
+	if rejoin {
+		u.join(room)
+	}
+	u.updateRoomList()
+}
+
+func (u *ui) leave(room string) {
+	if room == lobby || !u.in(room) && !u.leaving[room] {
+		u.notice("not in a room")
+		return
+	}
+	// Leaving again cancels a join asked for while the room was being left.
+	u.leaving[room] = false
+	if _, ok := dmPeer(room, u.user); ok {
+		u.left[room] = true
+	}
+	go u.client.Leave(room)
+	if u.current == room {
+		u.show(lobby)
+	}
+	u.updateRoomList()
+}
+
+// send sends text to room. A room that was just joined may not exist on the server until the
+// subscription reaches it, so NotFound is retried for a short while.
+func (u *ui) send(room, text string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		err := u.client.Send(ctx, room, text)
+		for attempt := 0; status.Code(err) == codes.NotFound && attempt < 5; attempt++ {
+			time.Sleep(200 * time.Millisecond)
+			err = u.client.Send(ctx, room, text)
+		}
+		if err != nil {
+			u.app.QueueUpdateDraw(func() { u.appendLine(room, fmt.Sprintf("[red]not sent: %s[-]", tview.Escape(err.Error()))) })
+		}
+	}()
+}
+
+func (u *ui) handleEvent(event client.Event) {
+	switch event.Kind {
+	case client.EventMessage:
+		msg := event.Message
+		at := time.Unix(int64(msg.GetTimestamp()), 0).Format("15:04")
+		u.appendLine(event.Room, fmt.Sprintf("[gray]%s[-] [%s::b]%s[-::-] %s",
+			at, senderColor(msg.GetSender()), tview.Escape(msg.GetSender()), tview.Escape(string(msg.GetContent()))))
+	case client.EventSystem:
+		u.appendLine(event.Room, "[gray]* "+tview.Escape(string(event.Message.GetContent()))+"[-]")
+	case client.EventReconnecting:
+		u.appendLine(event.Room, "[yellow]* connection lost, reconnecting[-]")
+	case client.EventReconnected:
+		u.appendLine(event.Room, "[green]* reconnected[-]")
+	case client.EventClosed:
+		if event.Err != nil {
+			u.appendLine(event.Room, "[red]* "+tview.Escape(event.Err.Error())+"[-]")
+		}
+	}
+}
+
+func (u *ui) listRooms() {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		response, err := u.chat.ListRooms(ctx, &proto.Empty{})
+		u.app.QueueUpdateDraw(func() {
+			if err != nil {
+				u.notice("listing rooms: %v", err)
+				return
+			}
+			names := response.GetRoomNames()
+			sort.Strings(names)
+			u.notice("rooms: %s", strings.Join(names, ", "))
+		})
+	}()
+}
+
+func (u *ui) who(room string) {
+	if room == lobby {
+		u.notice("not in a room")
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		response, err := u.chat.ListMembers(ctx, &proto.RoomRequest{RoomName: room})
+		u.app.QueueUpdateDraw(func() {
+			if err != nil {
+				u.notice("listing members: %v", err)
+				return
+			}
+			names := make([]string, 0, len(response.GetMembers()))
+			for _, member := range response.GetMembers() {
+				names = append(names, fmt.Sprintf("[%s]%s[-]", senderColor(member), tview.Escape(member)))
+			}
+			u.appendLine(room, "[gray]* members:[-] "+strings.Join(names, ", "))
+		})
+	}()
+}
+
+// refreshRooms keeps the room list in sync with the server and joins the direct message rooms
+// other users opened with us, except those the user left.
+func (u *ui) refreshRooms() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		response, err := u.chat.ListRooms(ctx, &proto.Empty{})
+		cancel()
+		if err == nil {
+			u.app.QueueUpdateDraw(func() {
+				u.serverRooms = response.GetRoomNames()
+				for _, room := range u.serverRooms {
+					if _, ok := dmPeer(room, u.user); ok && !u.joined[room] && !u.left[room] {
+						current := u.current
+						u.join(room)
+						u.show(current)
+					}
+				}
+				u.updateRoomList()
+			})
+		}
+		time.Sleep(refreshInterval)
+	}
+}
+
+func (u *ui) updateRoomList() {
+	names := map[string]bool{}
+	for _, room := range u.serverRooms {
+		if !strings.HasPrefix(room, dmPrefix) {
+			names[room] = true
+		}
+	}
+	for room := range u.joined {
+		names[room] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for room := range names {
+		sorted = append(sorted, room)
+	}
+	sort.Strings(sorted)
+	selected := u.rooms.GetCurrentItem()
+	u.rooms.Clear()
+	for _, room := range sorted {
+		label := "  " + room
+		if peer, ok := dmPeer(room, u.user); ok {
+			label = "  @" + peer
+		}
+		if u.in(room) {
+			label = "*" + label[1:]
+		}
+		if n := u.unread[room]; n > 0 {
+			label += fmt.Sprintf(" (%d)", n)
+		}
+		if room == u.current {
+			label = "[::b]" + tview.Escape(label) + "[::-]"
+		} else {
+			label = tview.Escape(label)
+		}
+		u.rooms.AddItem(label, room, 0, nil)
+	}
+	u.rooms.SetCurrentItem(selected)
+}
+
+func (u *ui) show(room string) {
+	u.current = room
+	delete(u.unread, room)
+	title := " " + room + " "
+	if room == lobby {
+		title = " chat-cli "
+	} else if peer, ok := dmPeer(room, u.user); ok {
+		title = " @" + peer + " "
+	}
+	u.messages.SetTitle(title)
+	u.messages.SetText(u.buffer(room).String())
+	u.messages.ScrollToEnd()
+	u.updateRoomList()
+}
+
+func (u *ui) buffer(room string) *strings.Builder {
+	b, ok := u.buffers[room]
+	if !ok {
+		b = &strings.Builder{}
+		u.buffers[room] = b
+	}
+	return b
+}
+
+// appendLine adds a line, which may contain color tags, to the room's buffer.
+func (u *ui) appendLine(room, line string) {
+	u.buffer(room).WriteString(line + "\n")
+	if room == u.current {
+		fmt.Fprintln(u.messages, line)
+		u.messages.ScrollToEnd()
+		return
+	}
+	u.unread[room]++
+	u.updateRoomList()
+}
+
+// notice shows the output of a command in the lobby, or in the current room.
+func (u *ui) notice(format string, args ...interface{}) {
+	u.appendLine(u.current, "[gray]"+tview.Escape(fmt.Sprintf(format, args...))+"[-]")
+}
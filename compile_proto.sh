@@ -1,7 +1,13 @@
 #! /usr/bin/env bash
 
- protoc --go_out . \
+ protoc -I . -I third_party/googleapis \
+    --go_out . \
     --go-grpc_out .  \
+    --grpc-gateway_out . \
 proto/protobuf/*.proto
 
+ protoc -I . -I third_party/googleapis \
+    --openapiv2_out . --openapiv2_opt allow_merge=true,merge_file_name=proto/openapi \
+proto/protobuf/Chat.proto
+
 #mv proto/*.pb.go proto/genproto
\ No newline at end of file
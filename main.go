@@ -1,27 +1,287 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 	"grpc-chat/proto"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err.Error())
+	os.Exit(1)
+}
+
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatalln(err)
+	// A .env file is optional; variables already set in the environment take precedence over it.
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fatal("reading .env", err)
+	}
+	cfg, err := proto.LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "9000"
+	if err != nil {
+		fatal("loading configuration", err)
+	}
+	logLevel := new(slog.LevelVar)
+	_ = logLevel.UnmarshalText([]byte(cfg.LogLevel))
+	logger := proto.NewLogger(os.Stderr, logLevel, cfg.LogFormat)
+	slog.SetDefault(logger)
+	port := cfg.Port
+	lis, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		fatal("listening on :"+port, err)
 	}
-	lis, _ := net.Listen("tcp", ":"+port)
 
-	baseServer := grpc.NewServer()
-	srv := proto.NewChatServer()
+	srv := proto.NewChatServer(cfg)
+	var tracerProvider *sdktrace.TracerProvider
+	if cfg.TracingExporter == "stdout" {
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			fatal("creating trace exporter", err)
+		}
+		tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+		srv.SetTracerProvider(tracerProvider)
+	}
+	serverOptions := append(cfg.Liveness.ServerOptions(),
+		grpc.ChainUnaryInterceptor(srv.UnaryInterceptors()...),
+		grpc.ChainStreamInterceptor(srv.StreamInterceptors()...),
+	)
+	baseServer := grpc.NewServer(serverOptions...)
+	if cfg.WordListFile != "" {
+		verdict := proto.VerdictRewrite
+		if cfg.WordListMode == "reject" {
+			verdict = proto.VerdictReject
+		}
+		filter, err := proto.NewWordListFilter(cfg.WordListFile, verdict)
+		if err != nil {
+			fatal("loading word list", err)
+		}
+		srv.RegisterFilter(filter)
+	}
+	auditSink, err := proto.NewJSONLinesAuditSink(cfg.AuditLogFile)
+	if err != nil {
+		fatal("opening audit log", err)
+	}
+	srv.SetAuditSink(auditSink)
+	var webhooks *proto.Webhooks
+	if len(cfg.Webhooks.Endpoints) > 0 {
+		webhooks, err = proto.NewWebhooks(cfg.Webhooks)
+		if err != nil {
+			fatal("opening webhook dead letter file", err)
+		}
+		srv.SetWebhooks(webhooks)
+	}
+	var broker proto.Broker
+	if cfg.BrokerURL != "" {
+		broker, err = proto.NewNATSBroker(cfg.BrokerURL)
+		if err != nil {
+			fatal("connecting to broker", err)
+		}
+		if err := srv.SetBroker(broker); err != nil {
+			fatal("subscribing to broker", err)
+		}
+	}
 	proto.RegisterChatServiceServer(baseServer, srv)
-	log.Println("gRPC server listening on :" + port)
-	baseServer.Serve(lis)
+	// The admin service shares the chat port unless ADMIN_PORT moves it to its own listener,
+	// which can then be kept off the public network.
+	adminPort := cfg.AdminPort
+	adminServer := baseServer
+	if adminPort != "" {
+		adminServer = grpc.NewServer(serverOptions...)
+	}
+	proto.RegisterAdminServiceServer(adminServer, proto.NewAdmin(srv))
+	proto.RegisterBotServiceServer(baseServer, proto.NewBots(srv))
+	proto.RegisterKeyDirectoryServer(baseServer, proto.NewKeys(srv))
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthServer.SetServingStatus(proto.ChatService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(baseServer, healthServer)
+	if cfg.Reflection {
+		reflection.Register(baseServer)
+	}
+	var cluster *proto.Cluster
+	if cfg.Cluster.Address != "" {
+		cluster = proto.NewCluster(srv, cfg.Cluster)
+		proto.RegisterClusterServiceServer(baseServer, cluster)
+		cluster.Start()
+	}
+	if cfg.Federation.Address != "" {
+		federation := proto.NewFederation(srv, cfg.Federation)
+		proto.RegisterFederationServiceServer(baseServer, federation)
+		for _, link := range cfg.Federation.Links {
+			if err := federation.LinkFromSpec(context.Background(), link); err != nil {
+				logger.Warn("linking federated room", "link", link, "error", err.Error())
+			}
+		}
+	}
+
+	metricsPort := cfg.MetricsPort
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", srv.Metrics().Handler())
+	metricsServer := &http.Server{Addr: ":" + metricsPort, Handler: mux}
+	// Browsers can't open native gRPC streams, so WEB_PORT serves the chat over gRPC-Web and
+	// a JSON WebSocket bridge instead.
+	var webServer *http.Server
+	if cfg.Web.Port != "" {
+		webServer = &http.Server{Addr: ":" + cfg.Web.Port, Handler: proto.NewWebHandler(baseServer, srv, cfg.Web)}
+	}
+	// REST_PORT serves the JSON API, which calls the chat service over a local connection.
+	var restServer *http.Server
+	if cfg.REST.Port != "" {
+		handler, err := proto.NewRESTHandler(context.Background(), "localhost:"+port,
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			fatal("creating REST gateway", err)
+		}
+		restServer = &http.Server{Addr: ":" + cfg.REST.Port, Handler: handler}
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Info("gRPC server listening", "port", port)
+		serveErr <- baseServer.Serve(lis)
+	}()
+	if adminServer != baseServer {
+		adminLis, err := net.Listen("tcp", ":"+adminPort)
+		if err != nil {
+			fatal("listening on :"+adminPort, err)
+		}
+		go func() {
+			logger.Info("admin server listening", "port", adminPort)
+			serveErr <- adminServer.Serve(adminLis)
+		}()
+	}
+	go func() {
+		logger.Info("metrics listening", "port", metricsPort)
+		if err := metricsServer.ListenAndServe(); err != http.ErrServerClosed {
+			serveErr <- err
+		}
+	}()
+	if webServer != nil {
+		go func() {
+			logger.Info("web gateway listening", "port", cfg.Web.Port, "allowed_origins", cfg.Web.AllowedOrigins)
+			if err := webServer.ListenAndServe(); err != http.ErrServerClosed {
+				serveErr <- err
+			}
+		}()
+	}
+	if restServer != nil {
+		go func() {
+			logger.Info("REST gateway listening", "port", cfg.REST.Port)
+			if err := restServer.ListenAndServe(); err != http.ErrServerClosed {
+				serveErr <- err
+			}
+		}()
+	}
+	go func() {
+		<-srv.Ready()
+		healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		healthServer.SetServingStatus(proto.ChatService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+		logger.Info("ready to serve")
+	}()
+	// SIGHUP reloads the configuration file. The environment and flags are those the process
+	// was started with, so they keep overriding the file.
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	go func() {
+		for range reloads {
+			next, err := proto.LoadConfig(os.Args[1:])
+			if err != nil {
+				logger.Error("reloading configuration, keeping the current one", "error", err.Error())
+				continue
+			}
+			_ = logLevel.UnmarshalText([]byte(next.LogLevel))
+			if restart := srv.Reload(next); len(restart) > 0 {
+				logger.Warn("configuration reloaded, some changes need a restart", "settings", restart)
+			} else {
+				logger.Info("configuration reloaded")
+			}
+		}
+	}()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case err := <-serveErr:
+		fatal("serving", err)
+	case sig := <-signals:
+		logger.Info("shutting down", "signal", sig.String())
+	}
+	healthServer.Shutdown()
+
+	// Everything that can still change the rooms stops before their state is saved, and the
+	// audit log and the broker stay open until nothing can write to them anymore.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if cluster != nil {
+		cluster.Leave()
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Warn("draining connections", "error", err.Error())
+	}
+	if webServer != nil {
+		// WebSocket connections were hijacked from the server, which doesn't wait for them.
+		// Their subscriptions ended with the drain above.
+		if err := webServer.Shutdown(ctx); err != nil {
+			logger.Warn("stopping web gateway", "error", err.Error())
+		}
+	}
+	if restServer != nil {
+		if err := restServer.Shutdown(ctx); err != nil {
+			logger.Warn("stopping REST gateway", "error", err.Error())
+		}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		if adminServer != baseServer {
+			adminServer.GracefulStop()
+		}
+		baseServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		logger.Warn("shutdown deadline exceeded, closing remaining connections")
+		adminServer.Stop()
+		baseServer.Stop()
+	}
+	if err := srv.SaveSnapshot(); err != nil {
+		logger.Error("saving snapshot", "error", err.Error())
+	}
+	if webhooks != nil {
+		if err := webhooks.Close(ctx); err != nil {
+			logger.Warn("delivering pending webhooks", "error", err.Error())
+		}
+	}
+	if err := auditSink.Close(); err != nil {
+		logger.Error("closing audit log", "error", err.Error())
+	}
+	if broker != nil {
+		broker.Close()
+	}
+	if err := metricsServer.Shutdown(ctx); err != nil {
+		logger.Warn("stopping metrics server", "error", err.Error())
+	}
+	if tracerProvider != nil {
+		if err := tracerProvider.Shutdown(ctx); err != nil {
+			logger.Warn("flushing traces", "error", err.Error())
+		}
+	}
 }
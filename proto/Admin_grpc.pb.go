@@ -0,0 +1,249 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.6.1
+// source: proto/protobuf/Admin.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// AdminServiceClient is the client API for AdminService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminServiceClient interface {
+	ListConnections(ctx context.Context, in *ListConnectionsRequest, opts ...grpc.CallOption) (*ListConnectionsResponse, error)
+	ForceDisconnect(ctx context.Context, in *ForceDisconnectRequest, opts ...grpc.CallOption) (*Empty, error)
+	CloseRoom(ctx context.Context, in *CloseRoomRequest, opts ...grpc.CallOption) (*Empty, error)
+	BroadcastSystemAnnouncement(ctx context.Context, in *AnnouncementRequest, opts ...grpc.CallOption) (*Empty, error)
+	DumpRoomState(ctx context.Context, in *RoomStateRequest, opts ...grpc.CallOption) (*RoomStateDump, error)
+}
+
+type adminServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminServiceClient(cc grpc.ClientConnInterface) AdminServiceClient {
+	return &adminServiceClient{cc}
+}
+
+func (c *adminServiceClient) ListConnections(ctx context.Context, in *ListConnectionsRequest, opts ...grpc.CallOption) (*ListConnectionsResponse, error) {
+	out := new(ListConnectionsResponse)
+	err := c.cc.Invoke(ctx, "/AdminService/ListConnections", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) ForceDisconnect(ctx context.Context, in *ForceDisconnectRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/AdminService/ForceDisconnect", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) CloseRoom(ctx context.Context, in *CloseRoomRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/AdminService/CloseRoom", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) BroadcastSystemAnnouncement(ctx context.Context, in *AnnouncementRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/AdminService/BroadcastSystemAnnouncement", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) DumpRoomState(ctx context.Context, in *RoomStateRequest, opts ...grpc.CallOption) (*RoomStateDump, error) {
+	out := new(RoomStateDump)
+	err := c.cc.Invoke(ctx, "/AdminService/DumpRoomState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServiceServer is the server API for AdminService service.
+// All implementations must embed UnimplementedAdminServiceServer
+// for forward compatibility
+type AdminServiceServer interface {
+	ListConnections(context.Context, *ListConnectionsRequest) (*ListConnectionsResponse, error)
+	ForceDisconnect(context.Context, *ForceDisconnectRequest) (*Empty, error)
+	CloseRoom(context.Context, *CloseRoomRequest) (*Empty, error)
+	BroadcastSystemAnnouncement(context.Context, *AnnouncementRequest) (*Empty, error)
+	DumpRoomState(context.Context, *RoomStateRequest) (*RoomStateDump, error)
+	mustEmbedUnimplementedAdminServiceServer()
+}
+
+// UnimplementedAdminServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminServiceServer struct {
+}
+
+func (UnimplementedAdminServiceServer) ListConnections(context.Context, *ListConnectionsRequest) (*ListConnectionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListConnections not implemented")
+}
+func (UnimplementedAdminServiceServer) ForceDisconnect(context.Context, *ForceDisconnectRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ForceDisconnect not implemented")
+}
+func (UnimplementedAdminServiceServer) CloseRoom(context.Context, *CloseRoomRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CloseRoom not implemented")
+}
+func (UnimplementedAdminServiceServer) BroadcastSystemAnnouncement(context.Context, *AnnouncementRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BroadcastSystemAnnouncement not implemented")
+}
+func (UnimplementedAdminServiceServer) DumpRoomState(context.Context, *RoomStateRequest) (*RoomStateDump, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DumpRoomState not implemented")
+}
+func (UnimplementedAdminServiceServer) mustEmbedUnimplementedAdminServiceServer() {}
+
+// UnsafeAdminServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServiceServer will
+// result in compilation errors.
+type UnsafeAdminServiceServer interface {
+	mustEmbedUnimplementedAdminServiceServer()
+}
+
+func RegisterAdminServiceServer(s grpc.ServiceRegistrar, srv AdminServiceServer) {
+	s.RegisterService(&AdminService_ServiceDesc, srv)
+}
+
+func _AdminService_ListConnections_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListConnectionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).ListConnections(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/AdminService/ListConnections",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).ListConnections(ctx, req.(*ListConnectionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_ForceDisconnect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ForceDisconnectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).ForceDisconnect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/AdminService/ForceDisconnect",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).ForceDisconnect(ctx, req.(*ForceDisconnectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_CloseRoom_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CloseRoomRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).CloseRoom(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/AdminService/CloseRoom",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).CloseRoom(ctx, req.(*CloseRoomRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_BroadcastSystemAnnouncement_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AnnouncementRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).BroadcastSystemAnnouncement(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/AdminService/BroadcastSystemAnnouncement",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).BroadcastSystemAnnouncement(ctx, req.(*AnnouncementRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_DumpRoomState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RoomStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).DumpRoomState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/AdminService/DumpRoomState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).DumpRoomState(ctx, req.(*RoomStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AdminService_ServiceDesc is the grpc.ServiceDesc for AdminService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AdminService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "AdminService",
+	HandlerType: (*AdminServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListConnections",
+			Handler:    _AdminService_ListConnections_Handler,
+		},
+		{
+			MethodName: "ForceDisconnect",
+			Handler:    _AdminService_ForceDisconnect_Handler,
+		},
+		{
+			MethodName: "CloseRoom",
+			Handler:    _AdminService_CloseRoom_Handler,
+		},
+		{
+			MethodName: "BroadcastSystemAnnouncement",
+			Handler:    _AdminService_BroadcastSystemAnnouncement_Handler,
+		},
+		{
+			MethodName: "DumpRoomState",
+			Handler:    _AdminService_DumpRoomState_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/protobuf/Admin.proto",
+}
@@ -0,0 +1,553 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.27.1
+// 	protoc        v3.6.1
+// source: proto/protobuf/Bot.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// CommandSpec describes a slash command for /help
+type CommandSpec struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name        string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`   // the command without its slash, e.g. roll
+	Usage       string `protobuf:"bytes,2,opt,name=usage,proto3" json:"usage,omitempty"` // e.g. /roll [NdM]
+	Description string `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+}
+
+func (x *CommandSpec) Reset() {
+	*x = CommandSpec{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Bot_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CommandSpec) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandSpec) ProtoMessage() {}
+
+func (x *CommandSpec) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Bot_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandSpec.ProtoReflect.Descriptor instead.
+func (*CommandSpec) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Bot_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CommandSpec) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *CommandSpec) GetUsage() string {
+	if x != nil {
+		return x.Usage
+	}
+	return ""
+}
+
+func (x *CommandSpec) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+// CommandInvocation is a message starting with a slash, sent to the bot handling the command
+type CommandInvocation struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	InvocationID string   `protobuf:"bytes,1,opt,name=invocationID,proto3" json:"invocationID,omitempty"` // identifies the invocation in the bot's reply
+	Command      string   `protobuf:"bytes,2,opt,name=command,proto3" json:"command,omitempty"`           // the command without its slash
+	Args         []string `protobuf:"bytes,3,rep,name=args,proto3" json:"args,omitempty"`                 // the arguments split on whitespace
+	RawArgs      string   `protobuf:"bytes,4,opt,name=rawArgs,proto3" json:"rawArgs,omitempty"`           // everything after the command, as typed
+	RoomName     string   `protobuf:"bytes,5,opt,name=roomName,proto3" json:"roomName,omitempty"`
+	Sender       string   `protobuf:"bytes,6,opt,name=sender,proto3" json:"sender,omitempty"` // the ID of the user that invoked the command
+	Timestamp    uint64   `protobuf:"varint,7,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (x *CommandInvocation) Reset() {
+	*x = CommandInvocation{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Bot_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CommandInvocation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandInvocation) ProtoMessage() {}
+
+func (x *CommandInvocation) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Bot_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandInvocation.ProtoReflect.Descriptor instead.
+func (*CommandInvocation) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Bot_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CommandInvocation) GetInvocationID() string {
+	if x != nil {
+		return x.InvocationID
+	}
+	return ""
+}
+
+func (x *CommandInvocation) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *CommandInvocation) GetArgs() []string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *CommandInvocation) GetRawArgs() string {
+	if x != nil {
+		return x.RawArgs
+	}
+	return ""
+}
+
+func (x *CommandInvocation) GetRoomName() string {
+	if x != nil {
+		return x.RoomName
+	}
+	return ""
+}
+
+func (x *CommandInvocation) GetSender() string {
+	if x != nil {
+		return x.Sender
+	}
+	return ""
+}
+
+func (x *CommandInvocation) GetTimestamp() uint64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+type BotReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	InvocationID string `protobuf:"bytes,1,opt,name=invocationID,proto3" json:"invocationID,omitempty"`
+	Content      string `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"` // posted to the room as the bot. Empty posts nothing
+	Error        string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`     // returned to the user that invoked the command instead of posting content
+}
+
+func (x *BotReply) Reset() {
+	*x = BotReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Bot_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BotReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BotReply) ProtoMessage() {}
+
+func (x *BotReply) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Bot_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BotReply.ProtoReflect.Descriptor instead.
+func (*BotReply) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Bot_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BotReply) GetInvocationID() string {
+	if x != nil {
+		return x.InvocationID
+	}
+	return ""
+}
+
+func (x *BotReply) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *BotReply) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type BotRegistration struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	BotName  string         `protobuf:"bytes,1,opt,name=botName,proto3" json:"botName,omitempty"` // the sender of the bot's replies
+	Commands []*CommandSpec `protobuf:"bytes,2,rep,name=commands,proto3" json:"commands,omitempty"`
+}
+
+func (x *BotRegistration) Reset() {
+	*x = BotRegistration{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Bot_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BotRegistration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BotRegistration) ProtoMessage() {}
+
+func (x *BotRegistration) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Bot_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BotRegistration.ProtoReflect.Descriptor instead.
+func (*BotRegistration) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Bot_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BotRegistration) GetBotName() string {
+	if x != nil {
+		return x.BotName
+	}
+	return ""
+}
+
+func (x *BotRegistration) GetCommands() []*CommandSpec {
+	if x != nil {
+		return x.Commands
+	}
+	return nil
+}
+
+// BotMessage is sent by a bot: a registration first, then a reply to each invocation
+type BotMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Body:
+	//	*BotMessage_Register
+	//	*BotMessage_Reply
+	Body isBotMessage_Body `protobuf_oneof:"body"`
+}
+
+func (x *BotMessage) Reset() {
+	*x = BotMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Bot_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BotMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BotMessage) ProtoMessage() {}
+
+func (x *BotMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Bot_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BotMessage.ProtoReflect.Descriptor instead.
+func (*BotMessage) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Bot_proto_rawDescGZIP(), []int{4}
+}
+
+func (m *BotMessage) GetBody() isBotMessage_Body {
+	if m != nil {
+		return m.Body
+	}
+	return nil
+}
+
+func (x *BotMessage) GetRegister() *BotRegistration {
+	if x, ok := x.GetBody().(*BotMessage_Register); ok {
+		return x.Register
+	}
+	return nil
+}
+
+func (x *BotMessage) GetReply() *BotReply {
+	if x, ok := x.GetBody().(*BotMessage_Reply); ok {
+		return x.Reply
+	}
+	return nil
+}
+
+type isBotMessage_Body interface {
+	isBotMessage_Body()
+}
+
+type BotMessage_Register struct {
+	Register *BotRegistration `protobuf:"bytes,1,opt,name=register,proto3,oneof"`
+}
+
+type BotMessage_Reply struct {
+	Reply *BotReply `protobuf:"bytes,2,opt,name=reply,proto3,oneof"`
+}
+
+func (*BotMessage_Register) isBotMessage_Body() {}
+
+func (*BotMessage_Reply) isBotMessage_Body() {}
+
+var File_proto_protobuf_Bot_proto protoreflect.FileDescriptor
+
+var file_proto_protobuf_Bot_proto_rawDesc = []byte{
+	0x0a, 0x18, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2f, 0x42, 0x6f, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x59, 0x0a, 0x0b, 0x43, 0x6f,
+	0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x53, 0x70, 0x65, 0x63, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a,
+	0x05, 0x75, 0x73, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x75, 0x73,
+	0x61, 0x67, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69,
+	0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69,
+	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0xd1, 0x01, 0x0a, 0x11, 0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e,
+	0x64, 0x49, 0x6e, 0x76, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x22, 0x0a, 0x0c, 0x69,
+	0x6e, 0x76, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0c, 0x69, 0x6e, 0x76, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x44, 0x12,
+	0x18, 0x0a, 0x07, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x07, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x61, 0x72, 0x67,
+	0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x04, 0x61, 0x72, 0x67, 0x73, 0x12, 0x18, 0x0a,
+	0x07, 0x72, 0x61, 0x77, 0x41, 0x72, 0x67, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07,
+	0x72, 0x61, 0x77, 0x41, 0x72, 0x67, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x6f, 0x6f, 0x6d, 0x4e,
+	0x61, 0x6d, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x6f, 0x6f, 0x6d, 0x4e,
+	0x61, 0x6d, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x12, 0x1c, 0x0a, 0x09, 0x74,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x07, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09,
+	0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x22, 0x5e, 0x0a, 0x08, 0x42, 0x6f, 0x74,
+	0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x22, 0x0a, 0x0c, 0x69, 0x6e, 0x76, 0x6f, 0x63, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x69, 0x6e, 0x76,
+	0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x44, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x6e,
+	0x74, 0x65, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x6f, 0x6e, 0x74,
+	0x65, 0x6e, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x22, 0x55, 0x0a, 0x0f, 0x42, 0x6f, 0x74,
+	0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x18, 0x0a, 0x07,
+	0x62, 0x6f, 0x74, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x62,
+	0x6f, 0x74, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x28, 0x0a, 0x08, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e,
+	0x64, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x43, 0x6f, 0x6d, 0x6d, 0x61,
+	0x6e, 0x64, 0x53, 0x70, 0x65, 0x63, 0x52, 0x08, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x73,
+	0x22, 0x67, 0x0a, 0x0a, 0x42, 0x6f, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x2e,
+	0x0a, 0x08, 0x72, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x10, 0x2e, 0x42, 0x6f, 0x74, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x48, 0x00, 0x52, 0x08, 0x72, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x12, 0x21,
+	0x0a, 0x05, 0x72, 0x65, 0x70, 0x6c, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x09, 0x2e,
+	0x42, 0x6f, 0x74, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x48, 0x00, 0x52, 0x05, 0x72, 0x65, 0x70, 0x6c,
+	0x79, 0x42, 0x06, 0x0a, 0x04, 0x62, 0x6f, 0x64, 0x79, 0x32, 0x3c, 0x0a, 0x0a, 0x42, 0x6f, 0x74,
+	0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x2e, 0x0a, 0x07, 0x43, 0x6f, 0x6e, 0x6e, 0x65,
+	0x63, 0x74, 0x12, 0x0b, 0x2e, 0x42, 0x6f, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x1a,
+	0x12, 0x2e, 0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x49, 0x6e, 0x76, 0x6f, 0x63, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x28, 0x01, 0x30, 0x01, 0x42, 0x0a, 0x5a, 0x08, 0x2e, 0x2f, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x2f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_proto_protobuf_Bot_proto_rawDescOnce sync.Once
+	file_proto_protobuf_Bot_proto_rawDescData = file_proto_protobuf_Bot_proto_rawDesc
+)
+
+func file_proto_protobuf_Bot_proto_rawDescGZIP() []byte {
+	file_proto_protobuf_Bot_proto_rawDescOnce.Do(func() {
+		file_proto_protobuf_Bot_proto_rawDescData = protoimpl.X.CompressGZIP(file_proto_protobuf_Bot_proto_rawDescData)
+	})
+	return file_proto_protobuf_Bot_proto_rawDescData
+}
+
+var file_proto_protobuf_Bot_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_proto_protobuf_Bot_proto_goTypes = []interface{}{
+	(*CommandSpec)(nil),       // 0: CommandSpec
+	(*CommandInvocation)(nil), // 1: CommandInvocation
+	(*BotReply)(nil),          // 2: BotReply
+	(*BotRegistration)(nil),   // 3: BotRegistration
+	(*BotMessage)(nil),        // 4: BotMessage
+}
+var file_proto_protobuf_Bot_proto_depIdxs = []int32{
+	0, // 0: BotRegistration.commands:type_name -> CommandSpec
+	3, // 1: BotMessage.register:type_name -> BotRegistration
+	2, // 2: BotMessage.reply:type_name -> BotReply
+	4, // 3: BotService.Connect:input_type -> BotMessage
+	1, // 4: BotService.Connect:output_type -> CommandInvocation
+	4, // [4:5] is the sub-list for method output_type
+	3, // [3:4] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_proto_protobuf_Bot_proto_init() }
+func file_proto_protobuf_Bot_proto_init() {
+	if File_proto_protobuf_Bot_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_proto_protobuf_Bot_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CommandSpec); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_protobuf_Bot_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CommandInvocation); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_protobuf_Bot_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BotReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_protobuf_Bot_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BotRegistration); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_protobuf_Bot_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BotMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_proto_protobuf_Bot_proto_msgTypes[4].OneofWrappers = []interface{}{
+		(*BotMessage_Register)(nil),
+		(*BotMessage_Reply)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_proto_protobuf_Bot_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_protobuf_Bot_proto_goTypes,
+		DependencyIndexes: file_proto_protobuf_Bot_proto_depIdxs,
+		MessageInfos:      file_proto_protobuf_Bot_proto_msgTypes,
+	}.Build()
+	File_proto_protobuf_Bot_proto = out.File
+	file_proto_protobuf_Bot_proto_rawDesc = nil
+	file_proto_protobuf_Bot_proto_goTypes = nil
+	file_proto_protobuf_Bot_proto_depIdxs = nil
+}
@@ -0,0 +1,139 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.6.1
+// source: proto/protobuf/Bot.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// BotServiceClient is the client API for BotService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BotServiceClient interface {
+	// admin only: register commands and receive their invocations for as long as the stream lasts
+	Connect(ctx context.Context, opts ...grpc.CallOption) (BotService_ConnectClient, error)
+}
+
+type botServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBotServiceClient(cc grpc.ClientConnInterface) BotServiceClient {
+	return &botServiceClient{cc}
+}
+
+func (c *botServiceClient) Connect(ctx context.Context, opts ...grpc.CallOption) (BotService_ConnectClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BotService_ServiceDesc.Streams[0], "/BotService/Connect", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &botServiceConnectClient{stream}
+	return x, nil
+}
+
+type BotService_ConnectClient interface {
+	Send(*BotMessage) error
+	Recv() (*CommandInvocation, error)
+	grpc.ClientStream
+}
+
+type botServiceConnectClient struct {
+	grpc.ClientStream
+}
+
+func (x *botServiceConnectClient) Send(m *BotMessage) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *botServiceConnectClient) Recv() (*CommandInvocation, error) {
+	m := new(CommandInvocation)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// BotServiceServer is the server API for BotService service.
+// All implementations must embed UnimplementedBotServiceServer
+// for forward compatibility
+type BotServiceServer interface {
+	// admin only: register commands and receive their invocations for as long as the stream lasts
+	Connect(BotService_ConnectServer) error
+	mustEmbedUnimplementedBotServiceServer()
+}
+
+// UnimplementedBotServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedBotServiceServer struct {
+}
+
+func (UnimplementedBotServiceServer) Connect(BotService_ConnectServer) error {
+	return status.Errorf(codes.Unimplemented, "method Connect not implemented")
+}
+func (UnimplementedBotServiceServer) mustEmbedUnimplementedBotServiceServer() {}
+
+// UnsafeBotServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BotServiceServer will
+// result in compilation errors.
+type UnsafeBotServiceServer interface {
+	mustEmbedUnimplementedBotServiceServer()
+}
+
+func RegisterBotServiceServer(s grpc.ServiceRegistrar, srv BotServiceServer) {
+	s.RegisterService(&BotService_ServiceDesc, srv)
+}
+
+func _BotService_Connect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(BotServiceServer).Connect(&botServiceConnectServer{stream})
+}
+
+type BotService_ConnectServer interface {
+	Send(*CommandInvocation) error
+	Recv() (*BotMessage, error)
+	grpc.ServerStream
+}
+
+type botServiceConnectServer struct {
+	grpc.ServerStream
+}
+
+func (x *botServiceConnectServer) Send(m *CommandInvocation) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *botServiceConnectServer) Recv() (*BotMessage, error) {
+	m := new(BotMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// BotService_ServiceDesc is the grpc.ServiceDesc for BotService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var BotService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "BotService",
+	HandlerType: (*BotServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Connect",
+			Handler:       _BotService_Connect_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "proto/protobuf/Bot.proto",
+}
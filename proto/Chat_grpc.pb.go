@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go-grpc. DO NOT EDIT.
 // versions:
-// - protoc-gen-go-grpc v1.1.0
+// - protoc-gen-go-grpc v1.2.0
 // - protoc             v3.6.1
 // source: proto/protobuf/Chat.proto
 
@@ -22,10 +22,21 @@ const _ = grpc.SupportPackageIsVersion7
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ChatServiceClient interface {
+	// send a message to a given chat room
 	SendMessage(ctx context.Context, in *ChatMessage, opts ...grpc.CallOption) (*Empty, error)
+	// subscribe to a room. Over HTTP, pass initialConnectionRequest.serverID as a query parameter
+	// and send Accept: text/event-stream to receive server-sent events
 	Subscribe(ctx context.Context, in *RoomRequest, opts ...grpc.CallOption) (ChatService_SubscribeClient, error)
 	UnsubscribeAll(ctx context.Context, in *ConnectionRequest, opts ...grpc.CallOption) (*Empty, error)
+	// get all the rooms on the selected gateway
 	ListRooms(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ListRoomResponse, error)
+	// get the users in a room, including users on federated servers
+	ListMembers(ctx context.Context, in *RoomRequest, opts ...grpc.CallOption) (*ListMembersResponse, error)
+	KickUser(ctx context.Context, in *ModerationRequest, opts ...grpc.CallOption) (*Empty, error)
+	BanUser(ctx context.Context, in *ModerationRequest, opts ...grpc.CallOption) (*Empty, error)
+	MuteUser(ctx context.Context, in *ModerationRequest, opts ...grpc.CallOption) (*Empty, error)
+	SetSlowMode(ctx context.Context, in *SlowModeRequest, opts ...grpc.CallOption) (*Empty, error)
+	QueryAuditLog(ctx context.Context, in *AuditQuery, opts ...grpc.CallOption) (*AuditQueryResponse, error)
 }
 
 type chatServiceClient struct {
@@ -95,14 +106,79 @@ func (c *chatServiceClient) ListRooms(ctx context.Context, in *Empty, opts ...gr
 	return out, nil
 }
 
+func (c *chatServiceClient) ListMembers(ctx context.Context, in *RoomRequest, opts ...grpc.CallOption) (*ListMembersResponse, error) {
+	out := new(ListMembersResponse)
+	err := c.cc.Invoke(ctx, "/ChatService/ListMembers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) KickUser(ctx context.Context, in *ModerationRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/ChatService/KickUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) BanUser(ctx context.Context, in *ModerationRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/ChatService/BanUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) MuteUser(ctx context.Context, in *ModerationRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/ChatService/MuteUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) SetSlowMode(ctx context.Context, in *SlowModeRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/ChatService/SetSlowMode", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) QueryAuditLog(ctx context.Context, in *AuditQuery, opts ...grpc.CallOption) (*AuditQueryResponse, error) {
+	out := new(AuditQueryResponse)
+	err := c.cc.Invoke(ctx, "/ChatService/QueryAuditLog", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ChatServiceServer is the server API for ChatService service.
 // All implementations must embed UnimplementedChatServiceServer
 // for forward compatibility
 type ChatServiceServer interface {
+	// send a message to a given chat room
 	SendMessage(context.Context, *ChatMessage) (*Empty, error)
+	// subscribe to a room. Over HTTP, pass initialConnectionRequest.serverID as a query parameter
+	// and send Accept: text/event-stream to receive server-sent events
 	Subscribe(*RoomRequest, ChatService_SubscribeServer) error
 	UnsubscribeAll(context.Context, *ConnectionRequest) (*Empty, error)
+	// get all the rooms on the selected gateway
 	ListRooms(context.Context, *Empty) (*ListRoomResponse, error)
+	// get the users in a room, including users on federated servers
+	ListMembers(context.Context, *RoomRequest) (*ListMembersResponse, error)
+	KickUser(context.Context, *ModerationRequest) (*Empty, error)
+	BanUser(context.Context, *ModerationRequest) (*Empty, error)
+	MuteUser(context.Context, *ModerationRequest) (*Empty, error)
+	SetSlowMode(context.Context, *SlowModeRequest) (*Empty, error)
+	QueryAuditLog(context.Context, *AuditQuery) (*AuditQueryResponse, error)
 	mustEmbedUnimplementedChatServiceServer()
 }
 
@@ -122,6 +198,24 @@ func (UnimplementedChatServiceServer) UnsubscribeAll(context.Context, *Connectio
 func (UnimplementedChatServiceServer) ListRooms(context.Context, *Empty) (*ListRoomResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListRooms not implemented")
 }
+func (UnimplementedChatServiceServer) ListMembers(context.Context, *RoomRequest) (*ListMembersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMembers not implemented")
+}
+func (UnimplementedChatServiceServer) KickUser(context.Context, *ModerationRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method KickUser not implemented")
+}
+func (UnimplementedChatServiceServer) BanUser(context.Context, *ModerationRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BanUser not implemented")
+}
+func (UnimplementedChatServiceServer) MuteUser(context.Context, *ModerationRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MuteUser not implemented")
+}
+func (UnimplementedChatServiceServer) SetSlowMode(context.Context, *SlowModeRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetSlowMode not implemented")
+}
+func (UnimplementedChatServiceServer) QueryAuditLog(context.Context, *AuditQuery) (*AuditQueryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryAuditLog not implemented")
+}
 func (UnimplementedChatServiceServer) mustEmbedUnimplementedChatServiceServer() {}
 
 // UnsafeChatServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -210,6 +304,114 @@ func _ChatService_ListRooms_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ChatService_ListMembers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RoomRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).ListMembers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ChatService/ListMembers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).ListMembers(ctx, req.(*RoomRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_KickUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModerationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).KickUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ChatService/KickUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).KickUser(ctx, req.(*ModerationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_BanUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModerationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).BanUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ChatService/BanUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).BanUser(ctx, req.(*ModerationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_MuteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModerationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).MuteUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ChatService/MuteUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).MuteUser(ctx, req.(*ModerationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_SetSlowMode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SlowModeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).SetSlowMode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ChatService/SetSlowMode",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).SetSlowMode(ctx, req.(*SlowModeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_QueryAuditLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuditQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).QueryAuditLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ChatService/QueryAuditLog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).QueryAuditLog(ctx, req.(*AuditQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ChatService_ServiceDesc is the grpc.ServiceDesc for ChatService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -229,6 +431,30 @@ var ChatService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ListRooms",
 			Handler:    _ChatService_ListRooms_Handler,
 		},
+		{
+			MethodName: "ListMembers",
+			Handler:    _ChatService_ListMembers_Handler,
+		},
+		{
+			MethodName: "KickUser",
+			Handler:    _ChatService_KickUser_Handler,
+		},
+		{
+			MethodName: "BanUser",
+			Handler:    _ChatService_BanUser_Handler,
+		},
+		{
+			MethodName: "MuteUser",
+			Handler:    _ChatService_MuteUser_Handler,
+		},
+		{
+			MethodName: "SetSlowMode",
+			Handler:    _ChatService_SetSlowMode_Handler,
+		},
+		{
+			MethodName: "QueryAuditLog",
+			Handler:    _ChatService_QueryAuditLog_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
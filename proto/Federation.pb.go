@@ -0,0 +1,417 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.27.1
+// 	protoc        v3.6.1
+// source: proto/protobuf/Federation.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// FederationLink asks a server to relay messages between one of its rooms and a room on the caller
+type FederationLink struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ServerID   string `protobuf:"bytes,1,opt,name=serverID,proto3" json:"serverID,omitempty"`     // the ID of the calling server
+	Address    string `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`       // the address the calling server's FederationService is reachable at
+	LocalRoom  string `protobuf:"bytes,3,opt,name=localRoom,proto3" json:"localRoom,omitempty"`   // the room on the receiving server
+	RemoteRoom string `protobuf:"bytes,4,opt,name=remoteRoom,proto3" json:"remoteRoom,omitempty"` // the room on the calling server
+}
+
+func (x *FederationLink) Reset() {
+	*x = FederationLink{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Federation_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FederationLink) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FederationLink) ProtoMessage() {}
+
+func (x *FederationLink) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Federation_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FederationLink.ProtoReflect.Descriptor instead.
+func (*FederationLink) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Federation_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FederationLink) GetServerID() string {
+	if x != nil {
+		return x.ServerID
+	}
+	return ""
+}
+
+func (x *FederationLink) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *FederationLink) GetLocalRoom() string {
+	if x != nil {
+		return x.LocalRoom
+	}
+	return ""
+}
+
+func (x *FederationLink) GetRemoteRoom() string {
+	if x != nil {
+		return x.RemoteRoom
+	}
+	return ""
+}
+
+// FederatedMessage is a chat message relayed between federated servers
+type FederatedMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	RoomName string       `protobuf:"bytes,1,opt,name=roomName,proto3" json:"roomName,omitempty"` // the room on the receiving server
+	Message  *ChatMessage `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Origin   string       `protobuf:"bytes,3,opt,name=origin,proto3" json:"origin,omitempty"` // the ID of the server the message was first sent to
+	Via      []string     `protobuf:"bytes,4,rep,name=via,proto3" json:"via,omitempty"`       // the IDs of every server that relayed the message so far
+}
+
+func (x *FederatedMessage) Reset() {
+	*x = FederatedMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Federation_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FederatedMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FederatedMessage) ProtoMessage() {}
+
+func (x *FederatedMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Federation_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FederatedMessage.ProtoReflect.Descriptor instead.
+func (*FederatedMessage) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Federation_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *FederatedMessage) GetRoomName() string {
+	if x != nil {
+		return x.RoomName
+	}
+	return ""
+}
+
+func (x *FederatedMessage) GetMessage() *ChatMessage {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *FederatedMessage) GetOrigin() string {
+	if x != nil {
+		return x.Origin
+	}
+	return ""
+}
+
+func (x *FederatedMessage) GetVia() []string {
+	if x != nil {
+		return x.Via
+	}
+	return nil
+}
+
+type MembersRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	RoomName string `protobuf:"bytes,1,opt,name=roomName,proto3" json:"roomName,omitempty"`
+}
+
+func (x *MembersRequest) Reset() {
+	*x = MembersRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Federation_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *MembersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MembersRequest) ProtoMessage() {}
+
+func (x *MembersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Federation_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MembersRequest.ProtoReflect.Descriptor instead.
+func (*MembersRequest) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Federation_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *MembersRequest) GetRoomName() string {
+	if x != nil {
+		return x.RoomName
+	}
+	return ""
+}
+
+type MembersResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Members []string `protobuf:"bytes,1,rep,name=members,proto3" json:"members,omitempty"`
+}
+
+func (x *MembersResponse) Reset() {
+	*x = MembersResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Federation_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *MembersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MembersResponse) ProtoMessage() {}
+
+func (x *MembersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Federation_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MembersResponse.ProtoReflect.Descriptor instead.
+func (*MembersResponse) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Federation_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *MembersResponse) GetMembers() []string {
+	if x != nil {
+		return x.Members
+	}
+	return nil
+}
+
+var File_proto_protobuf_Federation_proto protoreflect.FileDescriptor
+
+var file_proto_protobuf_Federation_proto_rawDesc = []byte{
+	0x0a, 0x1f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2f, 0x46, 0x65, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x1a, 0x19, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2f, 0x43, 0x68, 0x61, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x84, 0x01, 0x0a,
+	0x0e, 0x46, 0x65, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4c, 0x69, 0x6e, 0x6b, 0x12,
+	0x1a, 0x0a, 0x08, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x08, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x49, 0x44, 0x12, 0x18, 0x0a, 0x07, 0x61,
+	0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x61, 0x64,
+	0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x52, 0x6f,
+	0x6f, 0x6d, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x52,
+	0x6f, 0x6f, 0x6d, 0x12, 0x1e, 0x0a, 0x0a, 0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x52, 0x6f, 0x6f,
+	0x6d, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x52,
+	0x6f, 0x6f, 0x6d, 0x22, 0x80, 0x01, 0x0a, 0x10, 0x46, 0x65, 0x64, 0x65, 0x72, 0x61, 0x74, 0x65,
+	0x64, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x6f, 0x6f, 0x6d,
+	0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x6f, 0x6f, 0x6d,
+	0x4e, 0x61, 0x6d, 0x65, 0x12, 0x26, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x43, 0x68, 0x61, 0x74, 0x4d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x16, 0x0a, 0x06,
+	0x6f, 0x72, 0x69, 0x67, 0x69, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6f, 0x72,
+	0x69, 0x67, 0x69, 0x6e, 0x12, 0x10, 0x0a, 0x03, 0x76, 0x69, 0x61, 0x18, 0x04, 0x20, 0x03, 0x28,
+	0x09, 0x52, 0x03, 0x76, 0x69, 0x61, 0x22, 0x2c, 0x0a, 0x0e, 0x4d, 0x65, 0x6d, 0x62, 0x65, 0x72,
+	0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x6f, 0x6f, 0x6d,
+	0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x6f, 0x6f, 0x6d,
+	0x4e, 0x61, 0x6d, 0x65, 0x22, 0x2b, 0x0a, 0x0f, 0x4d, 0x65, 0x6d, 0x62, 0x65, 0x72, 0x73, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x6d, 0x62, 0x65,
+	0x72, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x6d, 0x62, 0x65, 0x72,
+	0x73, 0x32, 0xa9, 0x01, 0x0a, 0x11, 0x46, 0x65, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x1f, 0x0a, 0x04, 0x4c, 0x69, 0x6e, 0x6b, 0x12,
+	0x0f, 0x2e, 0x46, 0x65, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4c, 0x69, 0x6e, 0x6b,
+	0x1a, 0x06, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x12, 0x21, 0x0a, 0x06, 0x55, 0x6e, 0x6c, 0x69,
+	0x6e, 0x6b, 0x12, 0x0f, 0x2e, 0x46, 0x65, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4c,
+	0x69, 0x6e, 0x6b, 0x1a, 0x06, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x12, 0x22, 0x0a, 0x05, 0x52,
+	0x65, 0x6c, 0x61, 0x79, 0x12, 0x11, 0x2e, 0x46, 0x65, 0x64, 0x65, 0x72, 0x61, 0x74, 0x65, 0x64,
+	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x1a, 0x06, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x12,
+	0x2c, 0x0a, 0x07, 0x4d, 0x65, 0x6d, 0x62, 0x65, 0x72, 0x73, 0x12, 0x0f, 0x2e, 0x4d, 0x65, 0x6d,
+	0x62, 0x65, 0x72, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x10, 0x2e, 0x4d, 0x65,
+	0x6d, 0x62, 0x65, 0x72, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x0a, 0x5a,
+	0x08, 0x2e, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x33,
+}
+
+var (
+	file_proto_protobuf_Federation_proto_rawDescOnce sync.Once
+	file_proto_protobuf_Federation_proto_rawDescData = file_proto_protobuf_Federation_proto_rawDesc
+)
+
+func file_proto_protobuf_Federation_proto_rawDescGZIP() []byte {
+	file_proto_protobuf_Federation_proto_rawDescOnce.Do(func() {
+		file_proto_protobuf_Federation_proto_rawDescData = protoimpl.X.CompressGZIP(file_proto_protobuf_Federation_proto_rawDescData)
+	})
+	return file_proto_protobuf_Federation_proto_rawDescData
+}
+
+var file_proto_protobuf_Federation_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_proto_protobuf_Federation_proto_goTypes = []interface{}{
+	(*FederationLink)(nil),   // 0: FederationLink
+	(*FederatedMessage)(nil), // 1: FederatedMessage
+	(*MembersRequest)(nil),   // 2: MembersRequest
+	(*MembersResponse)(nil),  // 3: MembersResponse
+	(*ChatMessage)(nil),      // 4: ChatMessage
+	(*Empty)(nil),            // 5: Empty
+}
+var file_proto_protobuf_Federation_proto_depIdxs = []int32{
+	4, // 0: FederatedMessage.message:type_name -> ChatMessage
+	0, // 1: FederationService.Link:input_type -> FederationLink
+	0, // 2: FederationService.Unlink:input_type -> FederationLink
+	1, // 3: FederationService.Relay:input_type -> FederatedMessage
+	2, // 4: FederationService.Members:input_type -> MembersRequest
+	5, // 5: FederationService.Link:output_type -> Empty
+	5, // 6: FederationService.Unlink:output_type -> Empty
+	5, // 7: FederationService.Relay:output_type -> Empty
+	3, // 8: FederationService.Members:output_type -> MembersResponse
+	5, // [5:9] is the sub-list for method output_type
+	1, // [1:5] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_proto_protobuf_Federation_proto_init() }
+func file_proto_protobuf_Federation_proto_init() {
+	if File_proto_protobuf_Federation_proto != nil {
+		return
+	}
+	file_proto_protobuf_Chat_proto_init()
+	if !protoimpl.UnsafeEnabled {
+		file_proto_protobuf_Federation_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FederationLink); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_protobuf_Federation_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FederatedMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_protobuf_Federation_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*MembersRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_protobuf_Federation_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*MembersResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_proto_protobuf_Federation_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_protobuf_Federation_proto_goTypes,
+		DependencyIndexes: file_proto_protobuf_Federation_proto_depIdxs,
+		MessageInfos:      file_proto_protobuf_Federation_proto_msgTypes,
+	}.Build()
+	File_proto_protobuf_Federation_proto = out.File
+	file_proto_protobuf_Federation_proto_rawDesc = nil
+	file_proto_protobuf_Federation_proto_goTypes = nil
+	file_proto_protobuf_Federation_proto_depIdxs = nil
+}
@@ -0,0 +1,569 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.27.1
+// 	protoc        v3.6.1
+// source: proto/protobuf/Keys.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// OneTimePrekey is handed out to a single sender, then deleted from the directory
+type OneTimePrekey struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	KeyID     uint32 `protobuf:"varint,1,opt,name=keyID,proto3" json:"keyID,omitempty"` // chosen by the owner, to find the private key again
+	PublicKey []byte `protobuf:"bytes,2,opt,name=publicKey,proto3" json:"publicKey,omitempty"`
+}
+
+func (x *OneTimePrekey) Reset() {
+	*x = OneTimePrekey{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Keys_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *OneTimePrekey) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OneTimePrekey) ProtoMessage() {}
+
+func (x *OneTimePrekey) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Keys_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OneTimePrekey.ProtoReflect.Descriptor instead.
+func (*OneTimePrekey) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Keys_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *OneTimePrekey) GetKeyID() uint32 {
+	if x != nil {
+		return x.KeyID
+	}
+	return 0
+}
+
+func (x *OneTimePrekey) GetPublicKey() []byte {
+	if x != nil {
+		return x.PublicKey
+	}
+	return nil
+}
+
+// PublicKeyBundle is what a sender needs to start an encrypted session with a user. The server
+// only stores and hands out the keys, and never checks the signatures, which is up to clients.
+type PublicKeyBundle struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	UserID          string           `protobuf:"bytes,1,opt,name=userID,proto3" json:"userID,omitempty"`
+	IdentityKey     []byte           `protobuf:"bytes,2,opt,name=identityKey,proto3" json:"identityKey,omitempty"` // the user's long-term public key
+	SignedPrekey    []byte           `protobuf:"bytes,3,opt,name=signedPrekey,proto3" json:"signedPrekey,omitempty"`
+	PrekeySignature []byte           `protobuf:"bytes,4,opt,name=prekeySignature,proto3" json:"prekeySignature,omitempty"` // signature of signedPrekey by the identity key
+	OneTimePrekeys  []*OneTimePrekey `protobuf:"bytes,5,rep,name=oneTimePrekeys,proto3" json:"oneTimePrekeys,omitempty"`   // added to the stored prekeys on upload, at most one on fetch
+	UpdatedAt       uint64           `protobuf:"varint,6,opt,name=updatedAt,proto3" json:"updatedAt,omitempty"`            // unix timestamp of the last upload
+}
+
+func (x *PublicKeyBundle) Reset() {
+	*x = PublicKeyBundle{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Keys_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PublicKeyBundle) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublicKeyBundle) ProtoMessage() {}
+
+func (x *PublicKeyBundle) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Keys_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublicKeyBundle.ProtoReflect.Descriptor instead.
+func (*PublicKeyBundle) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Keys_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PublicKeyBundle) GetUserID() string {
+	if x != nil {
+		return x.UserID
+	}
+	return ""
+}
+
+func (x *PublicKeyBundle) GetIdentityKey() []byte {
+	if x != nil {
+		return x.IdentityKey
+	}
+	return nil
+}
+
+func (x *PublicKeyBundle) GetSignedPrekey() []byte {
+	if x != nil {
+		return x.SignedPrekey
+	}
+	return nil
+}
+
+func (x *PublicKeyBundle) GetPrekeySignature() []byte {
+	if x != nil {
+		return x.PrekeySignature
+	}
+	return nil
+}
+
+func (x *PublicKeyBundle) GetOneTimePrekeys() []*OneTimePrekey {
+	if x != nil {
+		return x.OneTimePrekeys
+	}
+	return nil
+}
+
+func (x *PublicKeyBundle) GetUpdatedAt() uint64 {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return 0
+}
+
+type KeyRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	UserID string `protobuf:"bytes,1,opt,name=userID,proto3" json:"userID,omitempty"`
+}
+
+func (x *KeyRequest) Reset() {
+	*x = KeyRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Keys_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *KeyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyRequest) ProtoMessage() {}
+
+func (x *KeyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Keys_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyRequest.ProtoReflect.Descriptor instead.
+func (*KeyRequest) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Keys_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *KeyRequest) GetUserID() string {
+	if x != nil {
+		return x.UserID
+	}
+	return ""
+}
+
+type PrekeyCount struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Count uint32 `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"` // the one-time prekeys left for the user
+}
+
+func (x *PrekeyCount) Reset() {
+	*x = PrekeyCount{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Keys_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PrekeyCount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PrekeyCount) ProtoMessage() {}
+
+func (x *PrekeyCount) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Keys_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PrekeyCount.ProtoReflect.Descriptor instead.
+func (*PrekeyCount) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Keys_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PrekeyCount) GetCount() uint32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+// EncryptedPayload is the message as encrypted for one recipient
+type EncryptedPayload struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Recipient  string `protobuf:"bytes,1,opt,name=recipient,proto3" json:"recipient,omitempty"` // the user ID the payload is encrypted for
+	Header     []byte `protobuf:"bytes,2,opt,name=header,proto3" json:"header,omitempty"`       // session state the recipient needs to decrypt, e.g. the prekeys used
+	Ciphertext []byte `protobuf:"bytes,3,opt,name=ciphertext,proto3" json:"ciphertext,omitempty"`
+}
+
+func (x *EncryptedPayload) Reset() {
+	*x = EncryptedPayload{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Keys_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *EncryptedPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EncryptedPayload) ProtoMessage() {}
+
+func (x *EncryptedPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Keys_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EncryptedPayload.ProtoReflect.Descriptor instead.
+func (*EncryptedPayload) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Keys_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *EncryptedPayload) GetRecipient() string {
+	if x != nil {
+		return x.Recipient
+	}
+	return ""
+}
+
+func (x *EncryptedPayload) GetHeader() []byte {
+	if x != nil {
+		return x.Header
+	}
+	return nil
+}
+
+func (x *EncryptedPayload) GetCiphertext() []byte {
+	if x != nil {
+		return x.Ciphertext
+	}
+	return nil
+}
+
+// EncryptedEnvelope is the content of messages of type application/vnd.chat.encrypted. Each
+// subscriber only receives the payload encrypted for them.
+type EncryptedEnvelope struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Payloads []*EncryptedPayload `protobuf:"bytes,1,rep,name=payloads,proto3" json:"payloads,omitempty"`
+}
+
+func (x *EncryptedEnvelope) Reset() {
+	*x = EncryptedEnvelope{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Keys_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *EncryptedEnvelope) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EncryptedEnvelope) ProtoMessage() {}
+
+func (x *EncryptedEnvelope) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Keys_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EncryptedEnvelope.ProtoReflect.Descriptor instead.
+func (*EncryptedEnvelope) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Keys_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *EncryptedEnvelope) GetPayloads() []*EncryptedPayload {
+	if x != nil {
+		return x.Payloads
+	}
+	return nil
+}
+
+var File_proto_protobuf_Keys_proto protoreflect.FileDescriptor
+
+var file_proto_protobuf_Keys_proto_rawDesc = []byte{
+	0x0a, 0x19, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2f, 0x4b, 0x65, 0x79, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x19, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x43, 0x68, 0x61, 0x74,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x43, 0x0a, 0x0d, 0x4f, 0x6e, 0x65, 0x54, 0x69, 0x6d,
+	0x65, 0x50, 0x72, 0x65, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x6b, 0x65, 0x79, 0x49, 0x44,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x6b, 0x65, 0x79, 0x49, 0x44, 0x12, 0x1c, 0x0a,
+	0x09, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x4b, 0x65, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x09, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x4b, 0x65, 0x79, 0x22, 0xef, 0x01, 0x0a, 0x0f,
+	0x50, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x4b, 0x65, 0x79, 0x42, 0x75, 0x6e, 0x64, 0x6c, 0x65, 0x12,
+	0x16, 0x0a, 0x06, 0x75, 0x73, 0x65, 0x72, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x06, 0x75, 0x73, 0x65, 0x72, 0x49, 0x44, 0x12, 0x20, 0x0a, 0x0b, 0x69, 0x64, 0x65, 0x6e, 0x74,
+	0x69, 0x74, 0x79, 0x4b, 0x65, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0b, 0x69, 0x64,
+	0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x4b, 0x65, 0x79, 0x12, 0x22, 0x0a, 0x0c, 0x73, 0x69, 0x67,
+	0x6e, 0x65, 0x64, 0x50, 0x72, 0x65, 0x6b, 0x65, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x0c, 0x73, 0x69, 0x67, 0x6e, 0x65, 0x64, 0x50, 0x72, 0x65, 0x6b, 0x65, 0x79, 0x12, 0x28, 0x0a,
+	0x0f, 0x70, 0x72, 0x65, 0x6b, 0x65, 0x79, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0f, 0x70, 0x72, 0x65, 0x6b, 0x65, 0x79, 0x53, 0x69,
+	0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x12, 0x36, 0x0a, 0x0e, 0x6f, 0x6e, 0x65, 0x54, 0x69,
+	0x6d, 0x65, 0x50, 0x72, 0x65, 0x6b, 0x65, 0x79, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x0e, 0x2e, 0x4f, 0x6e, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x50, 0x72, 0x65, 0x6b, 0x65, 0x79, 0x52,
+	0x0e, 0x6f, 0x6e, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x50, 0x72, 0x65, 0x6b, 0x65, 0x79, 0x73, 0x12,
+	0x1c, 0x0a, 0x09, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x09, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x22, 0x24, 0x0a,
+	0x0a, 0x4b, 0x65, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x75,
+	0x73, 0x65, 0x72, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x75, 0x73, 0x65,
+	0x72, 0x49, 0x44, 0x22, 0x23, 0x0a, 0x0b, 0x50, 0x72, 0x65, 0x6b, 0x65, 0x79, 0x43, 0x6f, 0x75,
+	0x6e, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x22, 0x68, 0x0a, 0x10, 0x45, 0x6e, 0x63, 0x72,
+	0x79, 0x70, 0x74, 0x65, 0x64, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x1c, 0x0a, 0x09,
+	0x72, 0x65, 0x63, 0x69, 0x70, 0x69, 0x65, 0x6e, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x09, 0x72, 0x65, 0x63, 0x69, 0x70, 0x69, 0x65, 0x6e, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x65,
+	0x61, 0x64, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x68, 0x65, 0x61, 0x64,
+	0x65, 0x72, 0x12, 0x1e, 0x0a, 0x0a, 0x63, 0x69, 0x70, 0x68, 0x65, 0x72, 0x74, 0x65, 0x78, 0x74,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a, 0x63, 0x69, 0x70, 0x68, 0x65, 0x72, 0x74, 0x65,
+	0x78, 0x74, 0x22, 0x42, 0x0a, 0x11, 0x45, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x45,
+	0x6e, 0x76, 0x65, 0x6c, 0x6f, 0x70, 0x65, 0x12, 0x2d, 0x0a, 0x08, 0x70, 0x61, 0x79, 0x6c, 0x6f,
+	0x61, 0x64, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x45, 0x6e, 0x63, 0x72,
+	0x79, 0x70, 0x74, 0x65, 0x64, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x52, 0x08, 0x70, 0x61,
+	0x79, 0x6c, 0x6f, 0x61, 0x64, 0x73, 0x32, 0xaf, 0x01, 0x0a, 0x0c, 0x4b, 0x65, 0x79, 0x44, 0x69,
+	0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79, 0x12, 0x26, 0x0a, 0x0a, 0x55, 0x70, 0x6c, 0x6f, 0x61,
+	0x64, 0x4b, 0x65, 0x79, 0x73, 0x12, 0x10, 0x2e, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x4b, 0x65,
+	0x79, 0x42, 0x75, 0x6e, 0x64, 0x6c, 0x65, 0x1a, 0x06, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x12,
+	0x2a, 0x0a, 0x09, 0x46, 0x65, 0x74, 0x63, 0x68, 0x4b, 0x65, 0x79, 0x73, 0x12, 0x0b, 0x2e, 0x4b,
+	0x65, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x10, 0x2e, 0x50, 0x75, 0x62, 0x6c,
+	0x69, 0x63, 0x4b, 0x65, 0x79, 0x42, 0x75, 0x6e, 0x64, 0x6c, 0x65, 0x12, 0x29, 0x0a, 0x0c, 0x43,
+	0x6f, 0x75, 0x6e, 0x74, 0x50, 0x72, 0x65, 0x6b, 0x65, 0x79, 0x73, 0x12, 0x0b, 0x2e, 0x4b, 0x65,
+	0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0c, 0x2e, 0x50, 0x72, 0x65, 0x6b, 0x65,
+	0x79, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x20, 0x0a, 0x09, 0x52, 0x65, 0x73, 0x65, 0x74, 0x4b,
+	0x65, 0x79, 0x73, 0x12, 0x0b, 0x2e, 0x4b, 0x65, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x1a, 0x06, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x42, 0x0a, 0x5a, 0x08, 0x2e, 0x2f, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x2f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_proto_protobuf_Keys_proto_rawDescOnce sync.Once
+	file_proto_protobuf_Keys_proto_rawDescData = file_proto_protobuf_Keys_proto_rawDesc
+)
+
+func file_proto_protobuf_Keys_proto_rawDescGZIP() []byte {
+	file_proto_protobuf_Keys_proto_rawDescOnce.Do(func() {
+		file_proto_protobuf_Keys_proto_rawDescData = protoimpl.X.CompressGZIP(file_proto_protobuf_Keys_proto_rawDescData)
+	})
+	return file_proto_protobuf_Keys_proto_rawDescData
+}
+
+var file_proto_protobuf_Keys_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_proto_protobuf_Keys_proto_goTypes = []interface{}{
+	(*OneTimePrekey)(nil),     // 0: OneTimePrekey
+	(*PublicKeyBundle)(nil),   // 1: PublicKeyBundle
+	(*KeyRequest)(nil),        // 2: KeyRequest
+	(*PrekeyCount)(nil),       // 3: PrekeyCount
+	(*EncryptedPayload)(nil),  // 4: EncryptedPayload
+	(*EncryptedEnvelope)(nil), // 5: EncryptedEnvelope
+	(*Empty)(nil),             // 6: Empty
+}
+var file_proto_protobuf_Keys_proto_depIdxs = []int32{
+	0, // 0: PublicKeyBundle.oneTimePrekeys:type_name -> OneTimePrekey
+	4, // 1: EncryptedEnvelope.payloads:type_name -> EncryptedPayload
+	1, // 2: KeyDirectory.UploadKeys:input_type -> PublicKeyBundle
+	2, // 3: KeyDirectory.FetchKeys:input_type -> KeyRequest
+	2, // 4: KeyDirectory.CountPrekeys:input_type -> KeyRequest
+	2, // 5: KeyDirectory.ResetKeys:input_type -> KeyRequest
+	6, // 6: KeyDirectory.UploadKeys:output_type -> Empty
+	1, // 7: KeyDirectory.FetchKeys:output_type -> PublicKeyBundle
+	3, // 8: KeyDirectory.CountPrekeys:output_type -> PrekeyCount
+	6, // 9: KeyDirectory.ResetKeys:output_type -> Empty
+	6, // [6:10] is the sub-list for method output_type
+	2, // [2:6] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_proto_protobuf_Keys_proto_init() }
+func file_proto_protobuf_Keys_proto_init() {
+	if File_proto_protobuf_Keys_proto != nil {
+		return
+	}
+	file_proto_protobuf_Chat_proto_init()
+	if !protoimpl.UnsafeEnabled {
+		file_proto_protobuf_Keys_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*OneTimePrekey); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_protobuf_Keys_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PublicKeyBundle); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_protobuf_Keys_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*KeyRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_protobuf_Keys_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PrekeyCount); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_protobuf_Keys_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EncryptedPayload); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_protobuf_Keys_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EncryptedEnvelope); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_proto_protobuf_Keys_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_protobuf_Keys_proto_goTypes,
+		DependencyIndexes: file_proto_protobuf_Keys_proto_depIdxs,
+		MessageInfos:      file_proto_protobuf_Keys_proto_msgTypes,
+	}.Build()
+	File_proto_protobuf_Keys_proto = out.File
+	file_proto_protobuf_Keys_proto_rawDesc = nil
+	file_proto_protobuf_Keys_proto_goTypes = nil
+	file_proto_protobuf_Keys_proto_depIdxs = nil
+}
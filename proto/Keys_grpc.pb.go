@@ -0,0 +1,213 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.6.1
+// source: proto/protobuf/Keys.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// KeyDirectoryClient is the client API for KeyDirectory service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type KeyDirectoryClient interface {
+	UploadKeys(ctx context.Context, in *PublicKeyBundle, opts ...grpc.CallOption) (*Empty, error)
+	FetchKeys(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*PublicKeyBundle, error)
+	CountPrekeys(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*PrekeyCount, error)
+	ResetKeys(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*Empty, error)
+}
+
+type keyDirectoryClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewKeyDirectoryClient(cc grpc.ClientConnInterface) KeyDirectoryClient {
+	return &keyDirectoryClient{cc}
+}
+
+func (c *keyDirectoryClient) UploadKeys(ctx context.Context, in *PublicKeyBundle, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/KeyDirectory/UploadKeys", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keyDirectoryClient) FetchKeys(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*PublicKeyBundle, error) {
+	out := new(PublicKeyBundle)
+	err := c.cc.Invoke(ctx, "/KeyDirectory/FetchKeys", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keyDirectoryClient) CountPrekeys(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*PrekeyCount, error) {
+	out := new(PrekeyCount)
+	err := c.cc.Invoke(ctx, "/KeyDirectory/CountPrekeys", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keyDirectoryClient) ResetKeys(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/KeyDirectory/ResetKeys", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// KeyDirectoryServer is the server API for KeyDirectory service.
+// All implementations must embed UnimplementedKeyDirectoryServer
+// for forward compatibility
+type KeyDirectoryServer interface {
+	UploadKeys(context.Context, *PublicKeyBundle) (*Empty, error)
+	FetchKeys(context.Context, *KeyRequest) (*PublicKeyBundle, error)
+	CountPrekeys(context.Context, *KeyRequest) (*PrekeyCount, error)
+	ResetKeys(context.Context, *KeyRequest) (*Empty, error)
+	mustEmbedUnimplementedKeyDirectoryServer()
+}
+
+// UnimplementedKeyDirectoryServer must be embedded to have forward compatible implementations.
+type UnimplementedKeyDirectoryServer struct {
+}
+
+func (UnimplementedKeyDirectoryServer) UploadKeys(context.Context, *PublicKeyBundle) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UploadKeys not implemented")
+}
+func (UnimplementedKeyDirectoryServer) FetchKeys(context.Context, *KeyRequest) (*PublicKeyBundle, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FetchKeys not implemented")
+}
+func (UnimplementedKeyDirectoryServer) CountPrekeys(context.Context, *KeyRequest) (*PrekeyCount, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CountPrekeys not implemented")
+}
+func (UnimplementedKeyDirectoryServer) ResetKeys(context.Context, *KeyRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResetKeys not implemented")
+}
+func (UnimplementedKeyDirectoryServer) mustEmbedUnimplementedKeyDirectoryServer() {}
+
+// UnsafeKeyDirectoryServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to KeyDirectoryServer will
+// result in compilation errors.
+type UnsafeKeyDirectoryServer interface {
+	mustEmbedUnimplementedKeyDirectoryServer()
+}
+
+func RegisterKeyDirectoryServer(s grpc.ServiceRegistrar, srv KeyDirectoryServer) {
+	s.RegisterService(&KeyDirectory_ServiceDesc, srv)
+}
+
+func _KeyDirectory_UploadKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublicKeyBundle)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyDirectoryServer).UploadKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/KeyDirectory/UploadKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyDirectoryServer).UploadKeys(ctx, req.(*PublicKeyBundle))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KeyDirectory_FetchKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyDirectoryServer).FetchKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/KeyDirectory/FetchKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyDirectoryServer).FetchKeys(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KeyDirectory_CountPrekeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyDirectoryServer).CountPrekeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/KeyDirectory/CountPrekeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyDirectoryServer).CountPrekeys(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KeyDirectory_ResetKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyDirectoryServer).ResetKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/KeyDirectory/ResetKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyDirectoryServer).ResetKeys(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// KeyDirectory_ServiceDesc is the grpc.ServiceDesc for KeyDirectory service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var KeyDirectory_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "KeyDirectory",
+	HandlerType: (*KeyDirectoryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "UploadKeys",
+			Handler:    _KeyDirectory_UploadKeys_Handler,
+		},
+		{
+			MethodName: "FetchKeys",
+			Handler:    _KeyDirectory_FetchKeys_Handler,
+		},
+		{
+			MethodName: "CountPrekeys",
+			Handler:    _KeyDirectory_CountPrekeys_Handler,
+		},
+		{
+			MethodName: "ResetKeys",
+			Handler:    _KeyDirectory_ResetKeys_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/protobuf/Keys.proto",
+}
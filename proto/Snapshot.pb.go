@@ -0,0 +1,175 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.27.1
+// 	protoc        v3.6.1
+// source: proto/protobuf/Snapshot.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Snapshot struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Timestamp uint64             `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Rooms     []*RoomState       `protobuf:"bytes,2,rep,name=rooms,proto3" json:"rooms,omitempty"` // everything needed to bring the rooms back, as handed over between nodes
+	Keys      []*PublicKeyBundle `protobuf:"bytes,3,rep,name=keys,proto3" json:"keys,omitempty"`   // the key directory
+}
+
+func (x *Snapshot) Reset() {
+	*x = Snapshot{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_protobuf_Snapshot_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Snapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Snapshot) ProtoMessage() {}
+
+func (x *Snapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_protobuf_Snapshot_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Snapshot.ProtoReflect.Descriptor instead.
+func (*Snapshot) Descriptor() ([]byte, []int) {
+	return file_proto_protobuf_Snapshot_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Snapshot) GetTimestamp() uint64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *Snapshot) GetRooms() []*RoomState {
+	if x != nil {
+		return x.Rooms
+	}
+	return nil
+}
+
+func (x *Snapshot) GetKeys() []*PublicKeyBundle {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+var File_proto_protobuf_Snapshot_proto protoreflect.FileDescriptor
+
+var file_proto_protobuf_Snapshot_proto_rawDesc = []byte{
+	0x0a, 0x1d, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2f, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a,
+	0x19, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f,
+	0x43, 0x68, 0x61, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x1c, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x43, 0x6c, 0x75, 0x73, 0x74,
+	0x65, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x19, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x4b, 0x65, 0x79, 0x73, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x22, 0x70, 0x0a, 0x08, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x12,
+	0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x20, 0x0a,
+	0x05, 0x72, 0x6f, 0x6f, 0x6d, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x52,
+	0x6f, 0x6f, 0x6d, 0x53, 0x74, 0x61, 0x74, 0x65, 0x52, 0x05, 0x72, 0x6f, 0x6f, 0x6d, 0x73, 0x12,
+	0x24, 0x0a, 0x04, 0x6b, 0x65, 0x79, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x10, 0x2e,
+	0x50, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x4b, 0x65, 0x79, 0x42, 0x75, 0x6e, 0x64, 0x6c, 0x65, 0x52,
+	0x04, 0x6b, 0x65, 0x79, 0x73, 0x42, 0x0a, 0x5a, 0x08, 0x2e, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x2f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_proto_protobuf_Snapshot_proto_rawDescOnce sync.Once
+	file_proto_protobuf_Snapshot_proto_rawDescData = file_proto_protobuf_Snapshot_proto_rawDesc
+)
+
+func file_proto_protobuf_Snapshot_proto_rawDescGZIP() []byte {
+	file_proto_protobuf_Snapshot_proto_rawDescOnce.Do(func() {
+		file_proto_protobuf_Snapshot_proto_rawDescData = protoimpl.X.CompressGZIP(file_proto_protobuf_Snapshot_proto_rawDescData)
+	})
+	return file_proto_protobuf_Snapshot_proto_rawDescData
+}
+
+var file_proto_protobuf_Snapshot_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_proto_protobuf_Snapshot_proto_goTypes = []interface{}{
+	(*Snapshot)(nil),        // 0: Snapshot
+	(*RoomState)(nil),       // 1: RoomState
+	(*PublicKeyBundle)(nil), // 2: PublicKeyBundle
+}
+var file_proto_protobuf_Snapshot_proto_depIdxs = []int32{
+	1, // 0: Snapshot.rooms:type_name -> RoomState
+	2, // 1: Snapshot.keys:type_name -> PublicKeyBundle
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_proto_protobuf_Snapshot_proto_init() }
+func file_proto_protobuf_Snapshot_proto_init() {
+	if File_proto_protobuf_Snapshot_proto != nil {
+		return
+	}
+	file_proto_protobuf_Chat_proto_init()
+	file_proto_protobuf_Cluster_proto_init()
+	file_proto_protobuf_Keys_proto_init()
+	if !protoimpl.UnsafeEnabled {
+		file_proto_protobuf_Snapshot_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Snapshot); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_proto_protobuf_Snapshot_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_proto_protobuf_Snapshot_proto_goTypes,
+		DependencyIndexes: file_proto_protobuf_Snapshot_proto_depIdxs,
+		MessageInfos:      file_proto_protobuf_Snapshot_proto_msgTypes,
+	}.Build()
+	File_proto_protobuf_Snapshot_proto = out.File
+	file_proto_protobuf_Snapshot_proto_rawDesc = nil
+	file_proto_protobuf_Snapshot_proto_goTypes = nil
+	file_proto_protobuf_Snapshot_proto_depIdxs = nil
+}
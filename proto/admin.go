@@ -0,0 +1,195 @@
+package proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requireAdmin checks the admin-token metadata against the configured admin token. Admin
+// RPCs are refused altogether when no token is configured.
+func (s *Server) requireAdmin(ctx context.Context) error {
+	token := s.config.Load().AdminToken
+	if token == "" {
+		return status.Error(codes.PermissionDenied, "admin RPCs are disabled")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, got := range md.Get("admin-token") {
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid admin-token")
+}
+
+// adminActor is recorded as the actor of the audit events caused by admin RPCs.
+const adminActor = "ADMIN"
+
+// Admin inspects and controls the rooms and connections of this node. Every RPC requires
+// the admin token. It can be registered next to the ChatService or on a separate port.
+type Admin struct {
+	UnimplementedAdminServiceServer
+	server *Server
+}
+
+func NewAdmin(server *Server) *Admin {
+	return &Admin{server: server}
+}
+
+func (c *ClientConnection) info(roomID string) *ConnectionInfo {
+	return &ConnectionInfo{
+		ClientID:       c.clientID,
+		RoomName:       roomID,
+		Peer:           c.peer,
+		ConnectedSince: uint64(c.connectedSince.Unix()),
+		QueueDepth:     uint64(len(c.queue)),
+		BytesSent:      c.bytesSent.Load(),
+	}
+}
+
+func (r *Room) connectionInfos() []*ConnectionInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	infos := make([]*ConnectionInfo, 0, len(r.connections))
+	for _, conn := range r.connections {
+		infos = append(infos, conn.info(r.name))
+	}
+	return infos
+}
+
+// adminRooms returns the named room, or every room on this node when roomID is empty.
+func (s *Server) adminRooms(roomID string) ([]*Room, error) {
+	if roomID != "" {
+		room := s.getRoom(roomID)
+		if room == nil {
+			return nil, status.Errorf(codes.NotFound, "room %s does not exist on this node", roomID)
+		}
+		return []*Room{room}, nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rooms := make([]*Room, 0, len(s.roomsMap))
+	for _, room := range s.roomsMap {
+		rooms = append(rooms, room)
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].name < rooms[j].name })
+	return rooms, nil
+}
+
+func (a *Admin) ListConnections(ctx context.Context, request *ListConnectionsRequest) (*ListConnectionsResponse, error) {
+	if err := a.server.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	rooms, err := a.server.adminRooms(request.GetRoomName())
+	if err != nil {
+		return nil, err
+	}
+	response := &ListConnectionsResponse{Connections: []*ConnectionInfo{}}
+	for _, room := range rooms {
+		response.Connections = append(response.Connections, room.connectionInfos()...)
+	}
+	return response, nil
+}
+
+func (a *Admin) ForceDisconnect(ctx context.Context, request *ForceDisconnectRequest) (*Empty, error) {
+	if err := a.server.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	rooms, err := a.server.adminRooms(request.GetRoomName())
+	if err != nil {
+		return nil, err
+	}
+	disconnected := false
+	for _, room := range rooms {
+		if room.removeFromRoom(request.GetClientID(), "disconnected by an administrator", request.GetReason()) {
+			disconnected = true
+			a.server.recordAudit(AuditDisconnect, room.name, adminActor, request.GetClientID(), request.GetReason())
+		}
+	}
+	if !disconnected {
+		return nil, status.Errorf(codes.NotFound, "%s is not connected to this node", request.GetClientID())
+	}
+	return &Empty{}, nil
+}
+
+func (a *Admin) CloseRoom(ctx context.Context, request *CloseRoomRequest) (*Empty, error) {
+	if err := a.server.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	room := a.server.getRoom(request.GetRoomName())
+	if room == nil {
+		return nil, status.Errorf(codes.NotFound, "room %s does not exist on this node", request.GetRoomName())
+	}
+	content := "room closed by an administrator"
+	if request.GetReason() != "" {
+		content += ": " + request.GetReason()
+	}
+	room.mu.Lock()
+	connections := append([]*ClientConnection{}, room.connections...)
+	room.mu.Unlock()
+	notice := &ChatMessage{
+		Sender:    "GATEWAY",
+		Recipient: "",
+		Content:   []byte(content),
+		Timestamp: uint64(time.Now().Unix()),
+	}
+	for _, conn := range connections {
+		conn.enqueue(notice, nil)
+	}
+	a.server.evictRoom(request.GetRoomName(), status.Error(codes.Aborted, content))
+	a.server.logger.Load().Info("room closed", "room", request.GetRoomName(), "reason", request.GetReason())
+	a.server.recordAudit(AuditRoomClosed, request.GetRoomName(), adminActor, "", request.GetReason())
+	return &Empty{}, nil
+}
+
+func (a *Admin) BroadcastSystemAnnouncement(ctx context.Context, request *AnnouncementRequest) (*Empty, error) {
+	if err := a.server.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if request.GetContent() == "" {
+		return nil, status.Error(codes.InvalidArgument, "the announcement is empty")
+	}
+	rooms, err := a.server.adminRooms(request.GetRoomName())
+	if err != nil {
+		return nil, err
+	}
+	for _, room := range rooms {
+		room.BroadcastMessage(&ChatMessage{
+			Sender:    "GATEWAY",
+			Recipient: "",
+			Content:   []byte(request.GetContent()),
+			Timestamp: uint64(time.Now().Unix()),
+		})
+		a.server.recordAudit(AuditAnnounce, room.name, adminActor, "", request.GetContent())
+	}
+	return &Empty{}, nil
+}
+
+func (a *Admin) DumpRoomState(ctx context.Context, request *RoomStateRequest) (*RoomStateDump, error) {
+	if err := a.server.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	room := a.server.getRoom(request.GetRoomName())
+	if room == nil {
+		return nil, status.Errorf(codes.NotFound, "room %s does not exist on this node", request.GetRoomName())
+	}
+	state := room.exportState()
+	dump := &RoomStateDump{
+		State:            state,
+		Connections:      room.connectionInfos(),
+		LastSequence:     state.LastSequence,
+		RetainedMessages: uint32(len(state.History)),
+		Cursors:          state.Cursors,
+	}
+	// The dump counts the retained messages rather than including them.
+	state.History, state.Cursors, state.LastSequence = nil, nil, 0
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	dump.CreatedAt = uint64(room.created.Unix())
+	return dump, nil
+}
@@ -0,0 +1,250 @@
+package proto
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newAdminServer serves the chat and admin services of a server whose admin token is "admin",
+// and returns a context carrying that token.
+func newAdminServer(t *testing.T) (*Server, ChatServiceClient, AdminServiceClient, context.Context) {
+	t.Helper()
+	s := newTestServer(t, func(cfg *Config) { cfg.AdminToken = "admin" })
+	conn := dialTestServer(t, s, func(server *grpc.Server) { RegisterAdminServiceServer(server, NewAdmin(s)) })
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "admin-token", "admin")
+	return s, NewChatServiceClient(conn), NewAdminServiceClient(conn), ctx
+}
+
+// awaitNotice skips messages until the server sends a notice containing text.
+func awaitNotice(t *testing.T, stream ChatService_SubscribeClient, text string) {
+	t.Helper()
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("the stream ended before the notice %q: %v", text, err)
+		}
+		if msg.GetSender() == "GATEWAY" && strings.Contains(string(msg.GetContent()), text) {
+			return
+		}
+	}
+}
+
+// streamEnd returns the error the stream ends with.
+func streamEnd(stream ChatService_SubscribeClient) error {
+	for {
+		if _, err := stream.Recv(); err != nil {
+			return err
+		}
+	}
+}
+
+func TestAdminRequiresTheToken(t *testing.T) {
+	rpcs := map[string]func(*Admin, context.Context) error{
+		"ListConnections": func(a *Admin, ctx context.Context) error {
+			_, err := a.ListConnections(ctx, &ListConnectionsRequest{})
+			return err
+		},
+		"ForceDisconnect": func(a *Admin, ctx context.Context) error {
+			_, err := a.ForceDisconnect(ctx, &ForceDisconnectRequest{ClientID: "alice"})
+			return err
+		},
+		"CloseRoom": func(a *Admin, ctx context.Context) error {
+			_, err := a.CloseRoom(ctx, &CloseRoomRequest{RoomName: "room"})
+			return err
+		},
+		"BroadcastSystemAnnouncement": func(a *Admin, ctx context.Context) error {
+			_, err := a.BroadcastSystemAnnouncement(ctx, &AnnouncementRequest{Content: "hello"})
+			return err
+		},
+		"DumpRoomState": func(a *Admin, ctx context.Context) error {
+			_, err := a.DumpRoomState(ctx, &RoomStateRequest{RoomName: "room"})
+			return err
+		},
+	}
+	tests := []struct {
+		name       string
+		adminToken string
+		sent       []string
+		want       codes.Code
+	}{
+		{"disabled", "", []string{""}, codes.PermissionDenied},
+		{"no token", "admin", nil, codes.Unauthenticated},
+		{"wrong token", "admin", []string{"guess"}, codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		s := newTestServer(t, func(cfg *Config) { cfg.AdminToken = tt.adminToken })
+		s.importRoom(&RoomState{RoomName: "room"})
+		md := metadata.MD{}
+		for _, token := range tt.sent {
+			md.Append("admin-token", token)
+		}
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+		for name, rpc := range rpcs {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				if err := rpc(NewAdmin(s), ctx); status.Code(err) != tt.want {
+					t.Errorf("%v, want %s", err, tt.want)
+				}
+			})
+		}
+		if s.getRoom("room") == nil {
+			t.Errorf("%s: the room was closed", tt.name)
+		}
+	}
+}
+
+func TestAdminListConnections(t *testing.T) {
+	s, chat, admin, ctx := newAdminServer(t)
+	subscribe(t, chat, "room", "alice")
+	subscribe(t, chat, "room", "bob")
+	subscribe(t, chat, "other", "carol")
+	waitFor(t, "everyone to join", func() bool { return connected(s, "room") == 2 && connected(s, "other") == 1 })
+
+	tests := []struct {
+		room string
+		want []string
+	}{
+		{"", []string{"other/carol", "room/alice", "room/bob"}},
+		{"room", []string{"room/alice", "room/bob"}},
+	}
+	for _, tt := range tests {
+		response, err := admin.ListConnections(ctx, &ListConnectionsRequest{RoomName: tt.room})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, conn := range response.GetConnections() {
+			if conn.GetPeer() == "" || conn.GetConnectedSince() == 0 {
+				t.Errorf("%s has no peer or connection time: %v", conn.GetClientID(), conn)
+			}
+			got = append(got, conn.GetRoomName()+"/"+conn.GetClientID())
+		}
+		// Rooms are listed in order, and their subscribers in the order they happened to join.
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("connections of %q: %q, want %q", tt.room, got, tt.want)
+		}
+	}
+	if _, err := admin.ListConnections(ctx, &ListConnectionsRequest{RoomName: "nowhere"}); status.Code(err) != codes.NotFound {
+		t.Errorf("listing the connections of a missing room: %v, want NotFound", err)
+	}
+}
+
+func TestAdminForceDisconnect(t *testing.T) {
+	s, chat, admin, ctx := newAdminServer(t)
+	alice := subscribe(t, chat, "room", "alice")
+	bob := subscribe(t, chat, "room", "bob")
+	waitFor(t, "both to join", func() bool { return connected(s, "room") == 2 })
+
+	if _, err := admin.ForceDisconnect(ctx, &ForceDisconnectRequest{ClientID: "alice", Reason: "spam"}); err != nil {
+		t.Fatal(err)
+	}
+	awaitNotice(t, alice, "you were disconnected by an administrator: spam")
+	if err := streamEnd(alice); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("alice's stream ended with %v, want PermissionDenied", err)
+	}
+	awaitNotice(t, bob, "alice was disconnected by an administrator")
+	if n := connected(s, "room"); n != 1 {
+		t.Errorf("%d subscribers left, want bob", n)
+	}
+	if _, err := admin.ForceDisconnect(ctx, &ForceDisconnectRequest{ClientID: "alice"}); status.Code(err) != codes.NotFound {
+		t.Errorf("disconnecting alice again: %v, want NotFound", err)
+	}
+}
+
+func TestAdminCloseRoom(t *testing.T) {
+	s, chat, admin, ctx := newAdminServer(t)
+	alice := subscribe(t, chat, "room", "alice")
+	waitFor(t, "alice to join", func() bool { return connected(s, "room") == 1 })
+
+	if _, err := admin.CloseRoom(ctx, &CloseRoomRequest{RoomName: "room", Reason: "maintenance"}); err != nil {
+		t.Fatal(err)
+	}
+	awaitNotice(t, alice, "room closed by an administrator: maintenance")
+	if err := streamEnd(alice); status.Code(err) != codes.Aborted {
+		t.Errorf("alice's stream ended with %v, want Aborted", err)
+	}
+	if s.getRoom("room") != nil {
+		t.Error("the room still exists")
+	}
+	if _, err := admin.CloseRoom(ctx, &CloseRoomRequest{RoomName: "room"}); status.Code(err) != codes.NotFound {
+		t.Errorf("closing the room again: %v, want NotFound", err)
+	}
+}
+
+func TestAdminBroadcastSystemAnnouncement(t *testing.T) {
+	s, chat, admin, ctx := newAdminServer(t)
+	alice := subscribe(t, chat, "room", "alice")
+	carol := subscribe(t, chat, "other", "carol")
+	waitFor(t, "both to join", func() bool { return connected(s, "room") == 1 && connected(s, "other") == 1 })
+
+	if _, err := admin.BroadcastSystemAnnouncement(ctx, &AnnouncementRequest{Content: "restarting soon"}); err != nil {
+		t.Fatal(err)
+	}
+	awaitNotice(t, alice, "restarting soon")
+	awaitNotice(t, carol, "restarting soon")
+	if _, err := admin.BroadcastSystemAnnouncement(ctx, &AnnouncementRequest{RoomName: "other", Content: "only here"}); err != nil {
+		t.Fatal(err)
+	}
+	awaitNotice(t, carol, "only here")
+
+	errs := []struct {
+		request *AnnouncementRequest
+		want    codes.Code
+	}{
+		{&AnnouncementRequest{RoomName: "room"}, codes.InvalidArgument},
+		{&AnnouncementRequest{RoomName: "nowhere", Content: "hello"}, codes.NotFound},
+	}
+	for _, e := range errs {
+		if _, err := admin.BroadcastSystemAnnouncement(ctx, e.request); status.Code(err) != e.want {
+			t.Errorf("announcing %v: %v, want %s", e.request, err, e.want)
+		}
+	}
+	// alice only receives what was announced to her room.
+	send(t, chat, "bob", "room", "after")
+	for {
+		msg, err := alice.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.GetContentType() == HeartbeatContentType {
+			continue
+		}
+		if string(msg.GetContent()) != "after" {
+			t.Errorf("alice received %q, want the message after the announcements", msg.GetContent())
+		}
+		break
+	}
+}
+
+func TestAdminDumpRoomState(t *testing.T) {
+	s, chat, admin, ctx := newAdminServer(t)
+	alice := subscribe(t, chat, "room", "alice")
+	waitFor(t, "alice to join", func() bool { return connected(s, "room") == 1 })
+	send(t, chat, "alice", "room", "one")
+	send(t, chat, "alice", "room", "two")
+	receive(t, alice, 2)
+
+	dump, err := admin.DumpRoomState(ctx, &RoomStateRequest{RoomName: "room"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dump.GetState().GetRoomName() != "room" || len(dump.GetState().GetHistory()) != 0 {
+		t.Errorf("the state %v should name the room without its history", dump.GetState())
+	}
+	if dump.GetRetainedMessages() != 2 || dump.GetLastSequence() == 0 || dump.GetCreatedAt() == 0 {
+		t.Errorf("dumped %d messages up to %d, created at %d", dump.GetRetainedMessages(), dump.GetLastSequence(), dump.GetCreatedAt())
+	}
+	if conns := dump.GetConnections(); len(conns) != 1 || conns[0].GetClientID() != "alice" {
+		t.Errorf("dumped the connections %v, want alice's", conns)
+	}
+	if _, err := admin.DumpRoomState(ctx, &RoomStateRequest{RoomName: "nowhere"}); status.Code(err) != codes.NotFound {
+		t.Errorf("dumping a missing room: %v, want NotFound", err)
+	}
+}
@@ -0,0 +1,147 @@
+package proto
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// newAuditSink records events in a JSON-lines file of the test, whose path it also returns.
+func newAuditSink(t *testing.T, events ...*AuditEvent) (*JSONLinesAuditSink, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewJSONLinesAuditSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sink.Close() })
+	for _, event := range events {
+		if err := sink.Record(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sink, path
+}
+
+func TestJSONLinesAuditSinkWritesOneEventPerLine(t *testing.T) {
+	event := &AuditEvent{Timestamp: 100, Action: AuditKick, RoomName: "room", Actor: "alice", Target: "bob", Detail: "spam"}
+	_, path := newAuditSink(t, event, &AuditEvent{Timestamp: 101, Action: AuditLeave, RoomName: "room", Actor: "bob"})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("the log has %d lines, want 2:\n%s", len(lines), data)
+	}
+	got := &AuditEvent{}
+	if err := protojson.Unmarshal([]byte(lines[0]), got); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, event) {
+		t.Errorf("the first line is %v, want %v", got, event)
+	}
+
+	// Events recorded before are kept when the log is reopened, and a torn line is skipped.
+	if err := os.WriteFile(path, append(data, `{"action":`...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sink, err := NewJSONLinesAuditSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	events, err := sink.Query(&AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Errorf("queried %d events after reopening the log, want 2", len(events))
+	}
+}
+
+func TestQueryAuditLog(t *testing.T) {
+	sink, _ := newAuditSink(t,
+		&AuditEvent{Timestamp: 100, Action: AuditRoomCreated, RoomName: "room", Actor: "alice"},
+		&AuditEvent{Timestamp: 110, Action: AuditJoin, RoomName: "room", Actor: "bob"},
+		&AuditEvent{Timestamp: 120, Action: AuditKick, RoomName: "room", Actor: "alice", Target: "bob"},
+		&AuditEvent{Timestamp: 130, Action: AuditJoin, RoomName: "other", Actor: "alice"},
+		&AuditEvent{Timestamp: 140, Action: AuditRoomClosed, RoomName: "other", Actor: adminActor},
+	)
+	s := newTestServer(t, func(cfg *Config) { cfg.AdminToken = "admin" })
+	s.SetAuditSink(sink)
+	admin := metadata.NewIncomingContext(context.Background(), metadata.Pairs("admin-token", "admin"))
+	tests := []struct {
+		name  string
+		query *AuditQuery
+		// want are the timestamps of the events returned.
+		want []uint64
+	}{
+		{"everything", &AuditQuery{}, []uint64{100, 110, 120, 130, 140}},
+		{"room", &AuditQuery{RoomName: "room"}, []uint64{100, 110, 120}},
+		{"actor", &AuditQuery{Actor: "alice"}, []uint64{100, 120, 130}},
+		{"action", &AuditQuery{Action: AuditJoin}, []uint64{110, 130}},
+		{"since", &AuditQuery{Since: 120}, []uint64{120, 130, 140}},
+		{"until", &AuditQuery{Until: 110}, []uint64{100, 110}},
+		{"time range", &AuditQuery{Since: 105, Until: 135}, []uint64{110, 120, 130}},
+		{"combined", &AuditQuery{RoomName: "room", Actor: "alice", Since: 101}, []uint64{120}},
+		{"limit keeps the latest", &AuditQuery{Limit: 2}, []uint64{130, 140}},
+		{"no match", &AuditQuery{RoomName: "nowhere"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := s.QueryAuditLog(admin, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []uint64
+			for _, event := range response.GetEvents() {
+				got = append(got, event.GetTimestamp())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("events at %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("events at %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	if _, err := s.QueryAuditLog(context.Background(), &AuditQuery{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("QueryAuditLog without the admin token: %v, want Unauthenticated", err)
+	}
+}
+
+func TestServerRecordsAuditEvents(t *testing.T) {
+	sink, _ := newAuditSink(t)
+	s := newTestServer(t)
+	s.SetAuditSink(sink)
+	chat := NewChatServiceClient(dialTestServer(t, s))
+	subscribe(t, chat, "room", "alice")
+	waitFor(t, "alice to join", func() bool { return connected(s, "room") == 1 })
+
+	events, err := sink.Query(&AuditQuery{RoomName: "room"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, event := range events {
+		if event.GetActor() != "alice" || event.GetTimestamp() == 0 {
+			t.Errorf("recorded %v, want alice's action with its time", event)
+		}
+		actions = append(actions, event.GetAction())
+	}
+	if strings.Join(actions, ",") != AuditRoomCreated+","+AuditJoin {
+		t.Errorf("recorded %q, want the room created and alice joining", actions)
+	}
+}
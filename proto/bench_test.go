@@ -0,0 +1,145 @@
+package proto
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchSentAtKey carries the send time of a benchmark message, in Unix nanoseconds.
+const benchSentAtKey = "bench-sent-at"
+
+// newBenchServer starts a server without rate limits or history.
+func newBenchServer(b *testing.B) (*Server, ChatServiceClient) {
+	s := newTestServer(b, func(cfg *Config) {
+		cfg.RateLimit = RateLimitConfig{
+			Sender:  RateLimit{Burst: 1},
+			Room:    RateLimit{Burst: 1},
+			Gateway: RateLimit{Burst: 1},
+		}
+		cfg.HistorySize = 0
+	})
+	return s, NewChatServiceClient(dialTestServer(b, s))
+}
+
+func heapInUse() float64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return float64(m.HeapInuse)
+}
+
+// benchmarkFanOut subscribes subscribers clients spread over rooms rooms, sends b.N messages
+// round-robin over the rooms and waits for their deliveries. Besides the time per message
+// sent, it reports the delivery latency percentiles, the deliveries that never arrived, and
+// the goroutines and heap each subscriber costs. Subscribers that fall a whole queue behind
+// are disconnected, and their missing deliveries count as dropped.
+func benchmarkFanOut(b *testing.B, rooms, subscribers int) {
+	s, chat := newBenchServer(b)
+	goroutines, heap := runtime.NumGoroutine(), heapInUse()
+
+	var mu sync.Mutex
+	var latencies []time.Duration
+	var received atomic.Int64
+	members := make([]int, rooms)
+	for i := 0; i < subscribers; i++ {
+		room := i % rooms
+		members[room]++
+		stream := subscribe(b, chat, "bench-"+strconv.Itoa(room), "sub-"+strconv.Itoa(i))
+		go func() {
+			for {
+				msg, err := stream.Recv()
+				if err != nil {
+					return
+				}
+				sent, err := strconv.ParseInt(msg.GetMetadata()[benchSentAtKey], 10, 64)
+				if err != nil {
+					continue
+				}
+				latency := time.Since(time.Unix(0, sent))
+				mu.Lock()
+				latencies = append(latencies, latency)
+				mu.Unlock()
+				received.Add(1)
+			}
+		}()
+	}
+	waitFor(b, "the subscribers to join", func() bool {
+		for room, n := range members {
+			if connected(s, "bench-"+strconv.Itoa(room)) != n {
+				return false
+			}
+		}
+		return true
+	})
+	goroutines, heap = runtime.NumGoroutine()-goroutines, heapInUse()-heap
+
+	payload := make([]byte, 64)
+	expected := int64(0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		room := i % rooms
+		_, err := chat.SendMessage(context.Background(), &ChatMessage{
+			Sender:    "sender",
+			Recipient: "bench-" + strconv.Itoa(room),
+			Content:   payload,
+			Timestamp: uint64(time.Now().Unix()),
+			Metadata:  map[string]string{benchSentAtKey: strconv.FormatInt(time.Now().UnixNano(), 10)},
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		expected += int64(members[room])
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for received.Load() < expected && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	b.StopTimer()
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	if len(latencies) > 0 {
+		for _, p := range []float64{0.5, 0.99} {
+			b.ReportMetric(float64(latencies[int(float64(len(latencies)-1)*p)]), fmt.Sprintf("p%g-ns", p*100))
+		}
+	}
+	b.ReportMetric(float64(expected-received.Load()), "dropped")
+	b.ReportMetric(float64(goroutines)/float64(subscribers), "goroutines/sub")
+	b.ReportMetric(heap/float64(subscribers), "heap-B/sub")
+}
+
+func BenchmarkFanOut(b *testing.B) {
+	for _, size := range []struct{ rooms, subscribers int }{
+		{1, 1},
+		{1, 100},
+		{10, 100},
+		{10, 1000},
+	} {
+		b.Run(fmt.Sprintf("rooms=%d/subscribers=%d", size.rooms, size.subscribers), func(b *testing.B) {
+			benchmarkFanOut(b, size.rooms, size.subscribers)
+		})
+	}
+}
+
+// BenchmarkAdmitMessage measures the checks every message goes through before it is routed.
+func BenchmarkAdmitMessage(b *testing.B) {
+	s, _ := newBenchServer(b)
+	s.importRoom(&RoomState{RoomName: "room"})
+	msg := &ChatMessage{Sender: "sender", Recipient: "room", Content: make([]byte, 64)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg.Timestamp = uint64(time.Now().Unix())
+		if err := s.admitMessage(context.Background(), msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
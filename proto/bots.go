@@ -0,0 +1,132 @@
+package proto
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Bots lets out-of-process bots handle slash commands. Commands are registered on the node the
+// bot is connected to, and invoked for the rooms owned by that node. Connect requires the admin
+// token.
+type Bots struct {
+	UnimplementedBotServiceServer
+	server *Server
+}
+
+func NewBots(server *Server) *Bots {
+	return &Bots{server: server}
+}
+
+// remoteBot handles commands by sending their invocations on the bot's stream and waiting for
+// the reply with the same invocation ID.
+type remoteBot struct {
+	name   string
+	stream BotService_ConnectServer
+	sendMu sync.Mutex
+	done   chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]chan *BotReply
+}
+
+func (b *remoteBot) HandleCommand(ctx context.Context, invocation *CommandInvocation) (string, error) {
+	replies := make(chan *BotReply, 1)
+	b.mu.Lock()
+	b.pending[invocation.GetInvocationID()] = replies
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.pending, invocation.GetInvocationID())
+		b.mu.Unlock()
+	}()
+	b.sendMu.Lock()
+	err := b.stream.Send(invocation)
+	b.sendMu.Unlock()
+	if err != nil {
+		return "", status.Errorf(codes.Unavailable, "%s is unreachable", b.name)
+	}
+	select {
+	case reply := <-replies:
+		if reply.GetError() != "" {
+			return "", errors.New(reply.GetError())
+		}
+		return reply.GetContent(), nil
+	case <-b.done:
+		return "", status.Errorf(codes.Unavailable, "%s disconnected", b.name)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// reply hands a reply to the invocation waiting for it. Replies to invocations that timed out
+// are dropped.
+func (b *remoteBot) reply(reply *BotReply) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if replies, ok := b.pending[reply.GetInvocationID()]; ok {
+		select {
+		case replies <- reply:
+		default:
+		}
+	}
+}
+
+func (bots *Bots) Connect(stream BotService_ConnectServer) error {
+	s := bots.server
+	if err := s.requireAdmin(stream.Context()); err != nil {
+		return err
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	registration := first.GetRegister()
+	if registration == nil || registration.GetBotName() == "" || len(registration.GetCommands()) == 0 {
+		return status.Error(codes.InvalidArgument, "the first message must register a bot name and at least one command")
+	}
+	bot := &remoteBot{
+		name:    registration.GetBotName(),
+		stream:  stream,
+		done:    make(chan struct{}),
+		pending: map[string]chan *BotReply{},
+	}
+	defer close(bot.done)
+	defer s.unregisterBot(bot)
+	for _, spec := range registration.GetCommands() {
+		if err := s.RegisterCommand(bot.name, spec, bot); err != nil {
+			return err
+		}
+	}
+	s.logger.Load().Info("bot connected", "bot", bot.name, "commands", len(registration.GetCommands()))
+	defer s.logger.Load().Info("bot disconnected", "bot", bot.name)
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		reply := msg.GetReply()
+		if reply == nil {
+			return status.Error(codes.InvalidArgument, "bots register once, then only send replies")
+		}
+		bot.reply(reply)
+	}
+}
+
+// unregisterBot removes the commands of bot, leaving any registered since by another bot.
+func (s *Server) unregisterBot(bot *remoteBot) {
+	s.commands.mu.Lock()
+	defer s.commands.mu.Unlock()
+	for name, cmd := range s.commands.commands {
+		if handler, ok := cmd.handler.(*remoteBot); ok && handler == bot {
+			delete(s.commands.commands, name)
+		}
+	}
+}
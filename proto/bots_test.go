@@ -0,0 +1,127 @@
+package proto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newBotServer serves the chat and bot services of a server whose admin token is "admin".
+func newBotServer(t *testing.T) (*Server, ChatServiceClient, BotServiceClient) {
+	t.Helper()
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AdminToken = "admin"
+		cfg.CommandTimeout = 100 * time.Millisecond
+	})
+	conn := dialTestServer(t, s, func(server *grpc.Server) { RegisterBotServiceServer(server, NewBots(s)) })
+	return s, NewChatServiceClient(conn), NewBotServiceClient(conn)
+}
+
+// connectBot registers name with commands, and returns its stream and a function ending it.
+func connectBot(t *testing.T, bots BotServiceClient, name string, commands ...string) (BotService_ConnectClient, context.CancelFunc) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(context.Background(), "admin-token", "admin"))
+	t.Cleanup(cancel)
+	stream, err := bots.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registration := &BotRegistration{BotName: name}
+	for _, command := range commands {
+		registration.Commands = append(registration.Commands, &CommandSpec{Name: command})
+	}
+	if err := stream.Send(&BotMessage{Body: &BotMessage_Register{Register: registration}}); err != nil {
+		t.Fatal(err)
+	}
+	return stream, cancel
+}
+
+// handledBy returns the bot handling /name, or "" if there is none.
+func handledBy(s *Server, name string) string {
+	if cmd := s.lookupCommand(name); cmd != nil {
+		return cmd.bot
+	}
+	return ""
+}
+
+func TestBotConnectRequiresAdminAndRegistration(t *testing.T) {
+	_, _, bots := newBotServer(t)
+	stream, err := bots.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Connect without the admin token: %v, want Unauthenticated", err)
+	}
+
+	stream, _ = connectBot(t, bots, "echo-bot")
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("registering no commands: %v, want InvalidArgument", err)
+	}
+}
+
+func TestBotHandlesItsCommands(t *testing.T) {
+	s, chat, bots := newBotServer(t)
+	bot, _ := connectBot(t, bots, "echo-bot", "echo", "oops", "slow")
+	waitFor(t, "the commands to be registered", func() bool { return handledBy(s, "slow") == "echo-bot" })
+	go func() {
+		for {
+			invocation, err := bot.Recv()
+			if err != nil {
+				return
+			}
+			reply := &BotReply{InvocationID: invocation.GetInvocationID()}
+			switch invocation.GetCommand() {
+			case "echo":
+				reply.Content = invocation.GetSender() + " said " + invocation.GetRawArgs()
+			case "oops":
+				reply.Error = "something went wrong"
+			case "slow":
+				continue
+			}
+			if err := bot.Send(&BotMessage{Body: &BotMessage_Reply{Reply: reply}}); err != nil {
+				return
+			}
+		}
+	}()
+	alice := subscribe(t, chat, "room", "alice")
+	waitFor(t, "the room to be created", func() bool { return connected(s, "room") == 1 })
+
+	send(t, chat, "alice", "room", "/echo hello")
+	if got := receive(t, alice, 1)[0]; got.GetSender() != "echo-bot" || string(got.GetContent()) != "alice said hello" {
+		t.Errorf("%s posted %q, want echo-bot posting the reply", got.GetSender(), got.GetContent())
+	}
+	for command, want := range map[string]codes.Code{"/oops": codes.InvalidArgument, "/slow": codes.DeadlineExceeded} {
+		_, err := chat.SendMessage(context.Background(), &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte(command), Timestamp: uint64(time.Now().Unix())})
+		if status.Code(err) != want {
+			t.Errorf("%s: %v, want %s", command, err, want)
+		}
+	}
+}
+
+func TestBotCommandsEndWithItsStream(t *testing.T) {
+	s, _, bots := newBotServer(t)
+	first, disconnect := connectBot(t, bots, "first", "echo")
+	waitFor(t, "the first bot to register", func() bool { return handledBy(s, "echo") == "first" })
+
+	second, _ := connectBot(t, bots, "second", "echo")
+	if _, err := second.Recv(); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("registering a taken command: %v, want AlreadyExists", err)
+	}
+	if got := handledBy(s, "echo"); got != "first" {
+		t.Fatalf("/echo is handled by %q after the conflict, want first", got)
+	}
+
+	disconnect()
+	if _, err := first.Recv(); status.Code(err) != codes.Canceled {
+		t.Errorf("the first bot's stream ended with %v", err)
+	}
+	waitFor(t, "the first bot's commands to be removed", func() bool { return handledBy(s, "echo") == "" })
+	connectBot(t, bots, "third", "echo")
+	waitFor(t, "another bot to take /echo", func() bool { return handledBy(s, "echo") == "third" })
+}
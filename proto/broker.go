@@ -0,0 +1,101 @@
+package proto
+
+import (
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+// BroadcastSubject is the subject every node publishes room broadcasts to and subscribes from.
+const BroadcastSubject = "chat.broadcast"
+
+// Broker moves room broadcasts between the nodes of a cluster. Every message published to a
+// subject is handed to every subscriber of that subject, including the publishing node.
+type Broker interface {
+	Publish(subject string, data []byte) error
+	Subscribe(subject string, handler func(data []byte)) (unsubscribe func(), err error)
+	Close() error
+}
+
+// InProcessBroker delivers messages synchronously to subscribers in the same process.
+// Sharing one instance between several servers makes them behave like a cluster.
+type InProcessBroker struct {
+	mu       sync.RWMutex
+	nextID   int
+	handlers map[string]map[int]func([]byte)
+}
+
+func NewInProcessBroker() *InProcessBroker {
+	return &InProcessBroker{handlers: map[string]map[int]func([]byte){}}
+}
+
+func (b *InProcessBroker) Publish(subject string, data []byte) error {
+	b.mu.RLock()
+	handlers := make([]func([]byte), 0, len(b.handlers[subject]))
+	for _, h := range b.handlers[subject] {
+		handlers = append(handlers, h)
+	}
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		h(data)
+	}
+	return nil
+}
+
+func (b *InProcessBroker) Subscribe(subject string, handler func([]byte)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.handlers[subject] == nil {
+		b.handlers[subject] = map[int]func([]byte){}
+	}
+	id := b.nextID
+	b.nextID++
+	b.handlers[subject][id] = handler
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers[subject], id)
+	}, nil
+}
+
+func (b *InProcessBroker) Close() error {
+	return nil
+}
+
+// NATSBroker fans messages out through a NATS server.
+type NATSBroker struct {
+	conn *nats.Conn
+}
+
+func NewNATSBroker(url string) (*NATSBroker, error) {
+	conn, err := nats.Connect(url, nats.Name("grpc-chat"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	return &NATSBroker{conn: conn}, nil
+}
+
+func (b *NATSBroker) Publish(subject string, data []byte) error {
+	return b.conn.Publish(subject, data)
+}
+
+// Subscribe returns once the NATS server has the subscription, so that nothing published
+// afterwards by another node is missed.
+func (b *NATSBroker) Subscribe(subject string, handler func([]byte)) (func(), error) {
+	sub, err := b.conn.Subscribe(subject, func(msg *nats.Msg) {
+		handler(msg.Data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := b.conn.Flush(); err != nil {
+		_ = sub.Unsubscribe()
+		return nil, err
+	}
+	return func() { _ = sub.Unsubscribe() }, nil
+}
+
+func (b *NATSBroker) Close() error {
+	b.conn.Close()
+	return nil
+}
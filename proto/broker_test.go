@@ -0,0 +1,132 @@
+package proto
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+)
+
+// runNATS starts a NATS server on a random local port for the duration of the test.
+func runNATS(t *testing.T) string {
+	t.Helper()
+	ns, err := natsserver.NewServer(&natsserver.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+	t.Cleanup(ns.Shutdown)
+	return ns.ClientURL()
+}
+
+func newNATSBroker(t *testing.T, url string) *NATSBroker {
+	t.Helper()
+	b, err := NewNATSBroker(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+// collector gathers what a broker subscription receives.
+type collector struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (c *collector) handle(data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, string(data))
+}
+
+func (c *collector) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.messages)
+}
+
+func testBroker(t *testing.T, publisher, other Broker) {
+	var got1, got2 collector
+	unsubscribe1, err := publisher.Subscribe("subject", got1.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsubscribe2, err := other.Subscribe("subject", got2.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Subscribe("elsewhere", func([]byte) { t.Error("received a message for another subject") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := publisher.Publish("subject", []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "both subscribers to receive the message", func() bool { return got1.count() == 1 && got2.count() == 1 })
+
+	unsubscribe2()
+	if err := publisher.Publish("subject", []byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the remaining subscriber to receive the message", func() bool { return got1.count() == 2 })
+	unsubscribe1()
+	time.Sleep(50 * time.Millisecond)
+	if got2.count() != 1 {
+		t.Errorf("received %d messages after unsubscribing, want 1", got2.count())
+	}
+}
+
+func TestInProcessBroker(t *testing.T) {
+	b := NewInProcessBroker()
+	testBroker(t, b, b)
+}
+
+func TestNATSBroker(t *testing.T) {
+	url := runNATS(t)
+	testBroker(t, newNATSBroker(t, url), newNATSBroker(t, url))
+}
+
+// TestRoomAcrossNodesOverNATS runs a room on two nodes that only share a NATS server, and
+// checks that messages sent to either node reach the subscribers of both, in the same order.
+func TestRoomAcrossNodesOverNATS(t *testing.T) {
+	url := runNATS(t)
+	var nodes []*Server
+	var chats []ChatServiceClient
+	for _, id := range []string{"node-a", "node-b"} {
+		s := newTestServer(t, func(cfg *Config) { cfg.NodeID = id })
+		if err := s.SetBroker(newNATSBroker(t, url)); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, s)
+		chats = append(chats, NewChatServiceClient(dialTestServer(t, s)))
+	}
+	alice := subscribe(t, chats[0], "room", "alice")
+	bob := subscribe(t, chats[1], "room", "bob")
+	waitFor(t, "both subscribers", func() bool { return connected(nodes[0], "room") == 1 && connected(nodes[1], "room") == 1 })
+
+	send(t, chats[0], "alice", "room", "from a")
+	send(t, chats[1], "bob", "room", "from b")
+	fromAlice, fromBob := receive(t, alice, 2), receive(t, bob, 2)
+	for i := range fromAlice {
+		if string(fromAlice[i].GetContent()) != string(fromBob[i].GetContent()) {
+			t.Fatalf("alice received %q and %q, bob %q and %q", fromAlice[0].GetContent(), fromAlice[1].GetContent(),
+				fromBob[0].GetContent(), fromBob[1].GetContent())
+		}
+	}
+	if contents := string(fromAlice[0].GetContent()) + "," + string(fromAlice[1].GetContent()); contents != "from a,from b" && contents != "from b,from a" {
+		t.Errorf("received %s", contents)
+	}
+	// Each node numbers the messages in the order it delivered them.
+	for node, received := range map[string][]*ChatMessage{"node-a": fromAlice, "node-b": fromBob} {
+		for i, msg := range received {
+			if msg.GetSequencer() != node || (i > 0 && msg.GetSequence() <= received[i-1].GetSequence()) {
+				t.Errorf("%s sent sequence %d by %q after %d", node, msg.GetSequence(), msg.GetSequencer(), received[max(i-1, 0)].GetSequence())
+			}
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	forwardedByKey  = "x-forwarded-by"
+	clusterTokenKey = "cluster-token"
+)
+
+type ClusterConfig struct {
+	// Address is the gRPC address other nodes reach this node at. Clustering is enabled when it is set.
+	Address string `yaml:"advertise_addr" toml:"advertise_addr"`
+	// Seeds are addresses of nodes contacted until the first peer is known.
+	Seeds []string `yaml:"seeds" toml:"seeds"`
+	// Secret is shared by the nodes of the cluster and sent in the cluster-token metadata of
+	// the calls between them. The cluster RPCs share the public port, so calls without it are
+	// refused, and calls claiming to be forwarded by another node without it are not trusted.
+	Secret         string        `yaml:"secret" toml:"secret"`
+	GossipInterval time.Duration `yaml:"gossip_interval" toml:"gossip_interval"`
+	FailureTimeout time.Duration `yaml:"failure_timeout" toml:"failure_timeout"`
+	// DialOptions are added to every connection to another node, e.g. to dial over bufconn.
+	DialOptions []grpc.DialOption `yaml:"-" toml:"-"`
+}
+
+type memberState struct {
+	member  *Member
+	updated time.Time
+}
+
+// Cluster gossips membership with the other nodes and assigns every room to an owner node on
+// a consistent hash ring. Calls for rooms owned by another node are forwarded to that node.
+type Cluster struct {
+	UnimplementedClusterServiceServer
+	server  *Server
+	config  ClusterConfig
+	mu      sync.Mutex
+	self    *Member
+	members map[string]*memberState
+	ring    *HashRing
+	conns   map[string]*grpc.ClientConn
+	stop    chan struct{}
+	// rebalanceMu runs one rebalance at a time. Membership changes ask for one on rebalances,
+	// which coalesces the requests made while a rebalance is running.
+	rebalanceMu sync.Mutex
+	rebalances  chan struct{}
+}
+
+// NewCluster attaches a cluster to server. The returned value must be registered as the
+// ClusterService of the node's gRPC server and started with Start.
+func NewCluster(server *Server, cfg ClusterConfig) *Cluster {
+	c := &Cluster{
+		server: server,
+		config: cfg,
+		// Starting the heartbeat at the current time lets a restarted node overtake
+		// the stale entry its previous incarnation left in the other nodes' views.
+		self:       &Member{NodeID: server.nodeID, Address: cfg.Address, Heartbeat: uint64(time.Now().UnixNano())},
+		members:    map[string]*memberState{},
+		conns:      map[string]*grpc.ClientConn{},
+		stop:       make(chan struct{}),
+		rebalances: make(chan struct{}, 1),
+	}
+	c.ring = NewHashRing(100, c.self.NodeID)
+	server.cluster = c
+	return c
+}
+
+func (c *Cluster) Start() {
+	go func() {
+		ticker := time.NewTicker(c.config.GossipInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				c.gossipRound()
+			}
+		}
+	}()
+	go func() {
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-c.rebalances:
+				c.rebalance()
+			}
+		}
+	}()
+}
+
+// requestRebalance asks for a rebalance once the one running, if any, is done.
+func (c *Cluster) requestRebalance() {
+	select {
+	case c.rebalances <- struct{}{}:
+	default:
+	}
+}
+
+// authenticate checks the cluster token of a call from another node.
+func (c *Cluster) authenticate(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if !c.trusted(md) {
+		return status.Error(codes.Unauthenticated, "missing or invalid cluster-token")
+	}
+	return nil
+}
+
+func (c *Cluster) trusted(md metadata.MD) bool {
+	for _, token := range md.Get(clusterTokenKey) {
+		if c.config.Secret != "" && subtle.ConstantTimeCompare([]byte(token), []byte(c.config.Secret)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// outgoing adds the cluster token to a call to another node.
+func (c *Cluster) outgoing(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, clusterTokenKey, c.config.Secret)
+}
+
+// Leave hands every local room to its next owner and tells the other nodes this node is gone.
+func (c *Cluster) Leave() {
+	close(c.stop)
+	c.mu.Lock()
+	c.self.Left = true
+	c.self.Heartbeat++
+	c.rebuildRing()
+	view := c.view()
+	var addresses []string
+	for _, m := range c.members {
+		if !m.member.GetLeft() {
+			addresses = append(addresses, m.member.GetAddress())
+		}
+	}
+	c.mu.Unlock()
+	c.rebalance()
+	for _, address := range addresses {
+		c.sendGossip(address, view)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conn := range c.conns {
+		_ = conn.Close()
+	}
+}
+
+func (c *Cluster) gossipRound() {
+	c.mu.Lock()
+	c.self.Heartbeat++
+	changed := false
+	for id, m := range c.members {
+		if time.Since(m.updated) > c.config.FailureTimeout {
+			delete(c.members, id)
+			changed = !m.member.GetLeft() || changed
+		}
+	}
+	var alive []string
+	for _, m := range c.members {
+		if !m.member.GetLeft() {
+			alive = append(alive, m.member.GetAddress())
+		}
+	}
+	targets := c.config.Seeds
+	if len(alive) > 0 {
+		targets = []string{alive[rand.Intn(len(alive))]}
+	}
+	if changed {
+		c.rebuildRing()
+	}
+	view := c.view()
+	c.mu.Unlock()
+	if changed {
+		c.requestRebalance()
+	}
+	for _, address := range targets {
+		if address != c.config.Address {
+			c.sendGossip(address, view)
+		}
+	}
+}
+
+func (c *Cluster) sendGossip(address string, view *GossipMessage) {
+	conn, err := c.dial(address)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.GossipInterval)
+	defer cancel()
+	response, err := NewClusterServiceClient(conn).Gossip(c.outgoing(ctx), view)
+	if err != nil {
+		return
+	}
+	c.merge(response.GetMembers())
+}
+
+func (c *Cluster) Gossip(ctx context.Context, request *GossipMessage) (*GossipMessage, error) {
+	if err := c.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	c.merge(request.GetMembers())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.view(), nil
+}
+
+// merge folds another node's view into ours. Entries with a higher heartbeat win.
+func (c *Cluster) merge(members []*Member) {
+	c.mu.Lock()
+	changed := false
+	for _, m := range members {
+		if m.GetNodeID() == c.self.GetNodeID() {
+			continue
+		}
+		existing, known := c.members[m.GetNodeID()]
+		if known && existing.member.GetHeartbeat() >= m.GetHeartbeat() {
+			continue
+		}
+		if !known && m.GetLeft() {
+			continue
+		}
+		if !known || existing.member.GetLeft() != m.GetLeft() {
+			changed = true
+		}
+		c.members[m.GetNodeID()] = &memberState{
+			member:  &Member{NodeID: m.GetNodeID(), Address: m.GetAddress(), Heartbeat: m.GetHeartbeat(), Left: m.GetLeft()},
+			updated: time.Now(),
+		}
+	}
+	if changed {
+		c.rebuildRing()
+	}
+	c.mu.Unlock()
+	if changed {
+		c.requestRebalance()
+	}
+}
+
+// view returns this node's membership list. The caller must hold c.mu.
+func (c *Cluster) view() *GossipMessage {
+	view := &GossipMessage{Members: []*Member{
+		{NodeID: c.self.GetNodeID(), Address: c.self.GetAddress(), Heartbeat: c.self.GetHeartbeat(), Left: c.self.GetLeft()},
+	}}
+	for _, m := range c.members {
+		view.Members = append(view.Members, &Member{
+			NodeID:    m.member.GetNodeID(),
+			Address:   m.member.GetAddress(),
+			Heartbeat: m.member.GetHeartbeat(),
+			Left:      m.member.GetLeft(),
+		})
+	}
+	return view
+}
+
+// rebuildRing places every live node on the ring. The caller must hold c.mu.
+func (c *Cluster) rebuildRing() {
+	var ids []string
+	if !c.self.GetLeft() {
+		ids = append(ids, c.self.GetNodeID())
+	}
+	for id, m := range c.members {
+		if !m.member.GetLeft() {
+			ids = append(ids, id)
+		}
+	}
+	c.ring = NewHashRing(100, ids...)
+}
+
+// Owner returns the ID of the node that owns roomID.
+func (c *Cluster) Owner(roomID string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ring.Get(roomID)
+}
+
+// remoteOwner returns the address of the node owning roomID, unless that is this node.
+func (c *Cluster) remoteOwner(roomID string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	owner := c.ring.Get(roomID)
+	if owner == "" || owner == c.self.GetNodeID() {
+		return "", false
+	}
+	m, exists := c.members[owner]
+	if !exists {
+		return "", false
+	}
+	return m.member.GetAddress(), true
+}
+
+func (c *Cluster) dial(address string) (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if conn, exists := c.conns[address]; exists {
+		return conn, nil
+	}
+	conn, err := grpc.Dial(address, append([]grpc.DialOption{grpc.WithInsecure()}, c.config.DialOptions...)...)
+	if err != nil {
+		return nil, err
+	}
+	c.conns[address] = conn
+	return conn, nil
+}
+
+// rebalance hands every local room that now belongs to another node over to that node.
+// Local subscribers of a handed-off room are disconnected so that they reconnect through the new owner.
+func (c *Cluster) rebalance() {
+	c.rebalanceMu.Lock()
+	defer c.rebalanceMu.Unlock()
+	for _, roomID := range c.server.roomNames() {
+		address, remote := c.remoteOwner(roomID)
+		if !remote {
+			continue
+		}
+		room := c.server.getRoom(roomID)
+		conn, err := c.dial(address)
+		if room == nil || err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), c.config.FailureTimeout)
+		_, err = NewClusterServiceClient(conn).HandoffRoom(c.outgoing(ctx), room.exportState())
+		cancel()
+		if err != nil {
+			continue
+		}
+		c.server.logger.Load().Info("room handed off", "room", roomID, "address", address)
+		c.server.evictRoom(roomID, status.Error(codes.Unavailable, "room moved to another node, reconnect"))
+	}
+}
+
+func (c *Cluster) HandoffRoom(ctx context.Context, state *RoomState) (*Empty, error) {
+	if err := c.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	if err := c.server.awaitReady(ctx); err != nil {
+		return nil, err
+	}
+	c.server.importRoom(state)
+	return &Empty{}, nil
+}
+
+// forwardTarget returns a client for the node owning roomID when that is another node and the
+// call was not already forwarded to us, along with the context to forward the call with.
+func (s *Server) forwardTarget(ctx context.Context, roomID string) (ChatServiceClient, context.Context, bool) {
+	if s.cluster == nil {
+		return nil, nil, false
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md.Get(forwardedByKey)) > 0 && s.cluster.trusted(md) {
+		return nil, nil, false
+	}
+	address, remote := s.cluster.remoteOwner(roomID)
+	if !remote {
+		return nil, nil, false
+	}
+	conn, err := s.cluster.dial(address)
+	if err != nil {
+		return nil, nil, false
+	}
+	md = md.Copy()
+	md.Set(forwardedByKey, s.nodeID)
+	md.Set(clusterTokenKey, s.cluster.config.Secret)
+	return NewChatServiceClient(conn), metadata.NewOutgoingContext(ctx, md), true
+}
+
+// forwardSubscribe relays a subscription from the owning node to the local client stream.
+func forwardSubscribe(client ChatServiceClient, ctx context.Context, request *RoomRequest, stream ChatService_SubscribeServer) error {
+	upstream, err := client.Subscribe(ctx, request)
+	if err != nil {
+		return err
+	}
+	for {
+		msg, err := upstream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func unixOrZero(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.Unix())
+}
+
+func timeOrZero(unix uint64) time.Time {
+	if unix == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(unix), 0)
+}
+
+func (r *Room) exportState() *RoomState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state := &RoomState{
+		RoomName:        r.name,
+		Owner:           r.owner,
+		Bans:            map[string]uint64{},
+		Mutes:           map[string]uint64{},
+		SlowModeSeconds: uint64(r.slowMode / time.Second),
+		Topic:           r.topic,
+		Encrypted:       r.encrypted,
+		History:         append([]*ChatMessage{}, r.history...),
+		Cursors:         map[string]uint64{},
+		LastSequence:    r.sequence,
+	}
+	for id, seq := range r.cursors {
+		state.Cursors[id] = seq
+	}
+	for id, until := range r.bans {
+		state.Bans[id] = unixOrZero(until)
+	}
+	for id, until := range r.mutes {
+		state.Mutes[id] = unixOrZero(until)
+	}
+	return state
+}
+
+// importRoom creates a room from state handed over by another node, or merges the state into
+// the room if it already exists here. The room goes on numbering its messages after the last
+// one of the state, unless it already has messages of its own here, which it keeps along with
+// their cursors.
+func (s *Server) importRoom(state *RoomState) {
+	s.mu.Lock()
+	room, exists := s.roomsMap[state.GetRoomName()]
+	if !exists {
+		room = s.newRoom(state.GetRoomName())
+		s.roomsMap[state.GetRoomName()] = room
+	}
+	s.mu.Unlock()
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if room.owner == "" {
+		room.owner = state.GetOwner()
+	}
+	for id, until := range state.GetBans() {
+		room.bans[id] = timeOrZero(until)
+	}
+	for id, until := range state.GetMutes() {
+		room.mutes[id] = timeOrZero(until)
+	}
+	if room.slowMode == 0 {
+		room.slowMode = time.Duration(state.GetSlowModeSeconds()) * time.Second
+	}
+	if room.topic == "" {
+		room.topic = state.GetTopic()
+	}
+	// A room never stops being encrypted, or its history would be sent in the clear.
+	room.encrypted = room.encrypted || state.GetEncrypted()
+	if room.sequence > 0 {
+		return
+	}
+	room.history = state.GetHistory()
+	if room.historySize > 0 && len(room.history) > room.historySize {
+		room.history = room.history[len(room.history)-room.historySize:]
+	}
+	for id, seq := range state.GetCursors() {
+		room.cursors[id] = seq
+	}
+	room.sequence = state.GetLastSequence()
+}
+
+// evictRoom removes the room from this node and ends every local subscription to it with err.
+func (s *Server) evictRoom(roomID string, err error) {
+	s.mu.Lock()
+	room, exists := s.roomsMap[roomID]
+	delete(s.roomsMap, roomID)
+	s.mu.Unlock()
+	if !exists {
+		return
+	}
+	room.mu.Lock()
+	connections := room.connections
+	room.connections = []*ClientConnection{}
+	room.mu.Unlock()
+	for _, conn := range connections {
+		conn.disconnect(err)
+	}
+}
+
+func (s *Server) roomNames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.roomsMap))
+	for name := range s.roomsMap {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,206 @@
+package proto
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const testClusterSecret = "cluster secret"
+
+type testNode struct {
+	server  *Server
+	cluster *Cluster
+	chat    ChatServiceClient
+	conn    *grpc.ClientConn
+	left    bool
+}
+
+// newTestCluster starts a node per ID over bufconn, each reachable at its ID, and waits until
+// they all know each other.
+func newTestCluster(t *testing.T, ids ...string) map[string]*testNode {
+	t.Helper()
+	listeners := map[string]*bufconn.Listener{}
+	for _, id := range ids {
+		listeners[id] = bufconn.Listen(1 << 20)
+	}
+	dialer := grpc.WithContextDialer(func(_ context.Context, address string) (net.Conn, error) {
+		lis, exists := listeners[address]
+		if !exists {
+			return nil, fmt.Errorf("no node at %s", address)
+		}
+		return lis.Dial()
+	})
+	nodes := map[string]*testNode{}
+	for _, id := range ids {
+		clusterConfig := ClusterConfig{
+			Address:        id,
+			Seeds:          []string{ids[0]},
+			Secret:         testClusterSecret,
+			GossipInterval: 20 * time.Millisecond,
+			FailureTimeout: time.Second,
+			DialOptions:    []grpc.DialOption{dialer},
+		}
+		s := newTestServer(t, func(cfg *Config) {
+			cfg.NodeID = id
+			cfg.AdminToken = "admin"
+			cfg.Cluster = clusterConfig
+		})
+		node := &testNode{server: s, cluster: NewCluster(s, clusterConfig)}
+		server := grpc.NewServer()
+		RegisterChatServiceServer(server, s)
+		RegisterClusterServiceServer(server, node.cluster)
+		go server.Serve(listeners[id])
+		conn, err := grpc.Dial(id, grpc.WithInsecure(), dialer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.conn, node.chat = conn, NewChatServiceClient(conn)
+		node.cluster.Start()
+		nodes[id] = node
+		t.Cleanup(func() {
+			if !node.left {
+				node.cluster.Leave()
+			}
+			conn.Close()
+			server.Stop()
+		})
+	}
+	waitFor(t, "the nodes to know each other", func() bool {
+		for _, node := range nodes {
+			node.cluster.mu.Lock()
+			known := len(node.cluster.members)
+			node.cluster.mu.Unlock()
+			if known != len(ids)-1 {
+				return false
+			}
+		}
+		return true
+	})
+	return nodes
+}
+
+// roomOwnedBy finds a room name that the cluster assigns to owner.
+func roomOwnedBy(t *testing.T, nodes map[string]*testNode, owner string) string {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		room := fmt.Sprintf("room-%d", i)
+		if nodes[owner].cluster.Owner(room) == owner {
+			return room
+		}
+	}
+	t.Fatalf("no room is owned by %s", owner)
+	return ""
+}
+
+func TestClusterAgreesOnOwners(t *testing.T) {
+	nodes := newTestCluster(t, "node-a", "node-b", "node-c")
+	owners := map[string]int{}
+	for i := 0; i < 100; i++ {
+		room := fmt.Sprintf("room-%d", i)
+		owner := nodes["node-a"].cluster.Owner(room)
+		for id, node := range nodes {
+			if got := node.cluster.Owner(room); got != owner {
+				t.Fatalf("%s thinks %s owns %s, node-a thinks %s", id, got, room, owner)
+			}
+		}
+		owners[owner]++
+	}
+	if len(owners) != 3 {
+		t.Errorf("rooms are spread over %v", owners)
+	}
+}
+
+func TestClusterForwardsCallsToTheOwner(t *testing.T) {
+	nodes := newTestCluster(t, "node-a", "node-b", "node-c")
+	room := roomOwnedBy(t, nodes, "node-b")
+	alice := subscribe(t, nodes["node-a"].chat, room, "alice")
+	waitFor(t, "the subscription to reach the owner", func() bool { return connected(nodes["node-b"].server, room) == 1 })
+	if nodes["node-a"].server.getRoom(room) != nil {
+		t.Errorf("the room was created on node-a, which doesn't own it")
+	}
+	send(t, nodes["node-c"].chat, "bob", room, "hello")
+	if got := receive(t, alice, 1)[0]; string(got.GetContent()) != "hello" {
+		t.Errorf("received %q", got.GetContent())
+	}
+}
+
+func TestClusterHandsRoomsOffWhenANodeLeaves(t *testing.T) {
+	nodes := newTestCluster(t, "node-a", "node-b", "node-c")
+	room := roomOwnedBy(t, nodes, "node-b")
+	alice := subscribe(t, nodes["node-b"].chat, room, "alice")
+	waitFor(t, "the room to be created", func() bool { return connected(nodes["node-b"].server, room) == 1 })
+	send(t, nodes["node-b"].chat, "alice", room, "hello")
+	delivered := receive(t, alice, 1)[0].GetSequence()
+	admin := metadata.NewIncomingContext(context.Background(), metadata.Pairs("admin-token", "admin"))
+	if _, err := nodes["node-b"].server.BanUser(admin, &ModerationRequest{RoomName: room, Target: "mallory"}); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes["node-b"].left = true
+	nodes["node-b"].cluster.Leave()
+	next := nodes["node-a"].cluster.Owner(room)
+	if next == "node-b" || next != nodes["node-c"].cluster.Owner(room) {
+		t.Fatalf("node-a gives %s to %s, node-c to %s", room, next, nodes["node-c"].cluster.Owner(room))
+	}
+	waitFor(t, "the room to move", func() bool { return nodes[next].server.getRoom(room) != nil })
+	state := nodes[next].server.getRoom(room).exportState()
+	if state.GetOwner() != "alice" {
+		t.Errorf("owner = %q, want alice", state.GetOwner())
+	}
+	if _, banned := state.GetBans()["mallory"]; !banned {
+		t.Errorf("the ban did not move with the room")
+	}
+	if len(state.GetHistory()) == 0 || string(state.GetHistory()[len(state.GetHistory())-1].GetContent()) != "hello" {
+		t.Errorf("the history did not move with the room: %v", state.GetHistory())
+	}
+	if state.GetCursors()["alice"] < delivered || state.GetLastSequence() < delivered {
+		t.Errorf("alice's cursor is %d and the last sequence %d, want at least %d",
+			state.GetCursors()["alice"], state.GetLastSequence(), delivered)
+	}
+	if nodes["node-b"].server.getRoom(room) != nil {
+		t.Errorf("node-b kept the room")
+	}
+}
+
+func TestClusterRefusesCallsWithoutTheSecret(t *testing.T) {
+	nodes := newTestCluster(t, "node-a", "node-b")
+	client := NewClusterServiceClient(nodes["node-a"].conn)
+	for name, ctx := range map[string]context.Context{
+		"no token":    context.Background(),
+		"wrong token": metadata.AppendToOutgoingContext(context.Background(), clusterTokenKey, "guess"),
+	} {
+		_, err := client.Gossip(ctx, &GossipMessage{Members: []*Member{{NodeID: "evil", Address: "evil:1", Heartbeat: 1}}})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Gossip with %s: %v, want Unauthenticated", name, err)
+		}
+		_, err = client.HandoffRoom(ctx, &RoomState{RoomName: "stolen", Owner: "mallory"})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("HandoffRoom with %s: %v, want Unauthenticated", name, err)
+		}
+	}
+	if nodes["node-a"].cluster.Owner("anything") == "evil" || nodes["node-a"].server.getRoom("stolen") != nil {
+		t.Errorf("an unauthenticated call changed the cluster")
+	}
+
+	// A client claiming that its call was forwarded by another node is forwarded anyway.
+	room := roomOwnedBy(t, nodes, "node-b")
+	ctx := metadata.AppendToOutgoingContext(context.Background(), forwardedByKey, "node-b")
+	stream, err := nodes["node-a"].chat.Subscribe(ctx, &RoomRequest{RoomName: room, InitialConnectionRequest: &ConnectionRequest{ServerID: "mallory"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.CloseSend()
+	waitFor(t, "the subscription to reach the owner", func() bool { return connected(nodes["node-b"].server, room) == 1 })
+	if nodes["node-a"].server.getRoom(room) != nil {
+		t.Errorf("node-a served a room it doesn't own")
+	}
+}
@@ -0,0 +1,247 @@
+package proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BuiltinBot is the sender of the replies of the commands built into the server.
+const BuiltinBot = "BOT"
+
+// A CommandHandler runs a slash command. The reply is posted to the room as the bot that
+// registered the command, unless it is empty. An error is returned to the user that invoked
+// the command and nothing is posted.
+type CommandHandler interface {
+	HandleCommand(ctx context.Context, invocation *CommandInvocation) (string, error)
+}
+
+type CommandHandlerFunc func(ctx context.Context, invocation *CommandInvocation) (string, error)
+
+func (f CommandHandlerFunc) HandleCommand(ctx context.Context, invocation *CommandInvocation) (string, error) {
+	return f(ctx, invocation)
+}
+
+type registeredCommand struct {
+	bot     string
+	spec    *CommandSpec
+	handler CommandHandler
+}
+
+type commandRegistry struct {
+	mu       sync.RWMutex
+	commands map[string]*registeredCommand
+}
+
+// RegisterCommand dispatches /name to handler, whose replies are sent as bot.
+func (s *Server) RegisterCommand(bot string, spec *CommandSpec, handler CommandHandler) error {
+	name := spec.GetName()
+	if name == "" || strings.IndexFunc(name, unicode.IsSpace) >= 0 || strings.HasPrefix(name, "/") {
+		return status.Errorf(codes.InvalidArgument, "%q is not a valid command name", name)
+	}
+	s.commands.mu.Lock()
+	defer s.commands.mu.Unlock()
+	if s.commands.commands == nil {
+		s.commands.commands = map[string]*registeredCommand{}
+	}
+	if existing, taken := s.commands.commands[name]; taken {
+		return status.Errorf(codes.AlreadyExists, "/%s is already handled by %s", name, existing.bot)
+	}
+	s.commands.commands[name] = &registeredCommand{bot: bot, spec: spec, handler: handler}
+	return nil
+}
+
+// UnregisterCommand stops dispatching /name.
+func (s *Server) UnregisterCommand(name string) {
+	s.commands.mu.Lock()
+	defer s.commands.mu.Unlock()
+	delete(s.commands.commands, name)
+}
+
+func (s *Server) lookupCommand(name string) *registeredCommand {
+	s.commands.mu.RLock()
+	defer s.commands.mu.RUnlock()
+	return s.commands.commands[name]
+}
+
+// parseCommand returns the invocation for text messages starting with a slash. A leading
+// double slash escapes it, and is stripped so that the rest is sent as an ordinary message.
+func parseCommand(msg *ChatMessage) (*CommandInvocation, bool) {
+	content := string(msg.GetContent())
+	if !isTextContent(msg.GetContentType()) || !strings.HasPrefix(content, "/") {
+		return nil, false
+	}
+	if strings.HasPrefix(content, "//") {
+		msg.Content = msg.Content[1:]
+		return nil, false
+	}
+	name, rawArgs := content[1:], ""
+	if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+		name, rawArgs = name[:i], name[i:]
+	}
+	if name == "" {
+		return nil, false
+	}
+	return &CommandInvocation{
+		InvocationID: randomID(),
+		Command:      name,
+		Args:         strings.Fields(rawArgs),
+		RawArgs:      strings.TrimSpace(rawArgs),
+		RoomName:     msg.GetRecipient(),
+		Sender:       msg.GetSender(),
+		Timestamp:    msg.GetTimestamp(),
+	}, true
+}
+
+// dispatchCommand runs the handler of invocation and posts its reply. The command message
+// itself is not broadcast.
+func (s *Server) dispatchCommand(ctx context.Context, invocation *CommandInvocation) error {
+	cmd := s.lookupCommand(invocation.GetCommand())
+	if cmd == nil {
+		return status.Errorf(codes.InvalidArgument, "unknown command /%s, try /help", invocation.GetCommand())
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.config.Load().CommandTimeout)
+	defer cancel()
+	reply, err := cmd.handler.HandleCommand(ctx, invocation)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Errorf(codes.DeadlineExceeded, "%s did not answer /%s in time", cmd.bot, invocation.GetCommand())
+	case err != nil:
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Errorf(codes.InvalidArgument, "/%s: %s", invocation.GetCommand(), err.Error())
+	case reply == "":
+		return nil
+	}
+	msg, err := s.applyFilters(ctx, &ChatMessage{
+		Sender:    cmd.bot,
+		Recipient: invocation.GetRoomName(),
+		Content:   []byte(reply),
+		Timestamp: uint64(time.Now().Unix()),
+	})
+	if err != nil || msg == nil {
+		return err
+	}
+	s.routeMessage(ctx, msg)
+	return nil
+}
+
+func (s *Server) registerBuiltinCommands() {
+	builtins := []struct {
+		spec    *CommandSpec
+		handler CommandHandlerFunc
+	}{
+		{&CommandSpec{Name: "help", Usage: "/help [command]", Description: "list the commands, or describe one"}, s.helpCommand},
+		{&CommandSpec{Name: "me", Usage: "/me <action>", Description: "describe what you are doing"}, meCommand},
+		{&CommandSpec{Name: "roll", Usage: "/roll [NdM]", Description: "roll N dice of M sides, 1d6 by default"}, rollCommand},
+		{&CommandSpec{Name: "topic", Usage: "/topic [text]", Description: "show the topic of the room, or set it as its owner"}, s.topicCommand},
+	}
+	for _, b := range builtins {
+		_ = s.RegisterCommand(BuiltinBot, b.spec, b.handler)
+	}
+}
+
+func (s *Server) helpCommand(_ context.Context, invocation *CommandInvocation) (string, error) {
+	s.commands.mu.RLock()
+	defer s.commands.mu.RUnlock()
+	if len(invocation.GetArgs()) > 0 {
+		name := strings.TrimPrefix(invocation.GetArgs()[0], "/")
+		cmd := s.commands.commands[name]
+		if cmd == nil {
+			return "", fmt.Errorf("there is no /%s command", name)
+		}
+		usage := cmd.spec.GetUsage()
+		if usage == "" {
+			usage = "/" + name
+		}
+		return fmt.Sprintf("%s - %s (%s)", usage, cmd.spec.GetDescription(), cmd.bot), nil
+	}
+	lines := make([]string, 0, len(s.commands.commands))
+	for name, cmd := range s.commands.commands {
+		usage := cmd.spec.GetUsage()
+		if usage == "" {
+			usage = "/" + name
+		}
+		if description := cmd.spec.GetDescription(); description != "" {
+			usage += " - " + description
+		}
+		lines = append(lines, usage)
+	}
+	sort.Strings(lines)
+	return "Commands:\n" + strings.Join(lines, "\n"), nil
+}
+
+func meCommand(_ context.Context, invocation *CommandInvocation) (string, error) {
+	if invocation.GetRawArgs() == "" {
+		return "", errors.New("say what you are doing, e.g. /me waves")
+	}
+	return fmt.Sprintf("* %s %s", invocation.GetSender(), invocation.GetRawArgs()), nil
+}
+
+func rollCommand(_ context.Context, invocation *CommandInvocation) (string, error) {
+	dice := "1d6"
+	if len(invocation.GetArgs()) > 0 {
+		dice = strings.ToLower(invocation.GetArgs()[0])
+	}
+	countText, sidesText, found := strings.Cut(dice, "d")
+	if !found {
+		countText, sidesText = "1", dice
+	}
+	if countText == "" {
+		countText = "1"
+	}
+	count, err1 := strconv.Atoi(countText)
+	sides, err2 := strconv.Atoi(sidesText)
+	if err1 != nil || err2 != nil || count < 1 || count > 100 || sides < 2 || sides > 1000 {
+		return "", fmt.Errorf("%q is not NdM with 1 to 100 dice of 2 to 1000 sides", dice)
+	}
+	rolls := make([]string, count)
+	total := 0
+	for i := range rolls {
+		n := rand.Intn(sides) + 1
+		total += n
+		rolls[i] = strconv.Itoa(n)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%s rolled %dd%d: %d", invocation.GetSender(), count, sides, total), nil
+	}
+	return fmt.Sprintf("%s rolled %dd%d: %s = %d", invocation.GetSender(), count, sides, strings.Join(rolls, " + "), total), nil
+}
+
+// topicCommand shows the topic of the room to anyone, and lets its owner or an admin set it,
+// as they would moderate it.
+func (s *Server) topicCommand(ctx context.Context, invocation *CommandInvocation) (string, error) {
+	if invocation.GetRawArgs() == "" {
+		room := s.getRoom(invocation.GetRoomName())
+		if room == nil {
+			return "", status.Errorf(codes.NotFound, "room %s does not exist", invocation.GetRoomName())
+		}
+		room.mu.Lock()
+		topic := room.topic
+		room.mu.Unlock()
+		if topic == "" {
+			return fmt.Sprintf("%s has no topic.", room.name), nil
+		}
+		return fmt.Sprintf("The topic of %s is: %s", room.name, topic), nil
+	}
+	room, actor, err := s.moderatedRoom(ctx, invocation.GetRoomName(), invocation.GetSender())
+	if err != nil {
+		return "", err
+	}
+	room.mu.Lock()
+	room.topic = invocation.GetRawArgs()
+	room.mu.Unlock()
+	s.recordAudit(AuditTopic, room.name, actor, "", invocation.GetRawArgs())
+	return fmt.Sprintf("%s set the topic to: %s", invocation.GetSender(), invocation.GetRawArgs()), nil
+}
@@ -0,0 +1,156 @@
+package proto
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		contentType string
+		want        *CommandInvocation
+		// sent is the content of the message when it isn't a command.
+		sent string
+	}{
+		{"command", "/roll  2d6 fast ", "", &CommandInvocation{Command: "roll", Args: []string{"2d6", "fast"}, RawArgs: "2d6 fast"}, ""},
+		{"no arguments", "/help", "text/plain", &CommandInvocation{Command: "help"}, ""},
+		{"escaped", "//roll 2d6", "", nil, "/roll 2d6"},
+		{"plain text", "hello /roll", "", nil, "hello /roll"},
+		{"slash alone", "/ roll", "", nil, "/ roll"},
+		{"binary", "/roll", "application/octet-stream", nil, "/roll"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte(tt.content), ContentType: tt.contentType, Timestamp: 42}
+			invocation, ok := parseCommand(msg)
+			if tt.want == nil {
+				if ok {
+					t.Fatalf("parsed /%s", invocation.GetCommand())
+				}
+				if string(msg.GetContent()) != tt.sent {
+					t.Errorf("the message became %q, want %q", msg.GetContent(), tt.sent)
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("not parsed as a command")
+			}
+			if invocation.GetCommand() != tt.want.GetCommand() || invocation.GetRawArgs() != tt.want.GetRawArgs() ||
+				strings.Join(invocation.GetArgs(), " ") != strings.Join(tt.want.GetArgs(), " ") {
+				t.Errorf("parsed /%s %q %q, want /%s %q %q", invocation.GetCommand(), invocation.GetArgs(), invocation.GetRawArgs(),
+					tt.want.GetCommand(), tt.want.GetArgs(), tt.want.GetRawArgs())
+			}
+			if invocation.GetInvocationID() == "" || invocation.GetRoomName() != "room" || invocation.GetSender() != "alice" || invocation.GetTimestamp() != 42 {
+				t.Errorf("invocation %v does not identify the message", invocation)
+			}
+		})
+	}
+}
+
+func TestRegisterCommand(t *testing.T) {
+	s := newTestServer(t)
+	noop := CommandHandlerFunc(func(context.Context, *CommandInvocation) (string, error) { return "", nil })
+	tests := []struct {
+		name string
+		spec *CommandSpec
+		want codes.Code
+	}{
+		{"new", &CommandSpec{Name: "echo"}, codes.OK},
+		{"taken", &CommandSpec{Name: "echo"}, codes.AlreadyExists},
+		{"builtin", &CommandSpec{Name: "roll"}, codes.AlreadyExists},
+		{"empty", &CommandSpec{}, codes.InvalidArgument},
+		{"space", &CommandSpec{Name: "two words"}, codes.InvalidArgument},
+		{"slash", &CommandSpec{Name: "/echo"}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.RegisterCommand("bot", tt.spec, noop); status.Code(err) != tt.want {
+				t.Fatalf("RegisterCommand: %v, want %s", err, tt.want)
+			}
+		})
+	}
+	s.UnregisterCommand("echo")
+	if err := s.RegisterCommand("other", &CommandSpec{Name: "echo"}, noop); err != nil {
+		t.Fatalf("registering /echo once unregistered: %v", err)
+	}
+}
+
+func TestDispatchCommand(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.CommandTimeout = 50 * time.Millisecond
+		cfg.RateLimit.Sender = RateLimit{Burst: 1}
+	})
+	chat := NewChatServiceClient(dialTestServer(t, s))
+	handlers := map[string]CommandHandlerFunc{
+		"echo": func(_ context.Context, invocation *CommandInvocation) (string, error) {
+			return invocation.GetRawArgs(), nil
+		},
+		"fail": func(context.Context, *CommandInvocation) (string, error) {
+			return "", errors.New("it failed")
+		},
+		"refuse": func(context.Context, *CommandInvocation) (string, error) {
+			return "", status.Error(codes.PermissionDenied, "not you")
+		},
+		"hang": func(ctx context.Context, _ *CommandInvocation) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		},
+	}
+	for name, handler := range handlers {
+		if err := s.RegisterCommand("helper", &CommandSpec{Name: name, Usage: "/" + name + " [text]", Description: name + "s"}, handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice := subscribe(t, chat, "room", "alice")
+	waitFor(t, "the room to be created", func() bool { return connected(s, "room") == 1 })
+
+	replies := []struct {
+		command  string
+		sender   string
+		contains string
+	}{
+		{"/echo hi there", "helper", "hi there"},
+		{"/me waves", BuiltinBot, "* alice waves"},
+		{"/help", BuiltinBot, "/echo [text] - echos"},
+		{"/help /hang", BuiltinBot, "/hang [text] - hangs (helper)"},
+		{"//echo not a command", "alice", "/echo not a command"},
+	}
+	for _, r := range replies {
+		send(t, chat, "alice", "room", r.command)
+		got := receive(t, alice, 1)[0]
+		if got.GetSender() != r.sender || !strings.Contains(string(got.GetContent()), r.contains) {
+			t.Errorf("%s: %s posted %q, want %s posting %q", r.command, got.GetSender(), got.GetContent(), r.sender, r.contains)
+		}
+	}
+
+	errs := []struct {
+		command string
+		want    codes.Code
+	}{
+		{"/nope", codes.InvalidArgument},
+		{"/help nope", codes.InvalidArgument},
+		{"/me", codes.InvalidArgument},
+		{"/fail", codes.InvalidArgument},
+		{"/refuse", codes.PermissionDenied},
+		{"/hang", codes.DeadlineExceeded},
+	}
+	for _, e := range errs {
+		_, err := chat.SendMessage(context.Background(), &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte(e.command), Timestamp: uint64(time.Now().Unix())})
+		if status.Code(err) != e.want {
+			t.Errorf("%s: %v, want %s", e.command, err, e.want)
+		}
+	}
+	// Nothing was posted for the failed commands.
+	send(t, chat, "alice", "room", "/echo last")
+	if got := receive(t, alice, 1)[0]; string(got.GetContent()) != "last" {
+		t.Errorf("received %q after the failed commands, want only the last reply", got.GetContent())
+	}
+}
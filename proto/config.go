@@ -0,0 +1,507 @@
+package proto
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting of a chat server. LoadConfig fills it from, in increasing order
+// of precedence, the defaults, a YAML or TOML file, environment variables and command-line flags.
+type Config struct {
+	Port        string `yaml:"port" toml:"port"`
+	AdminPort   string `yaml:"admin_port" toml:"admin_port"`
+	MetricsPort string `yaml:"metrics_port" toml:"metrics_port"`
+	// NodeID identifies this node in a cluster. It defaults to the host name.
+	NodeID string `yaml:"node_id" toml:"node_id"`
+	// AdminToken must be sent in the admin-token metadata of admin RPCs. They are refused when it is empty.
+	AdminToken string `yaml:"admin_token" toml:"admin_token"`
+	// UserTokenSecret signs the tokens of IssueUserToken. When it is set, requests acting as a
+	// user must carry their token in the user-token metadata, and room owners moderate with it.
+	// Moderation is left to admins when it is empty.
+	UserTokenSecret string        `yaml:"user_token_secret" toml:"user_token_secret"`
+	Reflection      bool          `yaml:"reflection" toml:"reflection"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	BrokerURL       string        `yaml:"broker_url" toml:"broker_url"`
+	AuditLogFile    string        `yaml:"audit_log_file" toml:"audit_log_file"`
+	HistorySize     int           `yaml:"history_size" toml:"history_size"`
+	SnapshotFile    string        `yaml:"snapshot_file" toml:"snapshot_file"`
+	// SnapshotInterval is how often the rooms are saved. 0 only saves them at shutdown.
+	SnapshotInterval    time.Duration `yaml:"snapshot_interval" toml:"snapshot_interval"`
+	RoomCleanupInterval time.Duration `yaml:"room_cleanup_interval" toml:"room_cleanup_interval"`
+	// RoomGracePeriod keeps rooms that were just created or handed over by another node alive
+	// until their subscribers have had time to connect.
+	RoomGracePeriod time.Duration `yaml:"room_grace_period" toml:"room_grace_period"`
+	LogLevel        string        `yaml:"log_level" toml:"log_level"`
+	LogFormat       string        `yaml:"log_format" toml:"log_format"`
+	TracingExporter string        `yaml:"tracing_exporter" toml:"tracing_exporter"`
+	WordListFile    string        `yaml:"filter_wordlist_file" toml:"filter_wordlist_file"`
+	WordListMode    string        `yaml:"filter_wordlist_mode" toml:"filter_wordlist_mode"`
+	// CommandTimeout bounds the time a bot may take to handle a slash command.
+	CommandTimeout time.Duration `yaml:"command_timeout" toml:"command_timeout"`
+
+	RateLimit  RateLimitConfig  `yaml:"rate_limit" toml:"rate_limit"`
+	Validation ValidationConfig `yaml:"validation" toml:"validation"`
+	Liveness   LivenessConfig   `yaml:"liveness" toml:"liveness"`
+	Cluster    ClusterConfig    `yaml:"cluster" toml:"cluster"`
+	Federation FederationConfig `yaml:"federation" toml:"federation"`
+	Web        WebConfig        `yaml:"web" toml:"web"`
+	REST       RESTConfig       `yaml:"rest" toml:"rest"`
+	Webhooks   WebhookConfig    `yaml:"webhooks" toml:"webhooks"`
+}
+
+// DefaultConfig returns the settings used for everything that is not configured.
+func DefaultConfig() *Config {
+	hostname, _ := os.Hostname()
+	return &Config{
+		Port:                "9000",
+		MetricsPort:         "9090",
+		NodeID:              hostname,
+		ShutdownTimeout:     30 * time.Second,
+		AuditLogFile:        "audit.log",
+		HistorySize:         100,
+		SnapshotFile:        "snapshot.pb",
+		SnapshotInterval:    30 * time.Second,
+		RoomCleanupInterval: 20 * time.Second,
+		RoomGracePeriod:     time.Minute,
+		LogLevel:            "info",
+		LogFormat:           "json",
+		WordListMode:        "rewrite",
+		CommandTimeout:      5 * time.Second,
+		RateLimit: RateLimitConfig{
+			Sender:   RateLimit{Rate: 5, Burst: 10},
+			Room:     RateLimit{Rate: 50, Burst: 100},
+			Gateway:  RateLimit{Rate: 200, Burst: 400},
+			KeyFetch: RateLimit{Rate: 1, Burst: 50},
+		},
+		Validation: ValidationConfig{
+			MaxContentBytes: 64 * 1024,
+			MaxClockSkew:    5 * time.Minute,
+		},
+		Liveness: LivenessConfig{
+			HeartbeatInterval: 10 * time.Second,
+			MissThreshold:     3,
+			QueueSize:         256,
+			KeepaliveTime:     time.Minute,
+			KeepaliveTimeout:  20 * time.Second,
+			MinPingInterval:   10 * time.Second,
+		},
+		Cluster: ClusterConfig{
+			GossipInterval: time.Second,
+			FailureTimeout: 5 * time.Second,
+		},
+		Webhooks: WebhookConfig{
+			MaxAttempts:      5,
+			InitialBackoff:   time.Second,
+			MaxBackoff:       time.Minute,
+			Timeout:          10 * time.Second,
+			BreakerThreshold: 5,
+			BreakerCooldown:  30 * time.Second,
+			QueueSize:        1000,
+			DeadLetterFile:   "webhook_dead_letters.log",
+		},
+	}
+}
+
+// LoadConfig builds the configuration from the defaults, the file named by the -config flag
+// or CONFIG_FILE, the environment and args, each overriding the previous ones. Files ending in
+// .toml are read as TOML and any other file as YAML. The result is validated.
+func LoadConfig(args []string) (*Config, error) {
+	cfg := DefaultConfig()
+	path := os.Getenv("CONFIG_FILE")
+	if p, ok := configFlag(args); ok {
+		path = p
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	fs.String("config", path, "YAML or TOML configuration file (CONFIG_FILE)")
+	settings := cfg.settings()
+	for _, s := range settings {
+		fs.Var(s.value, s.flag, fmt.Sprintf("%s (%s)", s.usage, s.env))
+	}
+	for _, s := range settings {
+		if v := os.Getenv(s.env); v != "" {
+			if err := s.value.Set(v); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// configFlag finds the value of -config in args, which has to be known before the flags are
+// defined since the file provides their defaults.
+func configFlag(args []string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == "config" && i+1 < len(args) && arg != name {
+			return args[i+1], true
+		}
+		if strings.HasPrefix(name, "config=") && arg != name {
+			return strings.TrimPrefix(name, "config="), true
+		}
+	}
+	return "", false
+}
+
+// loadFile reads a configuration file over cfg. Unknown keys are rejected, so that misspelled
+// settings don't go unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown setting %s", undecoded[0])
+		}
+		return nil
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// setting binds a field of Config to a command-line flag and an environment variable.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	value flag.Value
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"port", "PORT", "port of the chat service", stringValue{&c.Port}},
+		{"admin-port", "ADMIN_PORT", "separate port for the admin service, which shares the chat port when empty", stringValue{&c.AdminPort}},
+		{"metrics-port", "METRICS_PORT", "port of the /metrics endpoint", stringValue{&c.MetricsPort}},
+		{"node-id", "NODE_ID", "ID of this node in the cluster", stringValue{&c.NodeID}},
+		{"admin-token", "ADMIN_TOKEN", "token required by admin RPCs, which are disabled when empty", stringValue{&c.AdminToken}},
+		{"user-token-secret", "USER_TOKEN_SECRET", "key user tokens are signed with, which requires users to send one when set", stringValue{&c.UserTokenSecret}},
+		{"reflection", "GRPC_REFLECTION", "register the gRPC reflection service", boolValue{&c.Reflection}},
+		{"shutdown-timeout", "SHUTDOWN_TIMEOUT_SECONDS", "time allowed for draining connections", durationValue{&c.ShutdownTimeout, time.Second}},
+		{"broker-url", "BROKER_URL", "NATS URL of the broker shared by the nodes of a cluster", stringValue{&c.BrokerURL}},
+		{"audit-log", "AUDIT_LOG_FILE", "file the audit log is appended to", stringValue{&c.AuditLogFile}},
+		{"history-size", "HISTORY_SIZE", "messages retained per room for catching up", intValue{&c.HistorySize}},
+		{"snapshot-file", "SNAPSHOT_FILE", "file the rooms are saved to", stringValue{&c.SnapshotFile}},
+		{"snapshot-interval", "SNAPSHOT_INTERVAL_SECONDS", "interval between snapshots, 0 to only save at shutdown", durationValue{&c.SnapshotInterval, time.Second}},
+		{"room-cleanup-interval", "ROOM_CLEANUP_INTERVAL_SECONDS", "interval between sweeps for empty rooms", durationValue{&c.RoomCleanupInterval, time.Second}},
+		{"room-grace-period", "ROOM_GRACE_PERIOD_SECONDS", "age below which empty rooms are kept", durationValue{&c.RoomGracePeriod, time.Second}},
+		{"log-level", "LOG_LEVEL", "debug, info, warn or error", stringValue{&c.LogLevel}},
+		{"log-format", "LOG_FORMAT", "json or text", stringValue{&c.LogFormat}},
+		{"tracing-exporter", "TRACING_EXPORTER", "stdout to print spans, empty to disable tracing", stringValue{&c.TracingExporter}},
+		{"filter-wordlist", "FILTER_WORDLIST_FILE", "file of words to filter from messages", stringValue{&c.WordListFile}},
+		{"filter-wordlist-mode", "FILTER_WORDLIST_MODE", "rewrite or reject messages containing filtered words", stringValue{&c.WordListMode}},
+		{"command-timeout", "COMMAND_TIMEOUT_SECONDS", "time a bot may take to handle a slash command", durationValue{&c.CommandTimeout, time.Second}},
+		{"rate-limit-sender-rps", "RATE_LIMIT_SENDER_RPS", "messages per second per sender", floatValue{&c.RateLimit.Sender.Rate}},
+		{"rate-limit-sender-burst", "RATE_LIMIT_SENDER_BURST", "burst per sender", intValue{&c.RateLimit.Sender.Burst}},
+		{"rate-limit-room-rps", "RATE_LIMIT_ROOM_RPS", "messages per second per room", floatValue{&c.RateLimit.Room.Rate}},
+		{"rate-limit-room-burst", "RATE_LIMIT_ROOM_BURST", "burst per room", intValue{&c.RateLimit.Room.Burst}},
+		{"rate-limit-gateway-rps", "RATE_LIMIT_GATEWAY_RPS", "messages per second per gateway", floatValue{&c.RateLimit.Gateway.Rate}},
+		{"rate-limit-gateway-burst", "RATE_LIMIT_GATEWAY_BURST", "burst per gateway", intValue{&c.RateLimit.Gateway.Burst}},
+		{"rate-limit-key-fetch-rps", "RATE_LIMIT_KEY_FETCH_RPS", "key bundles fetched per second per caller", floatValue{&c.RateLimit.KeyFetch.Rate}},
+		{"rate-limit-key-fetch-burst", "RATE_LIMIT_KEY_FETCH_BURST", "burst of key bundles fetched per caller", intValue{&c.RateLimit.KeyFetch.Burst}},
+		{"max-content-bytes", "MAX_CONTENT_BYTES", "largest accepted message content", intValue{&c.Validation.MaxContentBytes}},
+		{"max-clock-skew", "MAX_CLOCK_SKEW_SECONDS", "how far message timestamps may be from the server's clock", durationValue{&c.Validation.MaxClockSkew, time.Second}},
+		{"heartbeat-interval", "HEARTBEAT_INTERVAL_SECONDS", "interval between heartbeats to subscribers, 0 to disable", durationValue{&c.Liveness.HeartbeatInterval, time.Second}},
+		{"heartbeat-miss-threshold", "HEARTBEAT_MISS_THRESHOLD", "missed heartbeats before a subscriber is disconnected", intValue{&c.Liveness.MissThreshold}},
+		{"send-queue-size", "SEND_QUEUE_SIZE", "messages that may wait to be sent to a subscriber", intValue{&c.Liveness.QueueSize}},
+		{"keepalive-time", "KEEPALIVE_TIME_SECONDS", "idle time before the server pings a client", durationValue{&c.Liveness.KeepaliveTime, time.Second}},
+		{"keepalive-timeout", "KEEPALIVE_TIMEOUT_SECONDS", "time to wait for a ping to be acknowledged", durationValue{&c.Liveness.KeepaliveTimeout, time.Second}},
+		{"keepalive-min-ping", "KEEPALIVE_MIN_PING_SECONDS", "shortest interval between client pings", durationValue{&c.Liveness.MinPingInterval, time.Second}},
+		{"keepalive-permit-without-stream", "KEEPALIVE_PERMIT_WITHOUT_STREAM", "allow client pings without active streams", boolValue{&c.Liveness.PermitWithoutStream}},
+		{"cluster-advertise-addr", "CLUSTER_ADVERTISE_ADDR", "address other nodes reach this node at, enables clustering", stringValue{&c.Cluster.Address}},
+		{"cluster-secret", "CLUSTER_SECRET", "secret shared by the nodes of the cluster, required with clustering", stringValue{&c.Cluster.Secret}},
+		{"cluster-seeds", "CLUSTER_SEEDS", "comma-separated addresses of nodes to join", listValue{&c.Cluster.Seeds}},
+		{"cluster-gossip-interval", "CLUSTER_GOSSIP_INTERVAL_MS", "interval between gossip rounds", durationValue{&c.Cluster.GossipInterval, time.Millisecond}},
+		{"cluster-failure-timeout", "CLUSTER_FAILURE_TIMEOUT_MS", "silence after which a node is considered dead", durationValue{&c.Cluster.FailureTimeout, time.Millisecond}},
+		{"federation-addr", "FEDERATION_ADDR", "address federation peers reach this server at, enables federation", stringValue{&c.Federation.Address}},
+		{"federation-server-id", "FEDERATION_SERVER_ID", "ID of this server in the federation", stringValue{&c.Federation.ServerID}},
+		{"federation-peers", "FEDERATION_PEERS", "comma-separated servers allowed to federate, as serverID=address", listValue{&c.Federation.Peers}},
+		{"federation-secret", "FEDERATION_SECRET", "secret shared by the federated servers, required with federation", stringValue{&c.Federation.Secret}},
+		{"federation-links", "FEDERATION_LINKS", "comma-separated rooms to link, as localRoom=peerAddress/remoteRoom", listValue{&c.Federation.Links}},
+		{"web-port", "WEB_PORT", "port serving gRPC-Web and the WebSocket bridge to browsers, disabled when empty", stringValue{&c.Web.Port}},
+		{"web-allowed-origins", "WEB_ALLOWED_ORIGINS", "comma-separated origins browsers may connect from, * for any", listValue{&c.Web.AllowedOrigins}},
+		{"rest-port", "REST_PORT", "port serving the JSON API and its OpenAPI spec, disabled when empty", stringValue{&c.REST.Port}},
+		{"webhooks", "WEBHOOK_ENDPOINTS", "comma-separated URLs receiving room events, as room=url for a single room", listValue{&c.Webhooks.Endpoints}},
+		{"webhook-secret", "WEBHOOK_SECRET", "key webhook requests are signed with", stringValue{&c.Webhooks.Secret}},
+		{"webhook-max-attempts", "WEBHOOK_MAX_ATTEMPTS", "requests made for a webhook event before it is dead-lettered", intValue{&c.Webhooks.MaxAttempts}},
+		{"webhook-initial-backoff", "WEBHOOK_INITIAL_BACKOFF_MS", "wait before retrying a webhook request, doubled on each retry", durationValue{&c.Webhooks.InitialBackoff, time.Millisecond}},
+		{"webhook-max-backoff", "WEBHOOK_MAX_BACKOFF_MS", "longest wait between webhook retries", durationValue{&c.Webhooks.MaxBackoff, time.Millisecond}},
+		{"webhook-timeout", "WEBHOOK_TIMEOUT_SECONDS", "time allowed for a webhook request", durationValue{&c.Webhooks.Timeout, time.Second}},
+		{"webhook-breaker-threshold", "WEBHOOK_BREAKER_THRESHOLD", "consecutive failures after which a webhook endpoint is skipped", intValue{&c.Webhooks.BreakerThreshold}},
+		{"webhook-breaker-cooldown", "WEBHOOK_BREAKER_COOLDOWN_SECONDS", "time a failing webhook endpoint is skipped for", durationValue{&c.Webhooks.BreakerCooldown, time.Second}},
+		{"webhook-queue-size", "WEBHOOK_QUEUE_SIZE", "events that may wait for each webhook endpoint", intValue{&c.Webhooks.QueueSize}},
+		{"webhook-dead-letter-file", "WEBHOOK_DEAD_LETTER_FILE", "file undeliverable webhook events are appended to, empty to only log them", stringValue{&c.Webhooks.DeadLetterFile}},
+	}
+}
+
+// Validate checks every setting and reports all the invalid ones at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	validPort := func(port string) bool {
+		n, err := strconv.Atoi(port)
+		return err == nil && n > 0 && n < 65536
+	}
+	check(validPort(c.Port), "port: %q is not a valid port", c.Port)
+	check(validPort(c.MetricsPort), "metrics_port: %q is not a valid port", c.MetricsPort)
+	check(c.AdminPort == "" || validPort(c.AdminPort), "admin_port: %q is not a valid port", c.AdminPort)
+	check(c.Port != c.MetricsPort && (c.AdminPort == "" || (c.AdminPort != c.Port && c.AdminPort != c.MetricsPort)),
+		"port, admin_port and metrics_port must be different")
+	check(c.Web.Port == "" || validPort(c.Web.Port), "web.port: %q is not a valid port", c.Web.Port)
+	check(c.Web.Port == "" || (c.Web.Port != c.Port && c.Web.Port != c.MetricsPort && c.Web.Port != c.AdminPort),
+		"web.port must be different from port, admin_port and metrics_port")
+	check(c.REST.Port == "" || validPort(c.REST.Port), "rest.port: %q is not a valid port", c.REST.Port)
+	check(c.REST.Port == "" || (c.REST.Port != c.Port && c.REST.Port != c.MetricsPort && c.REST.Port != c.AdminPort && c.REST.Port != c.Web.Port),
+		"rest.port must be different from port, admin_port, metrics_port and web.port")
+	check(c.NodeID != "", "node_id must not be empty")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout must be positive")
+	check(c.AuditLogFile != "", "audit_log_file must not be empty")
+	check(c.HistorySize >= 0, "history_size must not be negative")
+	check(c.SnapshotFile != "", "snapshot_file must not be empty")
+	check(c.SnapshotInterval >= 0, "snapshot_interval must not be negative")
+	check(c.RoomCleanupInterval > 0, "room_cleanup_interval must be positive")
+	check(c.RoomGracePeriod >= 0, "room_grace_period must not be negative")
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "log_level: %q is not one of debug, info, warn or error", c.LogLevel)
+	check(c.LogFormat == "json" || c.LogFormat == "text", "log_format: %q is not json or text", c.LogFormat)
+	check(c.TracingExporter == "" || c.TracingExporter == "stdout", "tracing_exporter: %q is not stdout", c.TracingExporter)
+	check(c.WordListMode == "rewrite" || c.WordListMode == "reject", "filter_wordlist_mode: %q is not rewrite or reject", c.WordListMode)
+	check(c.CommandTimeout > 0, "command_timeout must be positive")
+	for scope, limit := range map[string]RateLimit{"sender": c.RateLimit.Sender, "room": c.RateLimit.Room, "gateway": c.RateLimit.Gateway, "key_fetch": c.RateLimit.KeyFetch} {
+		check(limit.Rate >= 0, "rate_limit.%s.rate must not be negative", scope)
+		check(limit.Burst > 0, "rate_limit.%s.burst must be positive", scope)
+	}
+	check(c.Validation.MaxContentBytes > 0, "validation.max_content_bytes must be positive")
+	check(c.Validation.MaxClockSkew > 0, "validation.max_clock_skew must be positive")
+	check(c.Liveness.HeartbeatInterval >= 0, "liveness.heartbeat_interval must not be negative")
+	check(c.Liveness.MissThreshold > 0, "liveness.miss_threshold must be positive")
+	check(c.Liveness.QueueSize > 0, "liveness.queue_size must be positive")
+	check(c.Liveness.KeepaliveTime > 0, "liveness.keepalive_time must be positive")
+	check(c.Liveness.KeepaliveTimeout > 0, "liveness.keepalive_timeout must be positive")
+	check(c.Liveness.MinPingInterval >= 0, "liveness.min_ping_interval must not be negative")
+	if len(c.Webhooks.Endpoints) > 0 {
+		for _, spec := range c.Webhooks.Endpoints {
+			_, endpoint := parseWebhookSpec(spec)
+			u, err := url.Parse(endpoint)
+			check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "webhooks.endpoints: %q is not an http or https URL", spec)
+		}
+		check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts must be positive")
+		check(c.Webhooks.InitialBackoff > 0, "webhooks.initial_backoff must be positive")
+		check(c.Webhooks.MaxBackoff >= c.Webhooks.InitialBackoff, "webhooks.max_backoff must not be shorter than webhooks.initial_backoff")
+		check(c.Webhooks.Timeout > 0, "webhooks.timeout must be positive")
+		check(c.Webhooks.BreakerThreshold > 0, "webhooks.breaker_threshold must be positive")
+		check(c.Webhooks.BreakerCooldown > 0, "webhooks.breaker_cooldown must be positive")
+		check(c.Webhooks.QueueSize > 0, "webhooks.queue_size must be positive")
+	}
+	if c.Federation.Address != "" {
+		check(c.Federation.Secret != "", "federation.secret must be set when federation is enabled")
+		for _, spec := range c.Federation.Peers {
+			_, _, ok := parsePeerSpec(spec)
+			check(ok, "federation.peers: %q is not serverID=address", spec)
+		}
+	}
+	if c.Cluster.Address != "" {
+		check(c.Cluster.Secret != "", "cluster.secret must be set when clustering is enabled")
+		check(c.Cluster.GossipInterval > 0, "cluster.gossip_interval must be positive")
+		check(c.Cluster.FailureTimeout > c.Cluster.GossipInterval, "cluster.failure_timeout must be longer than cluster.gossip_interval")
+	}
+	return errors.Join(errs...)
+}
+
+// restartRequired returns the settings that differ between c and next and that only take
+// effect when the server is restarted.
+func (c *Config) restartRequired(next *Config) []string {
+	settings := []struct {
+		name      string
+		old, next interface{}
+	}{
+		{"port", c.Port, next.Port},
+		{"admin_port", c.AdminPort, next.AdminPort},
+		{"metrics_port", c.MetricsPort, next.MetricsPort},
+		{"node_id", c.NodeID, next.NodeID},
+		{"reflection", c.Reflection, next.Reflection},
+		{"shutdown_timeout", c.ShutdownTimeout, next.ShutdownTimeout},
+		{"broker_url", c.BrokerURL, next.BrokerURL},
+		{"audit_log_file", c.AuditLogFile, next.AuditLogFile},
+		{"snapshot_file", c.SnapshotFile, next.SnapshotFile},
+		{"snapshot_interval", c.SnapshotInterval, next.SnapshotInterval},
+		{"log_format", c.LogFormat, next.LogFormat},
+		{"tracing_exporter", c.TracingExporter, next.TracingExporter},
+		{"filter_wordlist_file", c.WordListFile, next.WordListFile},
+		{"filter_wordlist_mode", c.WordListMode, next.WordListMode},
+		{"liveness.keepalive_time", c.Liveness.KeepaliveTime, next.Liveness.KeepaliveTime},
+		{"liveness.keepalive_timeout", c.Liveness.KeepaliveTimeout, next.Liveness.KeepaliveTimeout},
+		{"liveness.min_ping_interval", c.Liveness.MinPingInterval, next.Liveness.MinPingInterval},
+		{"liveness.permit_without_stream", c.Liveness.PermitWithoutStream, next.Liveness.PermitWithoutStream},
+		{"cluster", c.Cluster, next.Cluster},
+		{"federation", c.Federation, next.Federation},
+		{"web", c.Web, next.Web},
+		{"rest", c.REST, next.REST},
+		{"webhooks", c.Webhooks, next.Webhooks},
+	}
+	var changed []string
+	for _, s := range settings {
+		if !reflect.DeepEqual(s.old, s.next) {
+			changed = append(changed, s.name)
+		}
+	}
+	return changed
+}
+
+type stringValue struct{ p *string }
+
+func (v stringValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return *v.p
+}
+
+func (v stringValue) Set(s string) error {
+	*v.p = s
+	return nil
+}
+
+type intValue struct{ p *int }
+
+func (v intValue) String() string {
+	if v.p == nil {
+		return "0"
+	}
+	return strconv.Itoa(*v.p)
+}
+
+func (v intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("%q is not an integer", s)
+	}
+	*v.p = n
+	return nil
+}
+
+type floatValue struct{ p *float64 }
+
+func (v floatValue) String() string {
+	if v.p == nil {
+		return "0"
+	}
+	return strconv.FormatFloat(*v.p, 'g', -1, 64)
+}
+
+func (v floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", s)
+	}
+	*v.p = f
+	return nil
+}
+
+type boolValue struct{ p *bool }
+
+func (v boolValue) String() string {
+	if v.p == nil {
+		return "false"
+	}
+	return strconv.FormatBool(*v.p)
+}
+
+func (v boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a boolean", s)
+	}
+	*v.p = b
+	return nil
+}
+
+func (v boolValue) IsBoolFlag() bool {
+	return true
+}
+
+// durationValue accepts durations such as 1m30s, or plain numbers counted in unit, which keeps
+// the environment variables that were documented in seconds or milliseconds working.
+type durationValue struct {
+	p    *time.Duration
+	unit time.Duration
+}
+
+func (v durationValue) String() string {
+	if v.p == nil {
+		return "0s"
+	}
+	return v.p.String()
+}
+
+func (v durationValue) Set(s string) error {
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		*v.p = time.Duration(n * float64(v.unit))
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration", s)
+	}
+	*v.p = d
+	return nil
+}
+
+// listValue reads comma-separated lists, ignoring empty entries.
+type listValue struct{ p *[]string }
+
+func (v listValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strings.Join(*v.p, ",")
+}
+
+func (v listValue) Set(s string) error {
+	*v.p = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v.p = append(*v.p, item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package proto
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// configFile writes content to a file named name in a temporary directory and returns its path.
+func configFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	t.Setenv("CONFIG_FILE", configFile(t, "chat.yaml", `
+port: "9100"
+history_size: 50
+log_level: debug
+rate_limit:
+  sender:
+    rate: 2
+`))
+	t.Setenv("PORT", "9200")
+	t.Setenv("HISTORY_SIZE", "60")
+	cfg, err := LoadConfig([]string{"-port", "9300"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := DefaultConfig()
+	tests := []struct {
+		setting   string
+		got, want interface{}
+	}{
+		{"port from the flag", cfg.Port, "9300"},
+		{"history_size from the environment", cfg.HistorySize, 60},
+		{"log_level from the file", cfg.LogLevel, "debug"},
+		{"rate_limit.sender.rate from the file", cfg.RateLimit.Sender.Rate, 2.0},
+		{"rate_limit.sender.burst by default", cfg.RateLimit.Sender.Burst, defaults.RateLimit.Sender.Burst},
+		{"metrics_port by default", cfg.MetricsPort, defaults.MetricsPort},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: %v, want %v", tt.setting, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigFiles(t *testing.T) {
+	tests := []struct {
+		name, content string
+	}{
+		{"chat.yaml", "snapshot_interval: 1m30s\nwebhooks:\n  initial_backoff: 250ms\n"},
+		{"chat.toml", "snapshot_interval = \"1m30s\"\n[webhooks]\ninitial_backoff = \"250ms\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			cfg, err := LoadConfig([]string{"-config", configFile(t, tt.name, tt.content)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.SnapshotInterval != 90*time.Second || cfg.Webhooks.InitialBackoff != 250*time.Millisecond {
+				t.Errorf("read the durations %s and %s, want 1m30s and 250ms", cfg.SnapshotInterval, cfg.Webhooks.InitialBackoff)
+			}
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		// file is written to a file with the extension ext, whose path replaces FILE in args.
+		file, ext string
+		args      []string
+		want      string
+	}{
+		{"unknown YAML setting", "prot: 1\n", ".yaml", []string{"-config=FILE"}, "field prot not found"},
+		{"unknown TOML setting", "prot = 1\n", ".toml", []string{"--config", "FILE"}, "unknown setting prot"},
+		{"missing file", "", "", []string{"-config", "missing.yaml"}, "reading missing.yaml"},
+		{"malformed duration", "", "", []string{"-shutdown-timeout", "soon"}, `"soon" is not a duration`},
+		{"invalid setting", "", "", []string{"-log-format", "xml"}, `log_format: "xml" is not json or text`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			var args []string
+			for _, arg := range tt.args {
+				if strings.Contains(arg, "FILE") {
+					arg = strings.Replace(arg, "FILE", configFile(t, "chat"+tt.ext, tt.file), 1)
+				}
+				args = append(args, arg)
+			}
+			if _, err := LoadConfig(args); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadConfig(%q): %v, want an error containing %q", args, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigDurationUnits(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("SHUTDOWN_TIMEOUT_SECONDS", "45")
+	t.Setenv("CLUSTER_GOSSIP_INTERVAL_MS", "1500ms")
+	cfg, err := LoadConfig([]string{"-webhook-initial-backoff", "250"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []struct {
+		setting   string
+		got, want time.Duration
+	}{
+		{"SHUTDOWN_TIMEOUT_SECONDS", cfg.ShutdownTimeout, 45 * time.Second},
+		{"CLUSTER_GOSSIP_INTERVAL_MS", cfg.Cluster.GossipInterval, 1500 * time.Millisecond},
+		{"-webhook-initial-backoff", cfg.Webhooks.InitialBackoff, 250 * time.Millisecond},
+	} {
+		if d.got != d.want {
+			t.Errorf("%s: %s, want %s", d.setting, d.got, d.want)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*Config)
+		// want are the fragments of the expected errors, none when the config is valid.
+		want []string
+	}{
+		{"defaults", func(*Config) {}, nil},
+		{"bad port", func(c *Config) { c.Port = "70000" }, []string{`port: "70000" is not a valid port`}},
+		{"shared port", func(c *Config) { c.AdminPort = c.MetricsPort }, []string{"port, admin_port and metrics_port must be different"}},
+		{"log level", func(c *Config) { c.LogLevel = "loud" }, []string{`log_level: "loud"`}},
+		{"rate limit", func(c *Config) { c.RateLimit.Room = RateLimit{Rate: -1} }, []string{"rate_limit.room.rate must not be negative", "rate_limit.room.burst must be positive"}},
+		{"webhook URL", func(c *Config) { c.Webhooks.Endpoints = []string{"room=ftp://example.com"} }, []string{`webhooks.endpoints: "room=ftp://example.com"`}},
+		{"federation without a secret", func(c *Config) { c.Federation.Address = "localhost:9100" }, []string{"federation.secret must be set"}},
+		{"cluster timeouts", func(c *Config) {
+			c.Cluster.Address, c.Cluster.Secret = "localhost:9200", "secret"
+			c.Cluster.FailureTimeout = c.Cluster.GossipInterval
+		}, []string{"cluster.failure_timeout must be longer"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.configure(cfg)
+			err := cfg.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Validate accepted the config")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate: %v, want an error containing %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReloadReportsRestartRequiredSettings(t *testing.T) {
+	s := newTestServer(t)
+	s.importRoom(&RoomState{RoomName: "room"})
+	next := *s.config.Load()
+	next.Port = "9300"
+	next.Federation.Peers = []string{"b=localhost:9101"}
+	next.HistorySize = 2
+	next.RateLimit.Sender = RateLimit{Rate: 1, Burst: 1}
+	changed := s.Reload(&next)
+	if strings.Join(changed, ",") != "port,federation" {
+		t.Errorf("Reload reported %q, want port and federation", changed)
+	}
+	if got := s.config.Load(); got != &next {
+		t.Error("the new config was not stored")
+	}
+	if got := s.getRoom("room").historySize; got != 2 {
+		t.Errorf("the room keeps %d messages, want the reloaded 2", got)
+	}
+	if got := s.Reload(&next); len(got) != 0 {
+		t.Errorf("reloading the same config reported %q", got)
+	}
+}
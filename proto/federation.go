@@ -0,0 +1,379 @@
+package proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type FederationConfig struct {
+	// ServerID identifies this server to its federation peers. It defaults to the node ID.
+	ServerID string `yaml:"server_id" toml:"server_id"`
+	// Address is where peers reach this server's FederationService. Federation is enabled when it is set.
+	Address string `yaml:"address" toml:"address"`
+	// Links are rooms to link at startup, formatted as localRoom=peerAddress/remoteRoom.
+	Links []string `yaml:"links" toml:"links"`
+	// Peers are the servers allowed to federate with this one, as serverID=address. Messages of
+	// linked rooms are only ever relayed to the address listed for the peer.
+	Peers []string `yaml:"peers" toml:"peers"`
+	// Secret is shared by the federated servers and sent in the federation-token metadata of
+	// the calls between them, along with the caller's ID in federation-server-id.
+	Secret      string            `yaml:"secret" toml:"secret"`
+	DialOptions []grpc.DialOption `yaml:"-" toml:"-"`
+}
+
+const (
+	federationTokenKey    = "federation-token"
+	federationServerIDKey = "federation-server-id"
+)
+
+// parsePeerSpec splits serverID=address.
+func parsePeerSpec(spec string) (serverID, address string, ok bool) {
+	serverID, address, ok = strings.Cut(spec, "=")
+	return serverID, address, ok && serverID != "" && address != ""
+}
+
+type federationLink struct {
+	serverID   string
+	address    string
+	remoteRoom string
+}
+
+// Federation relays messages between rooms on different chat servers. Every relayed message
+// carries the server it originated on and the servers it passed through, so a message is
+// never delivered twice to the same server however the links are wired.
+type Federation struct {
+	UnimplementedFederationServiceServer
+	server   *Server
+	serverID string
+	address  string
+	secret   string
+	peers    map[string]string // server ID to address
+	dialOpts []grpc.DialOption
+	mu       sync.Mutex
+	links    map[string][]*federationLink
+	conns    map[string]*grpc.ClientConn
+}
+
+func NewFederation(server *Server, cfg FederationConfig) *Federation {
+	serverID := cfg.ServerID
+	if serverID == "" {
+		serverID = server.nodeID
+	}
+	f := &Federation{
+		server:   server,
+		serverID: serverID,
+		address:  cfg.Address,
+		secret:   cfg.Secret,
+		peers:    map[string]string{},
+		dialOpts: cfg.DialOptions,
+		links:    map[string][]*federationLink{},
+		conns:    map[string]*grpc.ClientConn{},
+	}
+	for _, spec := range cfg.Peers {
+		if serverID, address, ok := parsePeerSpec(spec); ok {
+			f.peers[serverID] = address
+		}
+	}
+	server.federation = f
+	return f
+}
+
+// authenticate returns the ID of the peer making a call, which must be listed in the peers and
+// send the federation secret.
+func (f *Federation) authenticate(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ids, tokens := md.Get(federationServerIDKey), md.Get(federationTokenKey)
+	if len(ids) == 0 || len(tokens) == 0 || f.secret == "" ||
+		subtle.ConstantTimeCompare([]byte(tokens[0]), []byte(f.secret)) != 1 {
+		return "", status.Error(codes.Unauthenticated, "missing or invalid federation-token")
+	}
+	if _, allowed := f.peers[ids[0]]; !allowed {
+		return "", status.Errorf(codes.PermissionDenied, "%s is not a federation peer of this server", ids[0])
+	}
+	return ids[0], nil
+}
+
+// outgoing identifies this server on a call to a peer.
+func (f *Federation) outgoing(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, federationServerIDKey, f.serverID, federationTokenKey, f.secret)
+}
+
+// peerAt returns the ID of the peer listed at address.
+func (f *Federation) peerAt(address string) (string, bool) {
+	for serverID, a := range f.peers {
+		if a == address {
+			return serverID, true
+		}
+	}
+	return "", false
+}
+
+func (f *Federation) client(address string) (FederationServiceClient, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	conn, exists := f.conns[address]
+	if !exists {
+		var err error
+		conn, err = grpc.Dial(address, append([]grpc.DialOption{grpc.WithInsecure()}, f.dialOpts...)...)
+		if err != nil {
+			return nil, err
+		}
+		f.conns[address] = conn
+	}
+	return NewFederationServiceClient(conn), nil
+}
+
+func (f *Federation) addLink(localRoom string, link *federationLink) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, l := range f.links[localRoom] {
+		if l.serverID == link.serverID && l.remoteRoom == link.remoteRoom {
+			l.address = link.address
+			return
+		}
+	}
+	f.links[localRoom] = append(f.links[localRoom], link)
+}
+
+func (f *Federation) removeLink(localRoom, serverID, remoteRoom string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	links := f.links[localRoom]
+	for i, l := range links {
+		if l.serverID == serverID && l.remoteRoom == remoteRoom {
+			f.links[localRoom] = append(links[:i], links[i+1:]...)
+			return
+		}
+	}
+}
+
+func (f *Federation) linksOf(localRoom string) []*federationLink {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*federationLink{}, f.links[localRoom]...)
+}
+
+// linkedTo reports whether localRoom is linked to a room of the peer serverID.
+func (f *Federation) linkedTo(localRoom, serverID string) bool {
+	for _, link := range f.linksOf(localRoom) {
+		if link.serverID == serverID {
+			return true
+		}
+	}
+	return false
+}
+
+// LinkRoom links localRoom to remoteRoom on the peer at address. The link is kept locally even
+// if the peer can't be reached, so messages start flowing as soon as the peer links back.
+func (f *Federation) LinkRoom(ctx context.Context, localRoom, address, remoteRoom string) error {
+	serverID, listed := f.peerAt(address)
+	if !listed {
+		return status.Errorf(codes.FailedPrecondition, "%s is not the address of a federation peer", address)
+	}
+	client, err := f.client(address)
+	if err != nil {
+		return err
+	}
+	_, err = client.Link(f.outgoing(ctx), &FederationLink{
+		ServerID:   f.serverID,
+		Address:    f.address,
+		LocalRoom:  remoteRoom,
+		RemoteRoom: localRoom,
+	})
+	f.addLink(localRoom, &federationLink{serverID: serverID, address: address, remoteRoom: remoteRoom})
+	return err
+}
+
+// LinkFromSpec links rooms described as localRoom=peerAddress/remoteRoom.
+func (f *Federation) LinkFromSpec(ctx context.Context, spec string) error {
+	localRoom, target := spec, ""
+	if i := strings.Index(spec, "="); i >= 0 {
+		localRoom, target = spec[:i], spec[i+1:]
+	}
+	address, remoteRoom := target, localRoom
+	if i := strings.LastIndex(target, "/"); i >= 0 {
+		address, remoteRoom = target[:i], target[i+1:]
+	}
+	return f.LinkRoom(ctx, localRoom, address, remoteRoom)
+}
+
+// Link relays the room's messages to the calling peer, at the address listed for it whatever
+// address the request names.
+func (f *Federation) Link(ctx context.Context, request *FederationLink) (*Empty, error) {
+	peer, err := f.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if request.GetServerID() != peer {
+		return nil, status.Errorf(codes.PermissionDenied, "%s can't link rooms for %s", peer, request.GetServerID())
+	}
+	f.addLink(request.GetLocalRoom(), &federationLink{
+		serverID:   peer,
+		address:    f.peers[peer],
+		remoteRoom: request.GetRemoteRoom(),
+	})
+	return &Empty{}, nil
+}
+
+func (f *Federation) Unlink(ctx context.Context, request *FederationLink) (*Empty, error) {
+	peer, err := f.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.removeLink(request.GetLocalRoom(), peer, request.GetRemoteRoom())
+	return &Empty{}, nil
+}
+
+// Relay delivers a message from a linked room to the local room and passes it on to the other
+// servers the room is linked to. The message goes through the same validation, rate limits,
+// moderation and filters as the messages sent to this server, as user@origin.
+func (f *Federation) Relay(ctx context.Context, request *FederatedMessage) (*Empty, error) {
+	peer, err := f.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Every server a message passes through adds itself to via, starting with its origin, so
+	// the caller must be the last one.
+	via := request.GetVia()
+	if len(via) == 0 || via[0] != request.GetOrigin() || via[len(via)-1] != peer {
+		return nil, status.Errorf(codes.PermissionDenied, "%s can only relay messages through itself", peer)
+	}
+	if !f.linkedTo(request.GetRoomName(), peer) {
+		return nil, status.Errorf(codes.PermissionDenied, "%s is not linked to %s", request.GetRoomName(), peer)
+	}
+	if err := f.server.awaitReady(ctx); err != nil {
+		return nil, err
+	}
+	for _, id := range request.GetVia() {
+		if id == f.serverID {
+			return &Empty{}, nil
+		}
+	}
+	s := f.server
+	msg := request.GetMessage()
+	if room := s.getRoom(request.GetRoomName()); room != nil {
+		relayed := proto.Clone(msg).(*ChatMessage)
+		relayed.Sender = msg.GetSender() + "@" + request.GetOrigin()
+		relayed.Recipient = request.GetRoomName()
+		if err := s.admitMessage(ctx, relayed); err != nil {
+			return nil, err
+		}
+		relayed, err := s.applyFilters(ctx, relayed)
+		if err != nil {
+			return nil, err
+		}
+		if relayed == nil {
+			s.metrics.messageDropped("quarantined")
+			return &Empty{}, nil
+		}
+		room.BroadcastMessage(relayed)
+	}
+	f.relay(request.GetRoomName(), msg, request.GetOrigin(), request.GetVia())
+	return &Empty{}, nil
+}
+
+// relay sends msg to every server linked to localRoom that hasn't seen it yet.
+func (f *Federation) relay(localRoom string, msg *ChatMessage, origin string, via []string) {
+	seen := map[string]bool{origin: true}
+	for _, id := range via {
+		seen[id] = true
+	}
+	via = append(append([]string{}, via...), f.serverID)
+	for _, link := range f.linksOf(localRoom) {
+		if seen[link.serverID] {
+			continue
+		}
+		client, err := f.client(link.address)
+		if err != nil {
+			continue
+		}
+		go func(link *federationLink) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, _ = client.Relay(f.outgoing(ctx), &FederatedMessage{
+				RoomName: link.remoteRoom,
+				Message:  msg,
+				Origin:   origin,
+				Via:      via,
+			})
+		}(link)
+	}
+}
+
+// relayLocal relays a message sent to a local room to every linked server.
+func (f *Federation) relayLocal(localRoom string, msg *ChatMessage) {
+	f.relay(localRoom, msg, f.serverID, nil)
+}
+
+func (f *Federation) Members(ctx context.Context, request *MembersRequest) (*MembersResponse, error) {
+	if _, err := f.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return &MembersResponse{Members: f.server.localMembers(request.GetRoomName())}, nil
+}
+
+// remoteMembers asks every linked server for the members of its side of the room.
+func (f *Federation) remoteMembers(ctx context.Context, localRoom string) []string {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var members []string
+	for _, link := range f.linksOf(localRoom) {
+		client, err := f.client(link.address)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(link *federationLink) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			defer cancel()
+			response, err := client.Members(f.outgoing(ctx), &MembersRequest{RoomName: link.remoteRoom})
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, member := range response.GetMembers() {
+				members = append(members, member+"@"+link.serverID)
+			}
+		}(link)
+	}
+	wg.Wait()
+	return members
+}
+
+func (s *Server) localMembers(roomID string) []string {
+	members := []string{}
+	room := s.getRoom(roomID)
+	if room == nil {
+		return members
+	}
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	for _, conn := range room.connections {
+		members = append(members, conn.clientID)
+	}
+	return members
+}
+
+func (s *Server) ListMembers(ctx context.Context, request *RoomRequest) (*ListMembersResponse, error) {
+	if client, ctx, forward := s.forwardTarget(ctx, request.GetRoomName()); forward {
+		return client.ListMembers(ctx, request)
+	}
+	members := s.localMembers(request.GetRoomName())
+	if s.federation != nil {
+		members = append(members, s.federation.remoteMembers(ctx, request.GetRoomName())...)
+	}
+	sort.Strings(members)
+	return &ListMembersResponse{Members: members}, nil
+}
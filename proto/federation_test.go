@@ -0,0 +1,227 @@
+package proto
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const testFederationSecret = "federation secret"
+
+type testPeer struct {
+	server     *Server
+	federation *Federation
+	chat       ChatServiceClient
+	peer       FederationServiceClient
+}
+
+// newTestFederation starts a server per ID over bufconn, each reachable at its ID and allowed to
+// federate with the others.
+func newTestFederation(t *testing.T, ids ...string) map[string]*testPeer {
+	t.Helper()
+	listeners := map[string]*bufconn.Listener{}
+	var peers []string
+	for _, id := range ids {
+		listeners[id] = bufconn.Listen(1 << 20)
+		peers = append(peers, id+"="+id)
+	}
+	dialer := grpc.WithContextDialer(func(_ context.Context, address string) (net.Conn, error) {
+		lis, exists := listeners[address]
+		if !exists {
+			return nil, fmt.Errorf("no server at %s", address)
+		}
+		return lis.Dial()
+	})
+	servers := map[string]*testPeer{}
+	for _, id := range ids {
+		s := newTestServer(t, func(cfg *Config) { cfg.NodeID = id })
+		f := NewFederation(s, FederationConfig{
+			ServerID:    id,
+			Address:     id,
+			Peers:       peers,
+			Secret:      testFederationSecret,
+			DialOptions: []grpc.DialOption{dialer},
+		})
+		server := grpc.NewServer()
+		RegisterChatServiceServer(server, s)
+		RegisterFederationServiceServer(server, f)
+		go server.Serve(listeners[id])
+		conn, err := grpc.Dial(id, grpc.WithInsecure(), dialer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			conn.Close()
+			server.Stop()
+		})
+		servers[id] = &testPeer{server: s, federation: f, chat: NewChatServiceClient(conn), peer: NewFederationServiceClient(conn)}
+	}
+	return servers
+}
+
+// asPeer makes a call as the federation peer serverID with the given secret.
+func asPeer(serverID, secret string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), federationServerIDKey, serverID, federationTokenKey, secret)
+}
+
+// relayed is a message a relays from its room.
+func relayed(sender, room, content string) *FederatedMessage {
+	return &FederatedMessage{
+		RoomName: room,
+		Origin:   "a",
+		Via:      []string{"a"},
+		Message:  &ChatMessage{Sender: sender, Recipient: room, Content: []byte(content), Timestamp: uint64(time.Now().Unix())},
+	}
+}
+
+// linkAll links each of rooms on a to the room of the same name on b, both ways.
+func linkAll(t *testing.T, servers map[string]*testPeer, rooms ...string) {
+	t.Helper()
+	for _, room := range rooms {
+		if err := servers["a"].federation.LinkRoom(context.Background(), room, "b", room); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFederationRelaysLinkedRooms(t *testing.T) {
+	servers := newTestFederation(t, "a", "b")
+	stream := subscribe(t, servers["b"].chat, "lobby", "bob")
+	subscribe(t, servers["a"].chat, "lobby", "alice")
+	if err := servers["a"].federation.LinkRoom(context.Background(), "lobby", "b", "lobby"); err != nil {
+		t.Fatal(err)
+	}
+	if err := servers["b"].federation.LinkRoom(context.Background(), "lobby", "a", "lobby"); err != nil {
+		t.Fatal(err)
+	}
+	send(t, servers["a"].chat, "alice", "lobby", "hello")
+	if got := receive(t, stream, 1)[0]; got.GetSender() != "alice@a" || string(got.GetContent()) != "hello" {
+		t.Fatalf("b received %s: %q, want alice@a: hello", got.GetSender(), got.GetContent())
+	}
+}
+
+func TestFederationRefusesUnknownPeers(t *testing.T) {
+	servers := newTestFederation(t, "a", "b")
+	b := servers["b"].peer
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{"no token", context.Background(), codes.Unauthenticated},
+		{"wrong secret", asPeer("a", "guess"), codes.Unauthenticated},
+		{"not a peer", asPeer("mallory", testFederationSecret), codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := b.Relay(tt.ctx, relayed("alice", "lobby", "hi")); status.Code(err) != tt.want {
+				t.Errorf("Relay: %v, want %s", err, tt.want)
+			}
+			if _, err := b.Members(tt.ctx, &MembersRequest{RoomName: "lobby"}); status.Code(err) != tt.want {
+				t.Errorf("Members: %v, want %s", err, tt.want)
+			}
+			link := &FederationLink{ServerID: "a", Address: "mallory", LocalRoom: "lobby", RemoteRoom: "lobby"}
+			if _, err := b.Link(tt.ctx, link); status.Code(err) != tt.want {
+				t.Errorf("Link: %v, want %s", err, tt.want)
+			}
+		})
+	}
+
+	link := &FederationLink{ServerID: "b", Address: "mallory", LocalRoom: "lobby", RemoteRoom: "lobby"}
+	if _, err := b.Link(asPeer("a", testFederationSecret), link); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Link for another server: %v, want PermissionDenied", err)
+	}
+	link.ServerID = "a"
+	if _, err := b.Link(asPeer("a", testFederationSecret), link); err != nil {
+		t.Fatal(err)
+	}
+	links := servers["b"].federation.linksOf("lobby")
+	if len(links) != 1 || links[0].address != "a" {
+		t.Fatalf("links of lobby: %+v, want one to a at its listed address", links)
+	}
+}
+
+func TestFederationAdmitsRelayedMessages(t *testing.T) {
+	servers := newTestFederation(t, "a", "b")
+	b := servers["b"]
+	b.server.importRoom(&RoomState{RoomName: "lobby", Owner: "bob", Mutes: map[string]uint64{"mallory@a": 0}})
+	b.server.importRoom(&RoomState{RoomName: "secret", Owner: "bob", Encrypted: true})
+	linkAll(t, servers, "lobby", "secret")
+	ctx := asPeer("a", testFederationSecret)
+	stale := relayed("alice", "lobby", "hi")
+	stale.Message.Timestamp = uint64(time.Now().Add(-time.Hour).Unix())
+	tests := []struct {
+		name string
+		msg  *FederatedMessage
+		want codes.Code
+	}{
+		{"admitted", relayed("alice", "lobby", "hi"), codes.OK},
+		{"muted", relayed("mallory", "lobby", "hi"), codes.PermissionDenied},
+		{"plaintext in an encrypted room", relayed("alice", "secret", "hi"), codes.FailedPrecondition},
+		{"stale", stale, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := b.peer.Relay(ctx, tt.msg); status.Code(err) != tt.want {
+				t.Fatalf("Relay: %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFederationChecksTheRelayingPeer(t *testing.T) {
+	servers := newTestFederation(t, "a", "b", "c")
+	b := servers["b"]
+	b.server.importRoom(&RoomState{RoomName: "lobby", Owner: "bob"})
+	b.server.importRoom(&RoomState{RoomName: "unlinked", Owner: "bob"})
+	linkAll(t, servers, "lobby")
+	spoofed := relayed("alice", "lobby", "hi")
+	spoofed.Origin = "c"
+	skipped := relayed("alice", "lobby", "hi")
+	skipped.Via = []string{"c"}
+	unvisited := relayed("alice", "lobby", "hi")
+	unvisited.Via = nil
+	tests := []struct {
+		name string
+		msg  *FederatedMessage
+		want codes.Code
+	}{
+		{"from a", relayed("alice", "lobby", "hi"), codes.OK},
+		{"through a", &FederatedMessage{RoomName: "lobby", Origin: "c", Via: []string{"c", "a"}, Message: relayed("carol", "lobby", "hi").Message}, codes.OK},
+		{"another origin", spoofed, codes.PermissionDenied},
+		{"not through a", skipped, codes.PermissionDenied},
+		{"no via", unvisited, codes.PermissionDenied},
+		{"unlinked room", relayed("alice", "unlinked", "hi"), codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := b.peer.Relay(asPeer("a", testFederationSecret), tt.msg); status.Code(err) != tt.want {
+				t.Fatalf("Relay: %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFederationKeepsMessageMetadata(t *testing.T) {
+	servers := newTestFederation(t, "a", "b")
+	stream := subscribe(t, servers["b"].chat, "lobby", "bob")
+	waitFor(t, "the room to be created", func() bool { return connected(servers["b"].server, "lobby") == 1 })
+	linkAll(t, servers, "lobby")
+	msg := relayed("alice", "lobby", "hi")
+	msg.Message.Metadata = map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", "lang": "en"}
+	if _, err := servers["b"].peer.Relay(asPeer("a", testFederationSecret), msg); err != nil {
+		t.Fatal(err)
+	}
+	got := receive(t, stream, 1)[0]
+	if got.GetSender() != "alice@a" || got.GetMetadata()["lang"] != "en" || got.GetMetadata()["traceparent"] == "" {
+		t.Errorf("b received %s: %v, want alice@a with the message's metadata", got.GetSender(), got.GetMetadata())
+	}
+}
@@ -0,0 +1,184 @@
+package proto
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type Verdict int
+
+const (
+	// VerdictAllow passes the message on to the next filter unchanged.
+	VerdictAllow Verdict = iota
+	// VerdictReject refuses the message and returns an error to the sender.
+	VerdictReject
+	// VerdictRewrite replaces the message with FilterResult.Message and continues the chain.
+	VerdictRewrite
+	// VerdictQuarantine accepts the message from the sender but holds it back from the room.
+	VerdictQuarantine
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case VerdictAllow:
+		return "allow"
+	case VerdictReject:
+		return "reject"
+	case VerdictRewrite:
+		return "rewrite"
+	case VerdictQuarantine:
+		return "quarantine"
+	}
+	return "unknown"
+}
+
+type FilterResult struct {
+	Verdict Verdict
+	Message *ChatMessage
+	Reason  string
+}
+
+// MessageFilter inspects a message before it is broadcast to its room.
+type MessageFilter interface {
+	Filter(ctx context.Context, msg *ChatMessage) FilterResult
+}
+
+// MessageFilterFunc adapts a plain function to the MessageFilter interface.
+type MessageFilterFunc func(ctx context.Context, msg *ChatMessage) FilterResult
+
+func (f MessageFilterFunc) Filter(ctx context.Context, msg *ChatMessage) FilterResult {
+	return f(ctx, msg)
+}
+
+type QuarantinedMessage struct {
+	Message *ChatMessage
+	Reason  string
+}
+
+// Quarantine holds the most recent messages that a filter kept away from their rooms.
+type Quarantine struct {
+	mu       sync.Mutex
+	messages []QuarantinedMessage
+	capacity int
+}
+
+func NewQuarantine(capacity int) *Quarantine {
+	return &Quarantine{capacity: capacity}
+}
+
+func (q *Quarantine) Add(msg *ChatMessage, reason string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.messages = append(q.messages, QuarantinedMessage{Message: msg, Reason: reason})
+	if len(q.messages) > q.capacity {
+		q.messages = q.messages[len(q.messages)-q.capacity:]
+	}
+}
+
+func (q *Quarantine) Messages() []QuarantinedMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]QuarantinedMessage{}, q.messages...)
+}
+
+// RegisterFilter appends a filter to the end of the chain. Filters run in registration order,
+// and may be registered while the server runs.
+func (s *Server) RegisterFilter(f MessageFilter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filters = append(s.filters, f)
+}
+
+// applyFilters runs the filter chain. It returns the message to broadcast, or nil when the
+// message was quarantined. Messages to encrypted rooms are opaque and skip the chain.
+func (s *Server) applyFilters(ctx context.Context, msg *ChatMessage) (_ *ChatMessage, err error) {
+	if room := s.getRoom(msg.GetRecipient()); room != nil && room.isEncrypted() {
+		return msg, nil
+	}
+	ctx, span := s.tracing().Start(ctx, "filter")
+	defer func() { endSpan(span, err) }()
+	// Appending never changes the filters already in the slice, so the chain can run unlocked.
+	s.mu.RLock()
+	filters := s.filters
+	s.mu.RUnlock()
+	for _, f := range filters {
+		result := f.Filter(ctx, msg)
+		switch result.Verdict {
+		case VerdictReject:
+			return nil, status.Errorf(codes.PermissionDenied, "message rejected: %s", result.Reason)
+		case VerdictRewrite:
+			if result.Message != nil {
+				msg = result.Message
+			}
+		case VerdictQuarantine:
+			s.quarantine.Add(msg, result.Reason)
+			return nil, nil
+		}
+	}
+	return msg, nil
+}
+
+// WordListFilter matches text messages against a list of regular expressions.
+// Matches are either masked out or cause the message to be rejected or quarantined.
+type WordListFilter struct {
+	patterns []*regexp.Regexp
+	verdict  Verdict
+}
+
+// NewWordListFilter loads one pattern per line from path. Blank lines and lines starting
+// with # are ignored, and patterns are matched case-insensitively.
+func NewWordListFilter(path string, verdict Verdict) (*WordListFilter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	filter := &WordListFilter{verdict: verdict}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		re, err := regexp.Compile("(?i)" + line)
+		if err != nil {
+			return nil, err
+		}
+		filter.patterns = append(filter.patterns, re)
+	}
+	return filter, scanner.Err()
+}
+
+func (f *WordListFilter) Filter(_ context.Context, msg *ChatMessage) FilterResult {
+	if !isTextContent(msg.GetContentType()) {
+		return FilterResult{Verdict: VerdictAllow}
+	}
+	content := msg.GetContent()
+	matched := false
+	for _, re := range f.patterns {
+		if !re.Match(content) {
+			continue
+		}
+		matched = true
+		if f.verdict != VerdictRewrite {
+			return FilterResult{Verdict: f.verdict, Reason: "matched word list pattern " + re.String()}
+		}
+		content = re.ReplaceAllFunc(content, func(m []byte) []byte {
+			return []byte(strings.Repeat("*", len([]rune(string(m)))))
+		})
+	}
+	if !matched {
+		return FilterResult{Verdict: VerdictAllow}
+	}
+	masked := proto.Clone(msg).(*ChatMessage)
+	masked.Content = content
+	return FilterResult{Verdict: VerdictRewrite, Message: masked, Reason: "masked word list matches"}
+}
@@ -0,0 +1,148 @@
+package proto
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func writeWordList(t *testing.T, lines string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWordListFilter(t *testing.T) {
+	path := writeWordList(t, "# comment\n\nbad\nw[o0]rse\n")
+	tests := []struct {
+		name    string
+		verdict Verdict
+		msg     *ChatMessage
+		want    Verdict
+		content string
+	}{
+		{"no match", VerdictReject, &ChatMessage{Content: []byte("fine")}, VerdictAllow, ""},
+		{"binary content", VerdictReject, &ChatMessage{Content: []byte("bad"), ContentType: "image/png"}, VerdictAllow, ""},
+		{"reject", VerdictReject, &ChatMessage{Content: []byte("so BAD")}, VerdictReject, ""},
+		{"quarantine", VerdictQuarantine, &ChatMessage{Content: []byte("w0rse")}, VerdictQuarantine, ""},
+		{"rewrite", VerdictRewrite, &ChatMessage{Content: []byte("bad and worse")}, VerdictRewrite, "*** and *****"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewWordListFilter(path, tt.verdict)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := f.Filter(context.Background(), tt.msg)
+			if result.Verdict != tt.want {
+				t.Fatalf("verdict = %s, want %s", result.Verdict, tt.want)
+			}
+			if tt.want == VerdictRewrite && string(result.Message.GetContent()) != tt.content {
+				t.Errorf("content = %q, want %q", result.Message.GetContent(), tt.content)
+			}
+		})
+	}
+}
+
+func TestWordListFilterRewriteKeepsFields(t *testing.T) {
+	f, err := NewWordListFilter(writeWordList(t, "bad\n"), VerdictRewrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &ChatMessage{
+		Sender:    "alice",
+		Recipient: "room",
+		Content:   []byte("bad"),
+		Timestamp: 42,
+		Sequence:  7,
+		Metadata:  map[string]string{"traceparent": "x"},
+	}
+	masked := f.Filter(context.Background(), msg).Message
+	if masked.GetSequence() != 7 || masked.GetMetadata()["traceparent"] != "x" || masked.GetSender() != "alice" {
+		t.Errorf("rewrite dropped fields: %v", masked)
+	}
+	if string(msg.GetContent()) != "bad" {
+		t.Errorf("rewrite modified the original message")
+	}
+}
+
+func TestApplyFilters(t *testing.T) {
+	rewritten := &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte("rewritten")}
+	tests := []struct {
+		name        string
+		verdicts    []Verdict
+		wantCode    codes.Code
+		wantContent string
+		quarantined int
+	}{
+		{"allow", []Verdict{VerdictAllow, VerdictAllow}, codes.OK, "hello", 0},
+		{"reject", []Verdict{VerdictAllow, VerdictReject}, codes.PermissionDenied, "", 0},
+		{"rewrite", []Verdict{VerdictRewrite, VerdictAllow}, codes.OK, "rewritten", 0},
+		{"quarantine", []Verdict{VerdictRewrite, VerdictQuarantine, VerdictReject}, codes.OK, "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			for _, v := range tt.verdicts {
+				v := v
+				s.RegisterFilter(MessageFilterFunc(func(context.Context, *ChatMessage) FilterResult {
+					return FilterResult{Verdict: v, Message: rewritten, Reason: v.String()}
+				}))
+			}
+			msg, err := s.applyFilters(context.Background(), &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte("hello")})
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("err = %v, want %s", err, tt.wantCode)
+			}
+			if got := len(s.quarantine.Messages()); got != tt.quarantined {
+				t.Errorf("quarantined %d messages, want %d", got, tt.quarantined)
+			}
+			if tt.wantContent == "" {
+				if msg != nil {
+					t.Errorf("got message %v, want none", msg)
+				}
+				return
+			}
+			if string(msg.GetContent()) != tt.wantContent {
+				t.Errorf("content = %q, want %q", msg.GetContent(), tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestRegisterFilterWhileServing(t *testing.T) {
+	s := newTestServer(t)
+	filtered := make(chan struct{}, 100)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if _, err := s.applyFilters(context.Background(), &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte("hello")}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		s.RegisterFilter(MessageFilterFunc(func(context.Context, *ChatMessage) FilterResult {
+			select {
+			case filtered <- struct{}{}:
+			default:
+			}
+			return FilterResult{Verdict: VerdictAllow}
+		}))
+	}
+	<-done
+	if _, err := s.applyFilters(context.Background(), &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered) == 0 {
+		t.Error("no registered filter ran")
+	}
+}
@@ -0,0 +1,47 @@
+package proto
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// HashRing assigns keys to nodes with consistent hashing. Every node is placed on the ring
+// several times so that keys spread evenly and only a small share moves when nodes change.
+type HashRing struct {
+	replicas int
+	hashes   []uint32
+	nodes    map[uint32]string
+}
+
+func NewHashRing(replicas int, nodeIDs ...string) *HashRing {
+	r := &HashRing{replicas: replicas, nodes: map[uint32]string{}}
+	for _, id := range nodeIDs {
+		for i := 0; i < replicas; i++ {
+			h := hashKey(id + "#" + strconv.Itoa(i))
+			r.hashes = append(r.hashes, h)
+			r.nodes[h] = id
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+func hashKey(key string) uint32 {
+	sum := sha1.Sum([]byte(key))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+// Get returns the node that owns key, or an empty string if the ring has no nodes.
+func (r *HashRing) Get(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[r.hashes[i]]
+}
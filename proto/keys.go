@@ -0,0 +1,242 @@
+package proto
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// EncryptedContentType marks messages whose content is an EncryptedEnvelope.
+const EncryptedContentType = "application/vnd.chat.encrypted"
+
+// maxOneTimePrekeys bounds the one-time prekeys stored per user.
+const maxOneTimePrekeys = 200
+
+type keyDirectory struct {
+	mu      sync.Mutex
+	bundles map[string]*PublicKeyBundle
+}
+
+// Keys is the public key directory of end-to-end encrypted rooms. It only holds public keys:
+// clients encrypt for each other with them, and the server never sees the plaintext. The first
+// identity key uploaded for a user is kept until an admin resets it, so that nobody can
+// replace the identity of a user that has already published one. Users upload their own keys
+// with their user token, so without user tokens only an admin can upload them. Fetches are
+// rate limited per caller, so that nobody can quickly use up the one-time prekeys of others.
+// The directory is per node, so clients use the keys of the node they are connected to.
+type Keys struct {
+	UnimplementedKeyDirectoryServer
+	server *Server
+}
+
+func NewKeys(server *Server) *Keys {
+	return &Keys{server: server}
+}
+
+func (k *Keys) UploadKeys(ctx context.Context, bundle *PublicKeyBundle) (*Empty, error) {
+	if bundle.GetUserID() == "" || len(bundle.GetIdentityKey()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "userID and identityKey are required")
+	}
+	if k.server.requireAdmin(ctx) != nil {
+		user, err := k.server.authenticatedUser(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if user != bundle.GetUserID() {
+			return nil, status.Errorf(codes.PermissionDenied, "authenticated as %s, not %s", user, bundle.GetUserID())
+		}
+	}
+	if len(bundle.GetSignedPrekey()) > 0 && len(bundle.GetPrekeySignature()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "signedPrekey needs its prekeySignature")
+	}
+	for _, prekey := range bundle.GetOneTimePrekeys() {
+		if len(prekey.GetPublicKey()) == 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "one-time prekey %d is empty", prekey.GetKeyID())
+		}
+	}
+	dir := &k.server.keys
+	dir.mu.Lock()
+	defer dir.mu.Unlock()
+	stored, exists := dir.bundles[bundle.GetUserID()]
+	if !exists {
+		stored = &PublicKeyBundle{UserID: bundle.GetUserID(), IdentityKey: bundle.GetIdentityKey()}
+	} else if !bytes.Equal(stored.GetIdentityKey(), bundle.GetIdentityKey()) {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"%s already has a different identity key, which only an admin can reset", bundle.GetUserID())
+	}
+	known := map[uint32]bool{}
+	for _, prekey := range stored.GetOneTimePrekeys() {
+		known[prekey.GetKeyID()] = true
+	}
+	var added []*OneTimePrekey
+	for _, prekey := range bundle.GetOneTimePrekeys() {
+		if !known[prekey.GetKeyID()] {
+			known[prekey.GetKeyID()] = true
+			added = append(added, prekey)
+		}
+	}
+	if len(stored.GetOneTimePrekeys())+len(added) > maxOneTimePrekeys {
+		return nil, status.Errorf(codes.ResourceExhausted, "at most %d one-time prekeys can be stored", maxOneTimePrekeys)
+	}
+	if len(bundle.GetSignedPrekey()) > 0 {
+		stored.SignedPrekey = bundle.GetSignedPrekey()
+		stored.PrekeySignature = bundle.GetPrekeySignature()
+	}
+	stored.OneTimePrekeys = append(stored.OneTimePrekeys, added...)
+	stored.UpdatedAt = uint64(time.Now().Unix())
+	if dir.bundles == nil {
+		dir.bundles = map[string]*PublicKeyBundle{}
+	}
+	dir.bundles[bundle.GetUserID()] = stored
+	return &Empty{}, nil
+}
+
+// FetchKeys returns the keys of a user with the oldest of their one-time prekeys, which is
+// removed so that no other sender uses it. Once they run out the bundle has none, and senders
+// fall back to the signed prekey alone.
+func (k *Keys) FetchKeys(ctx context.Context, request *KeyRequest) (*PublicKeyBundle, error) {
+	if ok, wait := k.server.limiter.AllowKeyFetch(k.server.caller(ctx)); !ok {
+		retryAfter := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+		_ = grpc.SetTrailer(ctx, metadata.Pairs("retry-after", retryAfter))
+		return nil, status.Errorf(codes.ResourceExhausted, "key fetch rate limit exceeded, retry after %ss", retryAfter)
+	}
+	dir := &k.server.keys
+	dir.mu.Lock()
+	defer dir.mu.Unlock()
+	stored, exists := dir.bundles[request.GetUserID()]
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "%s has not uploaded any keys", request.GetUserID())
+	}
+	bundle := &PublicKeyBundle{
+		UserID:          stored.GetUserID(),
+		IdentityKey:     stored.GetIdentityKey(),
+		SignedPrekey:    stored.GetSignedPrekey(),
+		PrekeySignature: stored.GetPrekeySignature(),
+		UpdatedAt:       stored.GetUpdatedAt(),
+	}
+	if len(stored.OneTimePrekeys) > 0 {
+		bundle.OneTimePrekeys = stored.OneTimePrekeys[:1]
+		stored.OneTimePrekeys = stored.OneTimePrekeys[1:]
+	}
+	return bundle, nil
+}
+
+func (k *Keys) CountPrekeys(ctx context.Context, request *KeyRequest) (*PrekeyCount, error) {
+	dir := &k.server.keys
+	dir.mu.Lock()
+	defer dir.mu.Unlock()
+	stored, exists := dir.bundles[request.GetUserID()]
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "%s has not uploaded any keys", request.GetUserID())
+	}
+	return &PrekeyCount{Count: uint32(len(stored.GetOneTimePrekeys()))}, nil
+}
+
+func (k *Keys) ResetKeys(ctx context.Context, request *KeyRequest) (*Empty, error) {
+	s := k.server
+	if err := s.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	s.keys.mu.Lock()
+	_, exists := s.keys.bundles[request.GetUserID()]
+	delete(s.keys.bundles, request.GetUserID())
+	s.keys.mu.Unlock()
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "%s has not uploaded any keys", request.GetUserID())
+	}
+	s.recordAudit(AuditKeysReset, "", adminActor, request.GetUserID(), "")
+	return &Empty{}, nil
+}
+
+func (s *Server) exportKeys() []*PublicKeyBundle {
+	s.keys.mu.Lock()
+	defer s.keys.mu.Unlock()
+	bundles := make([]*PublicKeyBundle, 0, len(s.keys.bundles))
+	for _, bundle := range s.keys.bundles {
+		bundles = append(bundles, proto.Clone(bundle).(*PublicKeyBundle))
+	}
+	return bundles
+}
+
+func (s *Server) importKeys(bundles []*PublicKeyBundle) {
+	s.keys.mu.Lock()
+	defer s.keys.mu.Unlock()
+	if s.keys.bundles == nil {
+		s.keys.bundles = map[string]*PublicKeyBundle{}
+	}
+	for _, bundle := range bundles {
+		s.keys.bundles[bundle.GetUserID()] = bundle
+	}
+}
+
+// checkEncryption makes encrypted rooms only accept envelopes, and checks that envelopes are
+// addressed to someone. The payloads themselves are opaque.
+func (s *Server) checkEncryption(msg *ChatMessage) error {
+	if msg.GetContentType() == EncryptedContentType {
+		envelope := &EncryptedEnvelope{}
+		if err := proto.Unmarshal(msg.GetContent(), envelope); err != nil {
+			return statusWithViolations(codes.InvalidArgument, "invalid message",
+				[]*errdetails.BadRequest_FieldViolation{violation("content", "must be an EncryptedEnvelope")})
+		}
+		var violations []*errdetails.BadRequest_FieldViolation
+		if len(envelope.GetPayloads()) == 0 {
+			violations = append(violations, violation("content", "must have a payload for at least one recipient"))
+		}
+		for _, payload := range envelope.GetPayloads() {
+			if payload.GetRecipient() == "" || len(payload.GetCiphertext()) == 0 {
+				violations = append(violations, violation("content", "payloads must have a recipient and ciphertext"))
+				break
+			}
+		}
+		if len(violations) > 0 {
+			return statusWithViolations(codes.InvalidArgument, "invalid message", violations)
+		}
+		return nil
+	}
+	if room := s.getRoom(msg.GetRecipient()); room != nil && room.isEncrypted() {
+		return status.Errorf(codes.FailedPrecondition,
+			"%s is end-to-end encrypted and only accepts %s messages", msg.GetRecipient(), EncryptedContentType)
+	}
+	return nil
+}
+
+func (r *Room) isEncrypted() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.encrypted
+}
+
+// sealedFor returns msg as delivered to clientID: an envelope keeps only the payload encrypted
+// for them, and is nil if there is none. Other messages are returned as they are.
+func sealedFor(msg *ChatMessage, clientID string) *ChatMessage {
+	if msg.GetContentType() != EncryptedContentType {
+		return msg
+	}
+	envelope := &EncryptedEnvelope{}
+	if err := proto.Unmarshal(msg.GetContent(), envelope); err != nil {
+		return nil
+	}
+	for _, payload := range envelope.GetPayloads() {
+		if payload.GetRecipient() != clientID {
+			continue
+		}
+		content, err := proto.Marshal(&EncryptedEnvelope{Payloads: []*EncryptedPayload{payload}})
+		if err != nil {
+			return nil
+		}
+		sealed := proto.Clone(msg).(*ChatMessage)
+		sealed.Content = content
+		return sealed
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package proto
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func bundleOf(userID string, prekeys ...uint32) *PublicKeyBundle {
+	bundle := &PublicKeyBundle{UserID: userID, IdentityKey: []byte("identity of " + userID)}
+	for _, id := range prekeys {
+		bundle.OneTimePrekeys = append(bundle.OneTimePrekeys, &OneTimePrekey{KeyID: id, PublicKey: []byte{byte(id)}})
+	}
+	return bundle
+}
+
+func TestUploadKeysRequiresTheUser(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.UserTokenSecret = "secret"
+		cfg.AdminToken = "admin"
+	})
+	keys := NewKeys(s)
+	as := func(key, value string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(key, value))
+	}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{"no token", context.Background(), codes.Unauthenticated},
+		{"forged token", as(userTokenKey, "alice.forged"), codes.Unauthenticated},
+		{"another user", as(userTokenKey, IssueUserToken("secret", "mallory")), codes.PermissionDenied},
+		{"the user", as(userTokenKey, IssueUserToken("secret", "alice")), codes.OK},
+		{"admin", as("admin-token", "admin"), codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := keys.UploadKeys(tt.ctx, bundleOf("alice", 1)); status.Code(err) != tt.want {
+				t.Fatalf("UploadKeys: %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadKeysIsAdminOnlyWithoutUserTokens(t *testing.T) {
+	s := newTestServer(t)
+	if _, err := NewKeys(s).UploadKeys(context.Background(), bundleOf("alice")); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("UploadKeys: %v, want PermissionDenied", err)
+	}
+}
+
+func TestFetchKeysIsRateLimitedPerCaller(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.UserTokenSecret = "secret"
+		cfg.RateLimit.KeyFetch = RateLimit{Rate: 0.001, Burst: 2}
+	})
+	keys := NewKeys(s)
+	as := func(user string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(userTokenKey, IssueUserToken("secret", user)))
+	}
+	if _, err := keys.UploadKeys(as("alice"), bundleOf("alice", 1, 2, 3, 4)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := keys.FetchKeys(as("mallory"), &KeyRequest{UserID: "alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := keys.FetchKeys(as("mallory"), &KeyRequest{UserID: "alice"}); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("FetchKeys over the limit: %v, want ResourceExhausted", err)
+	}
+	bundle, err := keys.FetchKeys(as("bob"), &KeyRequest{UserID: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bundle.GetOneTimePrekeys(); len(got) != 1 || got[0].GetKeyID() != 3 {
+		t.Errorf("bob received the one-time prekeys %v, want the third", got)
+	}
+}
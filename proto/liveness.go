@@ -0,0 +1,94 @@
+package proto
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+// HeartbeatContentType marks the messages the server sends to idle subscribers to check that
+// they are still reading. Clients should discard them.
+const HeartbeatContentType = "application/vnd.chat.heartbeat"
+
+type LivenessConfig struct {
+	// HeartbeatInterval is how often a heartbeat is queued for each subscriber. 0 disables heartbeats.
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval" toml:"heartbeat_interval"`
+	// MissThreshold is how many heartbeats in a row may still be waiting in a subscriber's
+	// queue before it is disconnected.
+	MissThreshold int `yaml:"miss_threshold" toml:"miss_threshold"`
+	// QueueSize is how many live messages may wait to be sent to a subscriber. Subscribers that
+	// fall further behind are disconnected.
+	QueueSize int `yaml:"queue_size" toml:"queue_size"`
+	// KeepaliveTime and KeepaliveTimeout control the transport pings sent to idle clients.
+	KeepaliveTime    time.Duration `yaml:"keepalive_time" toml:"keepalive_time"`
+	KeepaliveTimeout time.Duration `yaml:"keepalive_timeout" toml:"keepalive_timeout"`
+	// MinPingInterval is the shortest interval between client pings the server tolerates.
+	MinPingInterval     time.Duration `yaml:"min_ping_interval" toml:"min_ping_interval"`
+	PermitWithoutStream bool          `yaml:"permit_without_stream" toml:"permit_without_stream"`
+}
+
+// ServerOptions returns the keepalive parameters and enforcement policy for a grpc.Server.
+// Clients pinging more often than MinPingInterval are disconnected by the transport.
+func (c LivenessConfig) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    c.KeepaliveTime,
+			Timeout: c.KeepaliveTimeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             c.MinPingInterval,
+			PermitWithoutStream: c.PermitWithoutStream,
+		}),
+	}
+}
+
+func heartbeatMessage() *ChatMessage {
+	return &ChatMessage{
+		Sender:      "GATEWAY",
+		Recipient:   "",
+		ContentType: HeartbeatContentType,
+		Timestamp:   uint64(time.Now().Unix()),
+	}
+}
+
+// awaitDisconnect blocks until the subscription ends, queueing a heartbeat every interval.
+// A heartbeat that is still queued when the next one is due counts as a miss, and the
+// subscriber is disconnected once MissThreshold heartbeats in a row were missed.
+func (s *Server) awaitDisconnect(ctx context.Context, conn *ClientConnection) error {
+	cfg := s.config.Load().Liveness
+	var heartbeats <-chan time.Time
+	if cfg.HeartbeatInterval > 0 {
+		ticker := time.NewTicker(cfg.HeartbeatInterval)
+		defer ticker.Stop()
+		heartbeats = ticker.C
+	}
+	var queued uint64
+	misses := 0
+	for {
+		select {
+		case err := <-conn.errChan:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-heartbeats:
+			if conn.heartbeatsSent.Load() < queued {
+				misses++
+				if misses >= cfg.MissThreshold {
+					return status.Errorf(codes.Unavailable, "missed %d heartbeats", misses)
+				}
+				continue
+			}
+			misses = 0
+			if s.isDraining() {
+				continue
+			}
+			if conn.enqueue(heartbeatMessage(), nil) {
+				queued++
+			}
+		}
+	}
+}
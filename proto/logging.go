@@ -0,0 +1,163 @@
+package proto
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const requestIDKey = "x-request-id"
+
+// NewLogger builds a logger writing to w in the json or text format. Pass a *slog.LevelVar
+// as level to change the level while the server runs.
+func NewLogger(w io.Writer, level slog.Leveler, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if strings.EqualFold(format, "text") {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// SetLogger replaces the logger used by the server. By default it logs through slog.Default.
+// Rooms that already exist keep logging through the logger they were created with.
+func (s *Server) SetLogger(logger *slog.Logger) {
+	s.logger.Store(logger)
+}
+
+type loggerKey struct{}
+
+// loggerFromContext returns the request-scoped logger stored by the logging interceptors,
+// falling back to the server's logger outside of an RPC.
+func (s *Server) loggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return s.logger.Load()
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestAttrs picks the room and client out of a request, for every request type that has them.
+func requestAttrs(req interface{}) []any {
+	switch r := req.(type) {
+	case *RoomRequest:
+		return []any{"room", r.GetRoomName(), "client_id", r.GetInitialConnectionRequest().GetServerID()}
+	case *ChatMessage:
+		return []any{"room", r.GetRecipient(), "client_id", r.GetSender()}
+	case *ModerationRequest:
+		return []any{"room", r.GetRoomName(), "client_id", r.GetModerator(), "target", r.GetTarget()}
+	case *SlowModeRequest:
+		return []any{"room", r.GetRoomName(), "client_id", r.GetModerator()}
+	case *KeyRequest:
+		return []any{"target", r.GetUserID()}
+	case *PublicKeyBundle:
+		return []any{"client_id", r.GetUserID()}
+	case *ConnectionRequest:
+		return []any{"client_id", r.GetServerID()}
+	case *ForceDisconnectRequest:
+		return []any{"room", r.GetRoomName(), "client_id", r.GetClientID()}
+	case *CloseRoomRequest:
+		return []any{"room", r.GetRoomName()}
+	case *AnnouncementRequest:
+		return []any{"room", r.GetRoomName()}
+	case *RoomStateRequest:
+		return []any{"room", r.GetRoomName()}
+	case *ListConnectionsRequest:
+		return []any{"room", r.GetRoomName()}
+	}
+	return nil
+}
+
+// rpcLogger returns a logger carrying the method, peer address and request ID of the call.
+// The request ID is taken from the x-request-id metadata or generated, and echoed back in the
+// response header.
+func (s *Server) rpcLogger(ctx context.Context, method string) (*slog.Logger, string) {
+	requestID := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDKey); len(ids) > 0 {
+			requestID = ids[0]
+		}
+	}
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+	return s.logger.Load().With("method", method, "peer", clientAddress(ctx), "request_id", requestID), requestID
+}
+
+func logRPC(logger *slog.Logger, started time.Time, err error) {
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelWarn
+	}
+	logger.Log(context.Background(), level, "rpc finished",
+		"code", status.Code(err).String(),
+		"duration", time.Since(started),
+		"error", errorString(err))
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// LoggingUnaryInterceptor logs every unary RPC and stores a request-scoped logger in its context.
+func (s *Server) LoggingUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		started := time.Now()
+		logger, requestID := s.rpcLogger(ctx, info.FullMethod)
+		logger = logger.With(requestAttrs(req)...)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, requestID))
+		resp, err := handler(context.WithValue(ctx, loggerKey{}, logger), req)
+		logRPC(logger, started, err)
+		return resp, err
+	}
+}
+
+// loggedStream adds the attributes of the first received request to the stream's logger.
+type loggedStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	logger *slog.Logger
+}
+
+func (l *loggedStream) Context() context.Context {
+	return l.ctx
+}
+
+func (l *loggedStream) RecvMsg(m interface{}) error {
+	err := l.ServerStream.RecvMsg(m)
+	if err == nil {
+		if attrs := requestAttrs(m); attrs != nil {
+			l.logger = l.logger.With(attrs...)
+			l.ctx = context.WithValue(l.ctx, loggerKey{}, l.logger)
+		}
+	}
+	return err
+}
+
+// LoggingStreamInterceptor logs every streaming RPC once it ends.
+func (s *Server) LoggingStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		started := time.Now()
+		logger, requestID := s.rpcLogger(ss.Context(), info.FullMethod)
+		_ = ss.SetHeader(metadata.Pairs(requestIDKey, requestID))
+		stream := &loggedStream{ServerStream: ss, ctx: context.WithValue(ss.Context(), loggerKey{}, logger), logger: logger}
+		err := handler(srv, stream)
+		logRPC(stream.logger, started, err)
+		return err
+	}
+}
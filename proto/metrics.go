@@ -0,0 +1,182 @@
+package proto
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Metrics holds the server's Prometheus collectors. A nil *Metrics records nothing, so rooms
+// created outside of a Server don't need one.
+type Metrics struct {
+	registry      *prometheus.Registry
+	messagesSent  prometheus.Counter
+	broadcasts    prometheus.Counter
+	dropped       *prometheus.CounterVec
+	sendLatency   prometheus.Histogram
+	cleanupSweeps *prometheus.HistogramVec
+	rpcHandled    *prometheus.CounterVec
+	rpcLatency    *prometheus.HistogramVec
+	webhooks      *prometheus.CounterVec
+	activeRooms   *prometheus.Desc
+	connections   *prometheus.Desc
+	throttled     *prometheus.Desc
+	server        *Server
+}
+
+func newMetrics(s *Server) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		messagesSent: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "chat_messages_sent_total",
+			Help: "Messages accepted by SendMessage.",
+		}),
+		broadcasts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "chat_messages_broadcast_total",
+			Help: "Messages delivered to a single subscriber.",
+		}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chat_messages_dropped_total",
+			Help: "Messages that were not delivered, by reason.",
+		}, []string{"reason"}),
+		sendLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "chat_send_duration_seconds",
+			Help:    "Time taken to send a message on a subscriber's stream.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}),
+		cleanupSweeps: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "chat_cleanup_sweep_duration_seconds",
+			Help:    "Time taken by a cleanup sweep, by kind of sweep.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, []string{"kind"}),
+		rpcHandled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "RPCs completed on the server, by method and status code.",
+		}, []string{"method", "code"}),
+		rpcLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Time taken to complete an RPC, by method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+		webhooks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chat_webhook_events_total",
+			Help: "Webhook events delivered or dead-lettered, by result.",
+		}, []string{"result"}),
+		activeRooms: prometheus.NewDesc("chat_active_rooms", "Rooms on this node.", nil, nil),
+		connections: prometheus.NewDesc("chat_room_connections", "Subscribers connected to a room on this node.", []string{"room"}, nil),
+		throttled:   prometheus.NewDesc("chat_throttled_requests_total", "SendMessage calls rejected by a rate limit, by scope.", []string{"scope"}, nil),
+		server:      s,
+	}
+	m.registry.MustRegister(
+		m.messagesSent,
+		m.broadcasts,
+		m.dropped,
+		m.sendLatency,
+		m.cleanupSweeps,
+		m.rpcHandled,
+		m.rpcLatency,
+		m.webhooks,
+		m,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.activeRooms
+	ch <- m.connections
+	ch <- m.throttled
+}
+
+// Collect reports the gauges that are read from the room registry at scrape time.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	s := m.server
+	s.mu.RLock()
+	ch <- prometheus.MustNewConstMetric(m.activeRooms, prometheus.GaugeValue, float64(len(s.roomsMap)))
+	for name, room := range s.roomsMap {
+		room.mu.Lock()
+		ch <- prometheus.MustNewConstMetric(m.connections, prometheus.GaugeValue, float64(len(room.connections)), name)
+		room.mu.Unlock()
+	}
+	s.mu.RUnlock()
+	for scope, count := range s.limiter.Throttled() {
+		ch <- prometheus.MustNewConstMetric(m.throttled, prometheus.CounterValue, float64(count), scope)
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) messageSent() {
+	if m != nil {
+		m.messagesSent.Inc()
+	}
+}
+
+func (m *Metrics) messageDropped(reason string) {
+	if m != nil {
+		m.dropped.WithLabelValues(reason).Inc()
+	}
+}
+
+func (m *Metrics) observeSend(started time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.sendLatency.Observe(time.Since(started).Seconds())
+	if err != nil {
+		m.dropped.WithLabelValues("send_failed").Inc()
+		return
+	}
+	m.broadcasts.Inc()
+}
+
+func (m *Metrics) observeSweep(kind string, started time.Time) {
+	if m != nil {
+		m.cleanupSweeps.WithLabelValues(kind).Observe(time.Since(started).Seconds())
+	}
+}
+
+func (m *Metrics) observeRPC(method string, started time.Time, err error) {
+	m.rpcHandled.WithLabelValues(method, status.Code(err).String()).Inc()
+	m.rpcLatency.WithLabelValues(method).Observe(time.Since(started).Seconds())
+}
+
+// UnaryServerInterceptor counts unary RPCs and measures their latency.
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		started := time.Now()
+		resp, err := handler(ctx, req)
+		m.observeRPC(info.FullMethod, started, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor counts streaming RPCs and measures how long they stay open.
+func (m *Metrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		started := time.Now()
+		err := handler(srv, ss)
+		m.observeRPC(info.FullMethod, started, err)
+		return err
+	}
+}
+
+// Metrics returns the server's Prometheus collectors.
+func (s *Server) Metrics() *Metrics {
+	return s.metrics
+}
+
+func (m *Metrics) webhookDelivered(result string) {
+	if m != nil {
+		m.webhooks.WithLabelValues(result).Inc()
+	}
+}
@@ -0,0 +1,105 @@
+package proto
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/grpc"
+)
+
+// scrape fetches the metrics of s the way Prometheus does.
+func scrape(t *testing.T, s *Server) map[string]*dto.MetricFamily {
+	t.Helper()
+	server := httptest.NewServer(s.Metrics().Handler())
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		t.Fatalf("parsing the scrape: %v", err)
+	}
+	return families
+}
+
+// value returns the value of the metric of families named name with the given labels, and
+// whether there is one.
+func value(families map[string]*dto.MetricFamily, name string, labels ...string) (float64, bool) {
+	family, exists := families[name]
+	if !exists {
+		return 0, false
+	}
+metrics:
+	for _, metric := range family.GetMetric() {
+		pairs := map[string]string{}
+		for _, label := range metric.GetLabel() {
+			pairs[label.GetName()] = label.GetValue()
+		}
+		for i := 0; i+1 < len(labels); i += 2 {
+			if pairs[labels[i]] != labels[i+1] {
+				continue metrics
+			}
+		}
+		switch {
+		case metric.GetCounter() != nil:
+			return metric.GetCounter().GetValue(), true
+		case metric.GetGauge() != nil:
+			return metric.GetGauge().GetValue(), true
+		case metric.GetHistogram() != nil:
+			return float64(metric.GetHistogram().GetSampleCount()), true
+		}
+	}
+	return 0, false
+}
+
+func TestMetricsScrape(t *testing.T) {
+	s := newTestServer(t)
+	m := s.Metrics()
+	chat := NewChatServiceClient(dialTestServerWith(t, s, []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(m.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(m.StreamServerInterceptor()),
+	}))
+	alice := subscribe(t, chat, "room", "alice")
+	waitFor(t, "the room to be created", func() bool { return connected(s, "room") == 1 })
+	send(t, chat, "alice", "room", "one")
+	send(t, chat, "alice", "room", "two")
+	receive(t, alice, 2)
+	if _, err := chat.SendMessage(context.Background(), &ChatMessage{Recipient: "room"}); err == nil {
+		t.Fatal("a message without a sender was accepted")
+	}
+
+	sendMessage := "/" + ChatService_ServiceDesc.ServiceName + "/SendMessage"
+	tests := []struct {
+		name   string
+		labels []string
+		want   float64
+	}{
+		{"chat_messages_sent_total", nil, 2},
+		{"chat_active_rooms", nil, 1},
+		{"chat_room_connections", []string{"room", "room"}, 1},
+		{"grpc_server_handled_total", []string{"method", sendMessage, "code", "OK"}, 2},
+		{"grpc_server_handled_total", []string{"method", sendMessage, "code", "InvalidArgument"}, 1},
+		{"grpc_server_handling_seconds", []string{"method", sendMessage}, 3},
+	}
+	families := scrape(t, s)
+	for _, tt := range tests {
+		if got, exists := value(families, tt.name, tt.labels...); !exists || got != tt.want {
+			t.Errorf("%s%v = %v (exported: %t), want %v", tt.name, tt.labels, got, exists, tt.want)
+		}
+	}
+	// The writer counts a delivery once the send returns, which may be after the client received it.
+	waitFor(t, "the deliveries to be counted", func() bool {
+		delivered, _ := value(scrape(t, s), "chat_messages_broadcast_total")
+		return delivered == 2
+	})
+	if _, exists := families["go_goroutines"]; !exists {
+		t.Error("the Go runtime metrics are not exported")
+	}
+}
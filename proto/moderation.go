@@ -0,0 +1,197 @@
+package proto
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// expiry turns a duration in seconds into an expiry time. A zero time means the action never expires.
+func expiry(seconds uint64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(seconds) * time.Second)
+}
+
+// activeUntil reports whether the entry for clientID exists and has not expired yet.
+// Expired entries are removed. The caller must hold r.mu.
+func activeUntil(entries map[string]time.Time, clientID string) bool {
+	until, exists := entries[clientID]
+	if !exists {
+		return false
+	}
+	if !until.IsZero() && time.Now().After(until) {
+		delete(entries, clientID)
+		return false
+	}
+	return true
+}
+
+func (r *Room) isBanned(clientID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return activeUntil(r.bans, clientID)
+}
+
+// moderatedRoom returns the room and the moderator to record if the caller may moderate it:
+// either its owner, authenticated by a user token, or an admin. A moderator named in the
+// request must be the authenticated user.
+func (s *Server) moderatedRoom(ctx context.Context, roomID, claimed string) (*Room, string, error) {
+	room := s.getRoom(roomID)
+	if room == nil {
+		return nil, "", status.Errorf(codes.NotFound, "room %s does not exist", roomID)
+	}
+	if s.requireAdmin(ctx) == nil {
+		return room, adminActor, nil
+	}
+	moderator, err := s.authenticatedUser(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if claimed != "" && claimed != moderator {
+		return nil, "", status.Errorf(codes.PermissionDenied, "authenticated as %s, not %s", moderator, claimed)
+	}
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if room.owner != moderator {
+		return nil, "", status.Errorf(codes.PermissionDenied, "only the owner of %s can moderate it", roomID)
+	}
+	return room, moderator, nil
+}
+
+// removeFromRoom queues a system message with the reason for the target and ends their Subscribe call.
+func (r *Room) removeFromRoom(target, action, reason string) bool {
+	conn := r.removeConnection(target)
+	if conn == nil {
+		return false
+	}
+	content := fmt.Sprintf("you were %s", action)
+	if reason != "" {
+		content += ": " + reason
+	}
+	conn.enqueue(&ChatMessage{
+		Sender:    "GATEWAY",
+		Recipient: target,
+		Content:   []byte(content),
+		Timestamp: uint64(time.Now().Unix()),
+	}, nil)
+	r.logger.Info("user removed", "client_id", target, "action", action, "reason", reason)
+	conn.disconnect(status.Error(codes.PermissionDenied, content))
+	r.BroadcastMessage(&ChatMessage{
+		Sender:    "GATEWAY",
+		Recipient: "",
+		Content:   []byte(fmt.Sprintf("%s was %s.", target, action)),
+		Timestamp: uint64(time.Now().Unix()),
+	})
+	return true
+}
+
+func moderationDetail(request *ModerationRequest) string {
+	if request.GetDurationSeconds() == 0 {
+		return request.GetReason()
+	}
+	return fmt.Sprintf("%s (for %s)", request.GetReason(), time.Duration(request.GetDurationSeconds())*time.Second)
+}
+
+func (s *Server) KickUser(ctx context.Context, request *ModerationRequest) (*Empty, error) {
+	if client, ctx, forward := s.forwardTarget(ctx, request.GetRoomName()); forward {
+		return client.KickUser(ctx, request)
+	}
+	room, moderator, err := s.moderatedRoom(ctx, request.GetRoomName(), request.GetModerator())
+	if err != nil {
+		return nil, err
+	}
+	if !room.removeFromRoom(request.GetTarget(), "kicked", request.GetReason()) {
+		return nil, status.Errorf(codes.NotFound, "%s is not in %s", request.GetTarget(), request.GetRoomName())
+	}
+	s.recordAudit(AuditKick, request.GetRoomName(), moderator, request.GetTarget(), request.GetReason())
+	return &Empty{}, nil
+}
+
+func (s *Server) BanUser(ctx context.Context, request *ModerationRequest) (*Empty, error) {
+	if client, ctx, forward := s.forwardTarget(ctx, request.GetRoomName()); forward {
+		return client.BanUser(ctx, request)
+	}
+	room, moderator, err := s.moderatedRoom(ctx, request.GetRoomName(), request.GetModerator())
+	if err != nil {
+		return nil, err
+	}
+	room.mu.Lock()
+	if request.GetTarget() == room.owner {
+		room.mu.Unlock()
+		return nil, status.Error(codes.InvalidArgument, "the room owner can't be banned")
+	}
+	room.bans[request.GetTarget()] = expiry(request.GetDurationSeconds())
+	room.mu.Unlock()
+	room.removeFromRoom(request.GetTarget(), "banned", request.GetReason())
+	s.recordAudit(AuditBan, request.GetRoomName(), moderator, request.GetTarget(), moderationDetail(request))
+	return &Empty{}, nil
+}
+
+func (s *Server) MuteUser(ctx context.Context, request *ModerationRequest) (*Empty, error) {
+	if client, ctx, forward := s.forwardTarget(ctx, request.GetRoomName()); forward {
+		return client.MuteUser(ctx, request)
+	}
+	room, moderator, err := s.moderatedRoom(ctx, request.GetRoomName(), request.GetModerator())
+	if err != nil {
+		return nil, err
+	}
+	room.mu.Lock()
+	room.mutes[request.GetTarget()] = expiry(request.GetDurationSeconds())
+	room.mu.Unlock()
+	s.recordAudit(AuditMute, request.GetRoomName(), moderator, request.GetTarget(), moderationDetail(request))
+	return &Empty{}, nil
+}
+
+func (s *Server) SetSlowMode(ctx context.Context, request *SlowModeRequest) (*Empty, error) {
+	if client, ctx, forward := s.forwardTarget(ctx, request.GetRoomName()); forward {
+		return client.SetSlowMode(ctx, request)
+	}
+	room, moderator, err := s.moderatedRoom(ctx, request.GetRoomName(), request.GetModerator())
+	if err != nil {
+		return nil, err
+	}
+	interval := time.Duration(request.GetIntervalSeconds()) * time.Second
+	room.mu.Lock()
+	room.slowMode = interval
+	room.mu.Unlock()
+	s.recordAudit(AuditSlowMode, request.GetRoomName(), moderator, "", interval.String())
+	return &Empty{}, nil
+}
+
+// checkModeration rejects messages from banned and muted users and from users sending faster
+// than the room's slow mode allows. The room owner is exempt from slow mode.
+func (s *Server) checkModeration(ctx context.Context, msg *ChatMessage) error {
+	room := s.getRoom(msg.GetRecipient())
+	if room == nil {
+		return nil
+	}
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	sender := msg.GetSender()
+	if activeUntil(room.bans, sender) {
+		return status.Errorf(codes.PermissionDenied, "%s is banned from %s", sender, msg.GetRecipient())
+	}
+	if activeUntil(room.mutes, sender) {
+		return status.Errorf(codes.PermissionDenied, "%s is muted in %s", sender, msg.GetRecipient())
+	}
+	if room.slowMode == 0 || sender == room.owner {
+		return nil
+	}
+	now := time.Now()
+	if wait := room.lastSent[sender].Add(room.slowMode).Sub(now); wait > 0 {
+		retryAfter := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+		_ = grpc.SetTrailer(ctx, metadata.Pairs("retry-after", retryAfter))
+		return status.Errorf(codes.ResourceExhausted, "slow mode is on in %s, retry after %ss", msg.GetRecipient(), retryAfter)
+	}
+	room.lastSent[sender] = now
+	return nil
+}
@@ -0,0 +1,113 @@
+package proto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestModerationRequiresTheOwnersToken(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.UserTokenSecret = "secret"
+		cfg.AdminToken = "admin"
+	})
+	s.importRoom(&RoomState{RoomName: "room", Owner: "alice"})
+	as := func(key, value string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(key, value))
+	}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		req  *ModerationRequest
+		want codes.Code
+	}{
+		{"no token", context.Background(), &ModerationRequest{RoomName: "room", Moderator: "alice", Target: "bob"}, codes.Unauthenticated},
+		{"forged token", as(userTokenKey, "alice.forged"), &ModerationRequest{RoomName: "room", Target: "bob"}, codes.Unauthenticated},
+		{"claims the owner", as(userTokenKey, IssueUserToken("secret", "mallory")), &ModerationRequest{RoomName: "room", Moderator: "alice", Target: "bob"}, codes.PermissionDenied},
+		{"not the owner", as(userTokenKey, IssueUserToken("secret", "mallory")), &ModerationRequest{RoomName: "room", Target: "bob"}, codes.PermissionDenied},
+		{"owner", as(userTokenKey, IssueUserToken("secret", "alice")), &ModerationRequest{RoomName: "room", Target: "bob"}, codes.OK},
+		{"ban the owner", as(userTokenKey, IssueUserToken("secret", "alice")), &ModerationRequest{RoomName: "room", Target: "alice"}, codes.InvalidArgument},
+		{"admin", as("admin-token", "admin"), &ModerationRequest{RoomName: "room", Target: "carol"}, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.BanUser(tt.ctx, tt.req)
+			if status.Code(err) != tt.want {
+				t.Fatalf("BanUser: %v, want %s", err, tt.want)
+			}
+		})
+	}
+	if !s.getRoom("room").isBanned("bob") || !s.getRoom("room").isBanned("carol") {
+		t.Error("the owner's and the admin's bans were not applied")
+	}
+}
+
+func TestModerationIsAdminOnlyWithoutUserTokens(t *testing.T) {
+	s := newTestServer(t)
+	s.importRoom(&RoomState{RoomName: "room", Owner: "alice"})
+	_, err := s.MuteUser(context.Background(), &ModerationRequest{RoomName: "room", Moderator: "alice", Target: "bob"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("MuteUser: %v, want PermissionDenied", err)
+	}
+}
+
+func TestOnlyTheOwnerSetsTheTopic(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.UserTokenSecret = "secret"
+		cfg.AdminToken = "admin"
+	})
+	s.importRoom(&RoomState{RoomName: "room", Owner: "alice"})
+	as := func(key, value string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(key, value))
+	}
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		sender string
+		want   codes.Code
+	}{
+		{"member", as(userTokenKey, IssueUserToken("secret", "bob")), "bob", codes.PermissionDenied},
+		{"owner", as(userTokenKey, IssueUserToken("secret", "alice")), "alice", codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := setTopic(s, tt.ctx, tt.sender, tt.name+"'s topic"); status.Code(err) != tt.want {
+				t.Fatalf("/topic: %v, want %s", err, tt.want)
+			}
+		})
+	}
+	if got := topicOf(s, "room"); got != "owner's topic" {
+		t.Errorf("the topic is %q, want the owner's", got)
+	}
+}
+
+func TestTopicIsAdminOnlyWithoutUserTokens(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) { cfg.AdminToken = "admin" })
+	s.importRoom(&RoomState{RoomName: "room", Owner: "alice"})
+	if err := setTopic(s, context.Background(), "alice", "forged"); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("/topic sent as the owner: %v, want PermissionDenied", err)
+	}
+	admin := metadata.NewIncomingContext(context.Background(), metadata.Pairs("admin-token", "admin"))
+	if err := setTopic(s, admin, "bob", "moved"); err != nil {
+		t.Fatalf("/topic sent by the admin: %v", err)
+	}
+	if got := topicOf(s, "room"); got != "moved" {
+		t.Errorf("the topic is %q, want the admin's", got)
+	}
+}
+
+func setTopic(s *Server, ctx context.Context, sender, topic string) error {
+	_, err := s.SendMessage(ctx, &ChatMessage{Sender: sender, Recipient: "room", Content: []byte("/topic " + topic), Timestamp: uint64(time.Now().Unix())})
+	return err
+}
+
+func topicOf(s *Server, roomID string) string {
+	room := s.getRoom(roomID)
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	return room.topic
+}
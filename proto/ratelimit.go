@@ -0,0 +1,166 @@
+package proto
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	LimitBySender = "sender"
+	LimitByRoom   = "room"
+	// LimitByGateway limits each calling client, identified by its user token or its address.
+	LimitByGateway = "gateway"
+	// LimitByKeyFetch limits the one-time prekeys each caller can use up.
+	LimitByKeyFetch = "key_fetch"
+)
+
+// RateLimit describes a single token bucket: Rate tokens are refilled every second, up to Burst.
+// A zero Rate disables the limit.
+type RateLimit struct {
+	Rate  float64 `yaml:"rate" toml:"rate"`
+	Burst int     `yaml:"burst" toml:"burst"`
+}
+
+type RateLimitConfig struct {
+	Sender  RateLimit `yaml:"sender" toml:"sender"`
+	Room    RateLimit `yaml:"room" toml:"room"`
+	Gateway RateLimit `yaml:"gateway" toml:"gateway"`
+	// KeyFetch limits FetchKeys calls per caller.
+	KeyFetch RateLimit `yaml:"key_fetch" toml:"key_fetch"`
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket and consumes one token. When the bucket is empty it
+// returns how long the caller has to wait for the next token.
+func (b *bucket) take(limit RateLimit, now time.Time) (bool, time.Duration) {
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+}
+
+type keyedLimiter struct {
+	limit     RateLimit
+	buckets   map[string]*bucket
+	throttled uint64
+}
+
+// RateLimiter keeps one token bucket per sender, room and gateway, and per caller fetching keys.
+type RateLimiter struct {
+	mu     sync.Mutex
+	scopes map[string]*keyedLimiter
+}
+
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		scopes: map[string]*keyedLimiter{
+			LimitBySender:   {limit: cfg.Sender, buckets: map[string]*bucket{}},
+			LimitByRoom:     {limit: cfg.Room, buckets: map[string]*bucket{}},
+			LimitByGateway:  {limit: cfg.Gateway, buckets: map[string]*bucket{}},
+			LimitByKeyFetch: {limit: cfg.KeyFetch, buckets: map[string]*bucket{}},
+		},
+	}
+}
+
+// SetConfig replaces the limits. Buckets keep their tokens, capped at the new bursts as
+// they refill.
+func (l *RateLimiter) SetConfig(cfg RateLimitConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.scopes[LimitBySender].limit = cfg.Sender
+	l.scopes[LimitByRoom].limit = cfg.Room
+	l.scopes[LimitByGateway].limit = cfg.Gateway
+	l.scopes[LimitByKeyFetch].limit = cfg.KeyFetch
+}
+
+// Allow checks the sender, room and gateway buckets in that order. If any of them is empty
+// the request is rejected and the scope that throttled it is returned together with the
+// time after which a retry may succeed. Tokens are only consumed when every scope allows it.
+func (l *RateLimiter) Allow(sender, room, gateway string) (bool, string, time.Duration) {
+	return l.allow(
+		limitKey{LimitBySender, sender},
+		limitKey{LimitByRoom, room},
+		limitKey{LimitByGateway, gateway},
+	)
+}
+
+// AllowKeyFetch checks the bucket of a caller fetching someone's keys, and returns the time
+// after which a retry may succeed when it is empty.
+func (l *RateLimiter) AllowKeyFetch(caller string) (bool, time.Duration) {
+	ok, _, wait := l.allow(limitKey{LimitByKeyFetch, caller})
+	return ok, wait
+}
+
+type limitKey struct{ scope, key string }
+
+func (l *RateLimiter) allow(keys ...limitKey) (bool, string, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	taken := make([]*bucket, 0, len(keys))
+	for _, k := range keys {
+		limiter := l.scopes[k.scope]
+		if limiter.limit.Rate == 0 {
+			continue
+		}
+		b, exists := limiter.buckets[k.key]
+		if !exists {
+			b = &bucket{tokens: float64(limiter.limit.Burst), last: now}
+			limiter.buckets[k.key] = b
+		}
+		if ok, wait := b.take(limiter.limit, now); !ok {
+			for _, t := range taken {
+				t.tokens++
+			}
+			atomic.AddUint64(&limiter.throttled, 1)
+			return false, k.scope, wait
+		}
+		taken = append(taken, b)
+	}
+	return true, "", 0
+}
+
+// Throttled returns the number of rejected requests per scope.
+func (l *RateLimiter) Throttled() map[string]uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	counts := map[string]uint64{}
+	for scope, limiter := range l.scopes {
+		counts[scope] = atomic.LoadUint64(&limiter.throttled)
+	}
+	return counts
+}
+
+// prune drops buckets that have been idle long enough to be full again.
+func (l *RateLimiter) prune() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for _, limiter := range l.scopes {
+		if limiter.limit.Rate == 0 {
+			continue
+		}
+		full := time.Duration(float64(limiter.limit.Burst) / limiter.limit.Rate * float64(time.Second))
+		for key, b := range limiter.buckets {
+			if now.Sub(b.last) > full {
+				delete(limiter.buckets, key)
+			}
+		}
+	}
+}
+
+func (l *RateLimiter) performCleanup() {
+	for {
+		l.prune()
+		time.Sleep(time.Minute)
+	}
+}
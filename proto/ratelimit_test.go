@@ -0,0 +1,187 @@
+package proto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestBucketTake(t *testing.T) {
+	limit := RateLimit{Rate: 2, Burst: 4}
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		ok      bool
+		wait    time.Duration
+		left    float64
+	}{
+		{"full", 4, 0, true, 0, 3},
+		{"last token", 1, 0, true, 0, 0},
+		{"empty", 0, 0, false, 500 * time.Millisecond, 0},
+		{"partly refilled", 0, 250 * time.Millisecond, false, 250 * time.Millisecond, 0.5},
+		{"refilled", 0, time.Second, true, 0, 1},
+		{"capped at the burst", 1, time.Hour, true, 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			b := &bucket{tokens: tt.tokens, last: start}
+			ok, wait := b.take(limit, start.Add(tt.elapsed))
+			if ok != tt.ok || wait != tt.wait {
+				t.Errorf("take: %v after %s, want %v after %s", ok, wait, tt.ok, tt.wait)
+			}
+			if b.tokens != tt.left {
+				t.Errorf("%v tokens left, want %v", b.tokens, tt.left)
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   RateLimitConfig
+		calls [][3]string
+		// scope is the scope throttling the last call, or "" if every call is allowed.
+		scope string
+	}{
+		{
+			"within the burst",
+			RateLimitConfig{Sender: RateLimit{Rate: 0.001, Burst: 2}},
+			[][3]string{{"alice", "room", "gw"}, {"alice", "room", "gw"}},
+			"",
+		},
+		{
+			"sender over the burst",
+			RateLimitConfig{Sender: RateLimit{Rate: 0.001, Burst: 2}},
+			[][3]string{{"alice", "room", "gw"}, {"alice", "room", "gw"}, {"alice", "room", "gw"}},
+			LimitBySender,
+		},
+		{
+			"senders are limited separately",
+			RateLimitConfig{Sender: RateLimit{Rate: 0.001, Burst: 1}},
+			[][3]string{{"alice", "room", "gw"}, {"bob", "room", "gw"}},
+			"",
+		},
+		{
+			"room shared by its senders",
+			RateLimitConfig{Room: RateLimit{Rate: 0.001, Burst: 1}},
+			[][3]string{{"alice", "room", "gw"}, {"bob", "room", "gw"}},
+			LimitByRoom,
+		},
+		{
+			"gateway shared by its rooms",
+			RateLimitConfig{Gateway: RateLimit{Rate: 0.001, Burst: 1}},
+			[][3]string{{"alice", "room", "gw"}, {"bob", "other", "gw"}},
+			LimitByGateway,
+		},
+		{
+			"disabled",
+			RateLimitConfig{Sender: RateLimit{Burst: 1}},
+			[][3]string{{"alice", "room", "gw"}, {"alice", "room", "gw"}, {"alice", "room", "gw"}},
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(tt.cfg)
+			var ok bool
+			var scope string
+			var wait time.Duration
+			for _, call := range tt.calls {
+				ok, scope, wait = l.Allow(call[0], call[1], call[2])
+			}
+			if ok != (tt.scope == "") || scope != tt.scope {
+				t.Fatalf("the last call: allowed %v by %q, want it throttled by %q", ok, scope, tt.scope)
+			}
+			if !ok && wait <= 0 {
+				t.Errorf("throttled with a retry after %s", wait)
+			}
+			if tt.scope != "" && l.Throttled()[tt.scope] != 1 {
+				t.Errorf("throttled %v, want one call throttled by %s", l.Throttled(), tt.scope)
+			}
+		})
+	}
+}
+
+func TestRateLimiterRefundsRejectedRequests(t *testing.T) {
+	l := NewRateLimiter(RateLimitConfig{
+		Sender: RateLimit{Rate: 0.001, Burst: 2},
+		Room:   RateLimit{Rate: 0.001, Burst: 1},
+	})
+	if ok, _, _ := l.Allow("alice", "room", "gw"); !ok {
+		t.Fatal("the first message was throttled")
+	}
+	// The room rejects these, so alice keeps the token each of them took.
+	for i := 0; i < 3; i++ {
+		if ok, scope, _ := l.Allow("alice", "room", "gw"); ok || scope != LimitByRoom {
+			t.Fatalf("a message to the full room: allowed %v by %q", ok, scope)
+		}
+	}
+	if ok, scope, _ := l.Allow("alice", "other", "gw"); !ok {
+		t.Errorf("alice was throttled by %s after the room rejected her", scope)
+	}
+}
+
+func TestRateLimiterPrunesIdleBuckets(t *testing.T) {
+	l := NewRateLimiter(RateLimitConfig{Sender: RateLimit{Rate: 1, Burst: 10}})
+	l.Allow("idle", "room", "gw")
+	l.Allow("active", "room", "gw")
+	senders := l.scopes[LimitBySender].buckets
+	// Ten seconds is long enough for the idle bucket to have refilled.
+	senders["idle"].last = time.Now().Add(-11 * time.Second)
+	l.prune()
+	if _, kept := senders["idle"]; kept {
+		t.Error("the idle bucket was kept")
+	}
+	if _, kept := senders["active"]; !kept {
+		t.Error("the active bucket was pruned")
+	}
+}
+
+func TestSendMessageSetsRetryAfter(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.RateLimit.Sender = RateLimit{Rate: 0.5, Burst: 1}
+	})
+	s.importRoom(&RoomState{RoomName: "room"})
+	chat := NewChatServiceClient(dialTestServer(t, s))
+	send(t, chat, "alice", "room", "hi")
+	var trailer metadata.MD
+	_, err := chat.SendMessage(context.Background(), &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte("again"), Timestamp: uint64(time.Now().Unix())}, grpc.Trailer(&trailer))
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("SendMessage over the limit: %v, want ResourceExhausted", err)
+	}
+	if got := trailer.Get("retry-after"); len(got) != 1 || got[0] != "2" {
+		t.Errorf("retry-after %q, want 2 seconds", got)
+	}
+}
+
+func TestGatewayLimitIgnoresClaimedServerIDs(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.UserTokenSecret = "secret"
+		cfg.RateLimit.Sender = RateLimit{Burst: 1}
+		cfg.RateLimit.Gateway = RateLimit{Rate: 0.001, Burst: 1}
+	})
+	s.importRoom(&RoomState{RoomName: "room"})
+	chat := NewChatServiceClient(dialTestServer(t, s))
+	sendAs := func(user, serverID string) error {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), userTokenKey, IssueUserToken("secret", user), "server-id", serverID)
+		_, err := chat.SendMessage(ctx, &ChatMessage{Sender: user, Recipient: "room", Content: []byte("hi"), Timestamp: uint64(time.Now().Unix())})
+		return err
+	}
+	if err := sendAs("alice", "gw-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sendAs("alice", "gw-2"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("alice claiming another server ID: %v, want ResourceExhausted", err)
+	}
+	if err := sendAs("bob", "gw-1"); err != nil {
+		t.Errorf("bob was throttled by alice's limit: %v", err)
+	}
+}
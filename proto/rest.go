@@ -0,0 +1,129 @@
+package proto
+
+import (
+	"context"
+	_ "embed"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// eventStreamContentType selects server-sent events when sent as the Accept header of a
+// subscription.
+const eventStreamContentType = "text/event-stream"
+
+// gatewayClientKey is the metadata key the REST gateway sends the address of its HTTP client
+// in, so that calls are limited and logged per client rather than as the gateway's own.
+const gatewayClientKey = "gateway-client"
+
+//go:embed openapi.swagger.json
+var openAPISpec []byte
+
+type RESTConfig struct {
+	// Port serves the JSON API generated from the HTTP annotations of Chat.proto. It is disabled
+	// when empty.
+	Port string `yaml:"port" toml:"port"`
+}
+
+// NewRESTHandler serves the annotated ChatService RPCs as a JSON API by calling the gRPC
+// server at grpcAddr, along with its OpenAPI spec at /openapi.json. Subscriptions stream
+// newline-delimited JSON, or server-sent events to clients that accept text/event-stream.
+func NewRESTHandler(ctx context.Context, grpcAddr string, opts ...grpc.DialOption) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(eventStreamContentType, &eventStreamMarshaler{}),
+		runtime.WithMetadata(func(_ context.Context, r *http.Request) metadata.MD {
+			return metadata.Pairs(gatewayClientKey, r.RemoteAddr)
+		}),
+		runtime.WithIncomingHeaderMatcher(func(key string) (string, bool) {
+			// HTTP clients can't claim another address with a Grpc-Metadata-Gateway-Client header.
+			if strings.EqualFold(key, runtime.MetadataHeaderPrefix+gatewayClientKey) {
+				return "", false
+			}
+			return runtime.DefaultHeaderMatcher(key)
+		}),
+	)
+	if err := RegisterChatServiceHandlerFromEndpoint(ctx, mux, grpcAddr, opts); err != nil {
+		return nil, err
+	}
+	err := mux.HandlePath(http.MethodGet, "/openapi.json", func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(openAPISpec)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == eventStreamContentType {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		mux.ServeHTTP(w, r)
+	}), nil
+}
+
+// clientAddress returns the address a call comes from. For calls made over loopback, which is
+// how the REST gateway connects, that is the address of the HTTP client it forwarded.
+func clientAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if tcp, ok := p.Addr.(*net.TCPAddr); ok && tcp.IP.IsLoopback() {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if clients := md.Get(gatewayClientKey); len(clients) > 0 {
+			return clients[len(clients)-1]
+		}
+	}
+	return p.Addr.String()
+}
+
+// eventStreamMarshaler writes each message of a subscription as a server-sent event. Heartbeats
+// become comments, which keep the connection open without reaching the browser's handlers, and
+// an error ending the stream is sent as an error event.
+type eventStreamMarshaler struct {
+	runtime.JSONPb
+}
+
+func (m *eventStreamMarshaler) ContentType(interface{}) string {
+	return eventStreamContentType
+}
+
+// Marshal receives the chunks of a stream as {"result": msg} or {"error": status}.
+func (m *eventStreamMarshaler) Marshal(v interface{}) ([]byte, error) {
+	switch chunk := v.(type) {
+	case map[string]interface{}:
+		msg, ok := chunk["result"].(*ChatMessage)
+		if !ok {
+			break
+		}
+		if msg.GetContentType() == HeartbeatContentType {
+			return []byte(": heartbeat\n"), nil
+		}
+		return m.event("message", msg, "\n")
+	case map[string]proto.Message:
+		if st, ok := chunk["error"]; ok {
+			// The stream ends after an error without a delimiter, so the event ends itself.
+			return m.event("error", st, "\n\n")
+		}
+	}
+	return m.JSONPb.Marshal(v)
+}
+
+func (m *eventStreamMarshaler) event(name string, v interface{}, end string) ([]byte, error) {
+	data, err := m.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	event := append([]byte("event: "+name+"\ndata: "), data...)
+	return append(event, end...), nil
+}
+
+// Delimiter ends each event with the blank line server-sent events are separated by.
+func (m *eventStreamMarshaler) Delimiter() []byte {
+	return []byte("\n")
+}
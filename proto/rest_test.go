@@ -0,0 +1,77 @@
+package proto
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// recordClients is an interceptor sending the client address of every call to addresses.
+func recordClients(addresses chan<- string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		addresses <- clientAddress(ctx)
+		return handler(ctx, req)
+	}
+}
+
+func TestRESTGatewayForwardsTheClientAddress(t *testing.T) {
+	s := newTestServer(t)
+	addresses := make(chan string, 1)
+	server := grpc.NewServer(grpc.UnaryInterceptor(recordClients(addresses)))
+	RegisterChatServiceServer(server, s)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(lis)
+	defer server.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler, err := NewRESTHandler(ctx, lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients := make(chan string, 1)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clients <- r.RemoteAddr
+		handler.ServeHTTP(w, r)
+	}))
+	defer gateway.Close()
+
+	req, err := http.NewRequest(http.MethodGet, gateway.URL+"/rooms", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Grpc-Metadata-Gateway-Client", "203.0.113.1:1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /rooms: %s", resp.Status)
+	}
+	if client, got := <-clients, <-addresses; got != client {
+		t.Errorf("the call came from %s, want the HTTP client at %s", got, client)
+	}
+}
+
+func TestOnlyLoopbackCallersForwardClientAddresses(t *testing.T) {
+	s := newTestServer(t)
+	addresses := make(chan string, 1)
+	chat := NewChatServiceClient(dialTestServerWith(t, s, []grpc.ServerOption{grpc.UnaryInterceptor(recordClients(addresses))}))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), gatewayClientKey, "203.0.113.1:1")
+	if _, err := chat.ListRooms(ctx, &Empty{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-addresses; got == "203.0.113.1:1" {
+		t.Errorf("a remote caller claimed to forward %s", got)
+	}
+}
@@ -4,154 +4,672 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 type ClientConnection struct {
-	clientID string
-	stream   ChatService_SubscribeServer
-	active   bool
-	errChan  chan error
+	mu             sync.Mutex
+	clientID       string
+	stream         ChatService_SubscribeServer
+	errChan        chan error
+	queue          chan *outbound
+	closed         bool
+	pending        int           // queued messages that have not been sent yet, guarded by mu
+	sent           *sync.Cond    // broadcast on mu whenever pending drops to 0
+	stopped        chan struct{} // closed when the writer exits
+	peer           string
+	connectedSince time.Time
+	bytesSent      atomic.Uint64 // encoded size of the messages sent on the stream
+	heartbeatsSent atomic.Uint64
+}
+
+// outbound is a message waiting in a connection's queue. Deliveries carry the span that
+// is ended once the message is sent; other messages have no span.
+type outbound struct {
+	msg  *ChatMessage
+	span trace.Span
+}
+
+func newClientConnection(clientID string, stream ChatService_SubscribeServer, queueSize int) *ClientConnection {
+	conn := &ClientConnection{
+		clientID:       clientID,
+		stream:         stream,
+		errChan:        make(chan error, 1),
+		queue:          make(chan *outbound, queueSize),
+		stopped:        make(chan struct{}),
+		connectedSince: time.Now(),
+	}
+	conn.sent = sync.NewCond(&conn.mu)
+	conn.peer = clientAddress(stream.Context())
+	return conn
+}
+
+// disconnect ends the connection's Subscribe call with err. Only the first error is kept.
+func (c *ClientConnection) disconnect(err error) {
+	select {
+	case c.errChan <- err:
+	default:
+	}
+}
+
+// enqueue hands msg to the connection's writer. A client whose queue is full is too slow to
+// keep up with the room and is disconnected. It reports whether the message was queued.
+func (c *ClientConnection) enqueue(msg *ChatMessage, span trace.Span) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.queue <- &outbound{msg: msg, span: span}:
+		c.pending++
+		return true
+	default:
+		c.disconnect(status.Error(codes.ResourceExhausted, "too many messages waiting to be sent, reconnect"))
+		return false
+	}
+}
+
+// markSent is called by the writer for every message it took off the queue, sent or not.
+// The writer can't take it before enqueue counted it, since enqueue holds mu until then.
+func (c *ClientConnection) markSent() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending--
+	if c.pending == 0 {
+		c.sent.Broadcast()
+	}
+}
+
+// awaitSent blocks until every queued message has been taken off the queue by the writer,
+// including those queued while waiting.
+func (c *ClientConnection) awaitSent() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.pending > 0 {
+		c.sent.Wait()
+	}
+}
+
+// close stops accepting messages. The writer sends what is already queued and then exits.
+func (c *ClientConnection) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.queue)
+	}
+}
+
+// send sends msg on the connection's stream and counts the bytes sent.
+func (c *ClientConnection) send(msg *ChatMessage) error {
+	if err := c.stream.Send(msg); err != nil {
+		return err
+	}
+	c.bytesSent.Add(uint64(proto.Size(msg)))
+	return nil
 }
 
 type Room struct {
+	mu          sync.Mutex
+	name        string
+	origin      string
+	broker      Broker
+	owner       string
 	connections []*ClientConnection
-	errChan     chan error
-	wg          *sync.WaitGroup
+	bans        map[string]time.Time
+	mutes       map[string]time.Time
+	slowMode    time.Duration
+	topic       string
+	encrypted   bool
+	lastSent    map[string]time.Time
+	created     time.Time
+	restored    bool // restored from a snapshot and not joined since, so kept by the cleanup
+	history     []*ChatMessage
+	historySize int
+	sequence    uint64
+	cursors     map[string]uint64
+	metrics     *Metrics
+	tracer      trace.Tracer
+	logger      *slog.Logger
 }
 
-func NewRoom() *Room {
+// NewRoom creates a room whose broadcasts are published through broker, tagged with the
+// ID of the node that owns the room's local connections.
+func NewRoom(name, origin string, broker Broker) *Room {
 	return &Room{
+		name:        name,
+		origin:      origin,
+		broker:      broker,
 		connections: []*ClientConnection{},
-		errChan:     make(chan error),
-		wg:          new(sync.WaitGroup),
+		bans:        map[string]time.Time{},
+		mutes:       map[string]time.Time{},
+		lastSent:    map[string]time.Time{},
+		created:     time.Now(),
+		cursors:     map[string]uint64{},
+		tracer:      defaultTracer(),
+		logger:      slog.Default().With("room", name),
+	}
+}
+
+// addConnection adds the client to the room and queues the retained messages it hasn't
+// seen yet. The room is locked while catching up, so live messages queue up behind the replay.
+func (r *Room) addConnection(conn *ClientConnection) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.connections {
+		if c.clientID == conn.clientID {
+			return errors.New("user with the same name is already in the room")
+		}
 	}
+	for _, msg := range r.history {
+		if msg.GetSequence() <= r.cursors[conn.clientID] {
+			continue
+		}
+		if !conn.enqueue(msg, nil) {
+			return status.Error(codes.ResourceExhausted, "too many messages to catch up on")
+		}
+	}
+	r.connections = append(r.connections, conn)
+	r.restored = false
+	return nil
+}
+
+// admit checks that clientID may join the room, asking for encryption if and only if the
+// room is end-to-end encrypted.
+func (r *Room) admit(clientID string, encrypted bool) error {
+	if r.isBanned(clientID) {
+		return status.Errorf(codes.PermissionDenied, "%s is banned from %s", clientID, r.name)
+	}
+	if r.isEncrypted() != encrypted {
+		if encrypted {
+			return status.Errorf(codes.FailedPrecondition, "%s is not end-to-end encrypted", r.name)
+		}
+		return status.Errorf(codes.FailedPrecondition, "%s is end-to-end encrypted, join it with encrypted set", r.name)
+	}
+	return nil
 }
 
+// removeConnection drops the client from the room and returns its connection, or nil if
+// the client was not in the room.
+func (r *Room) removeConnection(clientID string) *ClientConnection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, c := range r.connections {
+		if c.clientID == clientID {
+			r.connections = append(r.connections[:i], r.connections[i+1:]...)
+			return c
+		}
+	}
+	return nil
+}
+
+// BroadcastMessage publishes msg to every node in the cluster. Each node, including this one,
+// delivers it to its own connections in the room. If the broker is unavailable the message
+// is still delivered locally.
 func (r *Room) BroadcastMessage(msg *ChatMessage) {
-	for _, connection := range r.connections {
-		intermediary := connection
-		go func() {
-			err := intermediary.stream.Send(msg)
-			if err != nil {
-				intermediary.active = false
-				intermediary.errChan <- errors.New("disconnected")
-			}
-		}()
+	r.mu.Lock()
+	tracer := r.tracer
+	r.mu.Unlock()
+	_, span := tracer.Start(extractTrace(msg), "broker.publish", trace.WithAttributes(attribute.String("chat.room", r.name)))
+	data, err := proto.Marshal(&BrokerEnvelope{RoomName: r.name, Message: msg, Origin: r.origin})
+	if err == nil {
+		err = r.broker.Publish(BroadcastSubject, data)
+	}
+	endSpan(span, err)
+	if err != nil {
+		r.deliver(proto.Clone(msg).(*ChatMessage))
 	}
 }
 
-func (r *Room) performCleanup() {
-	r.wg.Add(1)
-	for {
-		for i, connection := range r.connections {
-			if err := connection.stream.Send(&EMPTY_MESSAGE); err != nil {
-				connection.active = false
+// deliver numbers msg after the last message of the room on this node, retains it in the
+// history and sends it to the connections in this room on this node. Each node numbers the
+// messages in the order its broker delivers them, so that its sequences never repeat or go
+// back whatever order the nodes published in; msg.Sequencer tells clients whose they are.
+func (r *Room) deliver(msg *ChatMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sequence++
+	msg.Sequence = r.sequence
+	msg.Sequencer = r.origin
+	parent := extractTrace(msg)
+	if r.historySize > 0 {
+		_, span := r.tracer.Start(parent, "persist")
+		r.history = append(r.history, msg)
+		if len(r.history) > r.historySize {
+			r.history = r.history[len(r.history)-r.historySize:]
+		}
+		span.End()
+	}
+	for _, conn := range r.connections {
+		_, span := r.tracer.Start(parent, "deliver", trace.WithAttributes(
+			attribute.String("chat.room", r.name),
+			attribute.String("chat.client_id", conn.clientID)))
+		if !conn.enqueue(msg, span) {
+			r.metrics.messageDropped("queue_full")
+			endSpan(span, status.Error(codes.ResourceExhausted, "queue full"))
+		}
+	}
+}
+
+// writeLoop is the only goroutine sending on the connection's stream. It sends the queued
+// messages in order and advances the client's read cursor, and exits once the connection is
+// closed and its queue is drained. After a failed send the remaining messages are dropped.
+func (r *Room) writeLoop(conn *ClientConnection) {
+	defer close(conn.stopped)
+	var failed error
+	for item := range conn.queue {
+		if failed == nil {
+			// Envelopes without a payload for this client are skipped, but still move its cursor.
+			if msg := sealedFor(item.msg, conn.clientID); msg != nil {
+				started := time.Now()
+				failed = conn.send(msg)
+				if item.span != nil {
+					r.metrics.observeSend(started, failed)
+				}
 			}
-			if !connection.active {
-				r.connections = append(r.connections[:i], r.connections[i:]...)
+			if failed != nil {
+				r.logger.Debug("send failed", "client_id", conn.clientID, "error", failed.Error())
+				conn.disconnect(errors.New("disconnected"))
+			} else if item.msg.GetContentType() == HeartbeatContentType {
+				conn.heartbeatsSent.Add(1)
+			} else if item.msg.GetSequence() > 0 {
+				r.mu.Lock()
+				if item.msg.GetSequence() > r.cursors[conn.clientID] {
+					r.cursors[conn.clientID] = item.msg.GetSequence()
+				}
+				r.mu.Unlock()
 			}
 		}
-		time.Sleep(time.Second * 10)
+		if item.span != nil {
+			endSpan(item.span, failed)
+		}
+		conn.markSent()
 	}
-	r.wg.Done()
-
 }
 
 type Server struct {
-	roomsMap map[string]*Room
+	mu                sync.RWMutex
+	roomsMap          map[string]*Room
+	limiter           *RateLimiter
+	config            atomic.Pointer[Config] // replaced as a whole by Reload
+	validators        []MessageValidator
+	filters           []MessageFilter // guarded by mu, so that filters can be registered while serving
+	quarantine        *Quarantine
+	audit             AuditSink
+	nodeID            string
+	broker            Broker
+	distributed       bool
+	unsubscribeBroker func()
+	cluster           *Cluster
+	federation        *Federation
+	webhooks          atomic.Pointer[Webhooks] // set by SetWebhooks while the server runs
+	commands          commandRegistry
+	keys              keyDirectory
+	draining          bool
+	snapshotPath      string
+	metrics           *Metrics
+	tracer            atomic.Pointer[trace.Tracer] // replaced by SetTracerProvider, read with tracing
+	logger            atomic.Pointer[slog.Logger]  // replaced by SetLogger while the server runs
+	ready             chan struct{}
 }
 
-func (s Server) ListRooms(ctx context.Context, empty *Empty) (*ListRoomResponse, error) {
+func (s *Server) ListRooms(ctx context.Context, empty *Empty) (*ListRoomResponse, error) {
 	lrr := &ListRoomResponse{
 		RoomNames: []string{},
 	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	for k := range s.roomsMap {
 		lrr.RoomNames = append(lrr.RoomNames, k)
 	}
 	return lrr, nil
 }
 
-func (s Server) Subscribe(request *RoomRequest, server ChatService_SubscribeServer) error {
+func (s *Server) Subscribe(request *RoomRequest, server ChatService_SubscribeServer) error {
 	roomID := request.RoomName
-	var room *Room
-	if _, exists := s.roomsMap[roomID]; !exists {
-		room = NewRoom()
-		room.connections = append(room.connections, &ClientConnection{
-			clientID: request.GetInitialConnectionRequest().GetServerID(),
-			stream:   server,
-			active:   true,
-			errChan:  make(chan error),
-		})
+	if err := s.checkClaimedUser(server.Context(), request.GetInitialConnectionRequest().GetServerID()); err != nil {
+		return err
+	}
+	if err := checkParticipant(roomID, request.GetInitialConnectionRequest().GetServerID()); err != nil {
+		return err
+	}
+	if client, ctx, forward := s.forwardTarget(server.Context(), roomID); forward {
+		return forwardSubscribe(client, ctx, request, server)
+	}
+	if err := s.awaitReady(server.Context()); err != nil {
+		return err
+	}
+	clientID := request.GetInitialConnectionRequest().GetServerID()
+	// The queue also holds the replayed history, so that catching up doesn't count against
+	// the room's live traffic.
+	cfg := s.config.Load()
+	conn := newClientConnection(clientID, server, cfg.Liveness.QueueSize+cfg.HistorySize)
+	defer conn.close()
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+	room, exists := s.roomsMap[roomID]
+	if !exists {
+		room = s.newRoom(roomID)
+		room.owner = clientID
+		room.encrypted = request.GetEncrypted()
+		room.connections = append(room.connections, conn)
 		s.roomsMap[roomID] = room
-		go room.performCleanup()
+		s.mu.Unlock()
+		go room.writeLoop(conn)
+		s.recordAudit(AuditRoomCreated, roomID, clientID, "", "")
 	} else {
-		room = s.roomsMap[roomID]
-		for _, conn := range room.connections {
-			if conn.clientID == request.GetInitialConnectionRequest().GetServerID() {
-				return errors.New("user with the same name is already in the room")
-			}
+		// The connection is added before s.mu is released, so that the cleanup can't remove
+		// the room while it looks empty.
+		err := room.admit(clientID, request.GetEncrypted())
+		if err == nil {
+			err = room.addConnection(conn)
 		}
-		s.roomsMap[roomID].connections = append(s.roomsMap[roomID].connections, &ClientConnection{
-			clientID: request.GetInitialConnectionRequest().GetServerID(),
-			stream:   server,
-			active:   true,
-			errChan:  make(chan error),
-		})
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		go room.writeLoop(conn)
 		room.BroadcastMessage(&ChatMessage{
 			Sender:    "GATEWAY",
 			Recipient: "",
-			Content:   []byte(fmt.Sprintf("%s joined.", request.GetInitialConnectionRequest().GetServerID())),
+			Content:   []byte(fmt.Sprintf("%s joined.", clientID)),
 			Timestamp: uint64(time.Now().Unix()),
 		})
 	}
-	return <-room.errChan
+	s.recordAudit(AuditJoin, roomID, clientID, "", "")
+	err := s.awaitDisconnect(server.Context(), conn)
+	s.loggerFromContext(server.Context()).Info("subscriber disconnected", "reason", errorString(err))
+	if room.removeConnection(clientID) != nil {
+		s.recordAudit(AuditLeave, roomID, clientID, "", "")
+	}
+	// Give the writer a chance to send the messages queued before the disconnect, such as
+	// the reason for a kick, before the stream is closed.
+	conn.close()
+	select {
+	case <-conn.stopped:
+	case <-server.Context().Done():
+	case <-time.After(time.Second):
+	}
+	return err
 }
 
-func (s Server) UnsubscribeAll(ctx context.Context, request *ConnectionRequest) (*Empty, error) {
-	for _, v := range s.roomsMap {
-		for i, conn := range v.connections {
-			conn.errChan <- errors.New("disconnected")
-			v.connections = append(v.connections[:i], v.connections[i+1:]...)
+func (s *Server) UnsubscribeAll(ctx context.Context, request *ConnectionRequest) (*Empty, error) {
+	if err := s.checkClaimedUser(ctx, request.GetServerID()); err != nil {
+		return nil, err
+	}
+	var left []string
+	s.mu.RLock()
+	for roomID, v := range s.roomsMap {
+		if conn := v.removeConnection(request.GetServerID()); conn != nil {
+			s.loggerFromContext(ctx).Info("unsubscribed", "room", roomID)
+			conn.disconnect(errors.New("disconnected"))
+			left = append(left, roomID)
 		}
 	}
+	s.mu.RUnlock()
+	for _, roomID := range left {
+		s.recordAudit(AuditLeave, roomID, request.GetServerID(), "", "unsubscribed from all rooms")
+	}
 	return &Empty{}, nil
 }
 
-func (s Server) SendMessage(ctx context.Context, message *ChatMessage) (*Empty, error) {
+func (s *Server) SendMessage(ctx context.Context, message *ChatMessage) (*Empty, error) {
 	forClient := message.GetRecipient()
-	for k, room := range s.roomsMap {
-		if k == forClient {
-			room.BroadcastMessage(message)
+	if err := s.checkClaimedUser(ctx, message.GetSender()); err != nil {
+		return nil, err
+	}
+	if err := checkParticipant(forClient, message.GetSender()); err != nil {
+		return nil, err
+	}
+	if s.isDraining() {
+		return nil, status.Error(codes.Unavailable, "server is shutting down")
+	}
+	if client, ctx, forward := s.forwardTarget(ctx, forClient); forward {
+		return client.SendMessage(ctx, message)
+	}
+	if err := s.awaitReady(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.admitMessage(ctx, message); err != nil {
+		return nil, err
+	}
+	if invocation, ok := parseCommand(message); ok {
+		if err := s.dispatchCommand(ctx, invocation); err != nil {
+			return nil, err
 		}
+		return &Empty{}, nil
+	}
+	message, err := s.applyFilters(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil {
+		s.metrics.messageDropped("quarantined")
+		return &Empty{}, nil
 	}
+	s.routeMessage(ctx, message)
 	return &Empty{}, nil
 }
 
-func (s Server) mustEmbedUnimplementedChatServiceServer() {
-	panic("implement me")
+// routeMessage delivers an accepted message to the room's subscribers, its federated peers and
+// the webhooks.
+func (s *Server) routeMessage(ctx context.Context, message *ChatMessage) {
+	s.metrics.messageSent()
+	injectTrace(ctx, message)
+	roomID := message.GetRecipient()
+	if room := s.getRoom(roomID); room != nil {
+		room.BroadcastMessage(message)
+	}
+	if s.federation != nil {
+		s.federation.relayLocal(roomID, message)
+	}
+	s.webhooks.Load().publishMessage(roomID, message)
+}
+
+// admitMessage applies validation, the rate limits and the moderation rules to a message.
+// Invalid messages are rejected before they use up any tokens.
+func (s *Server) admitMessage(ctx context.Context, message *ChatMessage) (err error) {
+	ctx, span := s.tracing().Start(ctx, "validate")
+	defer func() { endSpan(span, err) }()
+	if err := s.validateMessage(message); err != nil {
+		return err
+	}
+	if err := s.checkEncryption(message); err != nil {
+		return err
+	}
+	if ok, scope, wait := s.limiter.Allow(message.GetSender(), message.GetRecipient(), s.caller(ctx)); !ok {
+		retryAfter := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+		_ = grpc.SetTrailer(ctx, metadata.Pairs("retry-after", retryAfter))
+		return status.Errorf(codes.ResourceExhausted, "%s rate limit exceeded, retry after %ss", scope, retryAfter)
+	}
+	return s.checkModeration(ctx, message)
 }
 
-var EMPTY_MESSAGE = ChatMessage{
-	Timestamp: 0,
+func (s *Server) mustEmbedUnimplementedChatServiceServer() {
+	panic("implement me")
 }
 
-func (s Server) performRoomCleanup() {
+func (s *Server) performRoomCleanup() {
 	for {
+		started := time.Now()
+		cfg := s.config.Load()
+		var removed []string
+		s.mu.Lock()
 		for k, room := range s.roomsMap {
-			if len(room.connections) == 0 {
+			room.mu.Lock()
+			if len(room.connections) == 0 && !room.restored && time.Since(room.created) > cfg.RoomGracePeriod {
 				delete(s.roomsMap, k)
+				removed = append(removed, k)
 			}
+			room.mu.Unlock()
 		}
-		time.Sleep(time.Second * 20)
+		s.mu.Unlock()
+		// The audit sink may be slow, so events are recorded once the rooms are unlocked.
+		for _, k := range removed {
+			s.logger.Load().Info("room removed by cleanup", "room", k, "reason", "no connections left")
+			s.recordAudit(AuditRoomDeleted, k, "GATEWAY", "", "no connections left")
+		}
+		s.metrics.observeSweep("rooms", started)
+		time.Sleep(cfg.RoomCleanupInterval)
 	}
 }
 
-func NewChatServer() ChatServiceServer {
+// SetBroker connects the server to the other nodes of a cluster through b. Rooms may then
+// have members on other nodes, so messages to rooms without local members are accepted.
+func (s *Server) SetBroker(b Broker) error {
+	unsubscribe, err := b.Subscribe(BroadcastSubject, s.handleBroadcast)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.unsubscribeBroker != nil {
+		s.unsubscribeBroker()
+	}
+	s.broker = b
+	s.distributed = true
+	s.unsubscribeBroker = unsubscribe
+	for _, room := range s.roomsMap {
+		room.broker = b
+	}
+	return nil
+}
+
+func (s *Server) handleBroadcast(data []byte) {
+	envelope := &BrokerEnvelope{}
+	if err := proto.Unmarshal(data, envelope); err != nil {
+		return
+	}
+	if room := s.getRoom(envelope.GetRoomName()); room != nil {
+		room.deliver(envelope.GetMessage())
+	}
+}
+
+// Ready is closed once the rooms saved in the last snapshot have been restored.
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// awaitReady holds a call that creates rooms or adds to them until the snapshot is restored,
+// so that the restore neither overwrites nor misses what the call does.
+func (s *Server) awaitReady(ctx context.Context) error {
+	select {
+	case <-s.ready:
+		return nil
+	case <-ctx.Done():
+		return status.Error(codes.Unavailable, "server is still restoring its snapshot")
+	}
+}
+
+func (s *Server) newRoom(roomID string) *Room {
+	room := NewRoom(roomID, s.nodeID, s.broker)
+	room.historySize = s.config.Load().HistorySize
+	room.metrics = s.metrics
+	room.tracer = s.tracing()
+	room.logger = s.logger.Load().With("room", roomID)
+	return room
+}
+
+func (s *Server) getRoom(roomID string) *Room {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.roomsMap[roomID]
+}
+
+// caller identifies the caller of an RPC for rate limiting: by their user token, or by their
+// address when they have none. Metadata the caller sets itself is never trusted.
+func (s *Server) caller(ctx context.Context) string {
+	if user, err := s.authenticatedUser(ctx); err == nil {
+		return "user:" + user
+	}
+	return "address:" + clientAddress(ctx)
+}
+
+// NewChatServer creates a server configured by cfg, which should have been checked with
+// Validate, and restores the rooms of the last snapshot in the background.
+func NewChatServer(cfg *Config) *Server {
 	s := &Server{
-		roomsMap: map[string]*Room{},
+		nodeID:       cfg.NodeID,
+		roomsMap:     map[string]*Room{},
+		limiter:      NewRateLimiter(cfg.RateLimit),
+		validators:   defaultValidators,
+		quarantine:   NewQuarantine(1000),
+		audit:        discardAuditSink{},
+		snapshotPath: cfg.SnapshotFile,
 	}
+	s.config.Store(cfg)
+	s.metrics = newMetrics(s)
+	tracer := defaultTracer()
+	s.tracer.Store(&tracer)
+	s.ready = make(chan struct{})
+	s.logger.Store(slog.Default())
+	s.broker = NewInProcessBroker()
+	s.registerBuiltinCommands()
+	s.unsubscribeBroker, _ = s.broker.Subscribe(BroadcastSubject, s.handleBroadcast)
+	go func() {
+		defer close(s.ready)
+		if err := s.RestoreSnapshot(); err != nil {
+			s.logger.Load().Error("restoring snapshot", "path", s.snapshotPath, "error", err.Error())
+		}
+	}()
 	go s.performRoomCleanup()
+	go s.limiter.performCleanup()
+	go s.performSnapshots(cfg.SnapshotInterval)
 	return s
 }
+
+// UnaryInterceptors returns the interceptors that trace, log and measure unary RPCs, in the
+// order the gRPC server and the WebSocket bridge run them.
+func (s *Server) UnaryInterceptors() []grpc.UnaryServerInterceptor {
+	return []grpc.UnaryServerInterceptor{
+		s.TracingUnaryInterceptor(),
+		s.LoggingUnaryInterceptor(),
+		s.metrics.UnaryServerInterceptor(),
+	}
+}
+
+// StreamInterceptors is UnaryInterceptors for streaming RPCs.
+func (s *Server) StreamInterceptors() []grpc.StreamServerInterceptor {
+	return []grpc.StreamServerInterceptor{
+		s.TracingStreamInterceptor(),
+		s.LoggingStreamInterceptor(),
+		s.metrics.StreamServerInterceptor(),
+	}
+}
+
+// Reload applies the settings of cfg that can change while the server runs: the rate limits,
+// message validation, heartbeats, history size, room cleanup and the admin token. Heartbeat
+// and queue settings apply to new subscriptions. The names of the changed settings that only
+// take effect after a restart are returned.
+func (s *Server) Reload(cfg *Config) []string {
+	old := s.config.Swap(cfg)
+	s.limiter.SetConfig(cfg.RateLimit)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, room := range s.roomsMap {
+		room.mu.Lock()
+		room.historySize = cfg.HistorySize
+		if cfg.HistorySize > 0 && len(room.history) > cfg.HistorySize {
+			room.history = room.history[len(room.history)-cfg.HistorySize:]
+		}
+		room.mu.Unlock()
+	}
+	return old.restartRequired(cfg)
+}
@@ -0,0 +1,188 @@
+package proto
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// newTestServer starts a server that keeps its snapshot in a temporary directory, once it
+// has finished restoring.
+func newTestServer(t testing.TB, configure ...func(*Config)) *Server {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.SnapshotFile = filepath.Join(t.TempDir(), "snapshot.pb")
+	cfg.SnapshotInterval = 0
+	for _, c := range configure {
+		c(cfg)
+	}
+	s := NewChatServer(cfg)
+	<-s.ready
+	return s
+}
+
+// dialTestServer serves the ChatService of s, and whatever register adds, over bufconn.
+func dialTestServer(t testing.TB, s *Server, register ...func(*grpc.Server)) *grpc.ClientConn {
+	t.Helper()
+	return dialTestServerWith(t, s, nil, register...)
+}
+
+// dialTestServerWith is dialTestServer for a gRPC server created with opts, such as interceptors.
+func dialTestServerWith(t testing.TB, s *Server, opts []grpc.ServerOption, register ...func(*grpc.Server)) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(opts...)
+	RegisterChatServiceServer(server, s)
+	for _, r := range register {
+		r(server)
+	}
+	go server.Serve(lis)
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+	})
+	return conn
+}
+
+// subscribe joins room as clientID until the test ends.
+func subscribe(t testing.TB, chat ChatServiceClient, room, clientID string) ChatService_SubscribeClient {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	stream, err := chat.Subscribe(ctx, &RoomRequest{RoomName: room, InitialConnectionRequest: &ConnectionRequest{ServerID: clientID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+// receive returns the next n messages sent by users, skipping heartbeats and notices from the
+// server.
+func receive(t testing.TB, stream ChatService_SubscribeClient, n int) []*ChatMessage {
+	t.Helper()
+	var messages []*ChatMessage
+	for len(messages) < n {
+		msg, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("received %d of %d messages: %v", len(messages), n, err)
+		}
+		if msg.GetContentType() == HeartbeatContentType || msg.GetSender() == "GATEWAY" {
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func send(t testing.TB, chat ChatServiceClient, sender, room, content string) {
+	t.Helper()
+	_, err := chat.SendMessage(context.Background(), &ChatMessage{
+		Sender:    sender,
+		Recipient: room,
+		Content:   []byte(content),
+		Timestamp: uint64(time.Now().Unix()),
+	})
+	if err != nil {
+		t.Fatalf("sending %q: %v", content, err)
+	}
+}
+
+// connected returns how many subscribers room has on s.
+func connected(s *Server, room string) int {
+	r := s.getRoom(room)
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.connections)
+}
+
+func TestJoiningAnEmptyRoomKeepsItFromCleanup(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.RoomCleanupInterval = time.Microsecond
+		cfg.RoomGracePeriod = 0
+	})
+	chat := NewChatServiceClient(dialTestServer(t, s))
+	for i := 0; i < 20; i++ {
+		s.importRoom(&RoomState{RoomName: "room"})
+		ctx, cancel := context.WithCancel(context.Background())
+		if _, err := chat.Subscribe(ctx, &RoomRequest{RoomName: "room", InitialConnectionRequest: &ConnectionRequest{ServerID: "alice"}}); err != nil {
+			t.Fatal(err)
+		}
+		// A subscriber added to a room that the cleanup removed would never be seen here.
+		waitFor(t, fmt.Sprintf("join %d", i), func() bool { return connected(s, "room") == 1 })
+		cancel()
+		waitFor(t, "alice to leave", func() bool { return connected(s, "room") == 0 })
+	}
+}
+
+func TestDirectMessageRoomsArePrivate(t *testing.T) {
+	s := newTestServer(t)
+	chat := NewChatServiceClient(dialTestServer(t, s))
+	bob := subscribe(t, chat, "dm:alice:bob", "bob")
+	waitFor(t, "bob to join", func() bool { return connected(s, "dm:alice:bob") == 1 })
+
+	tests := []struct {
+		user, room string
+		want       codes.Code
+	}{
+		{"alice", "dm:alice:bob", codes.OK},
+		{"mallory", "dm:alice:bob", codes.PermissionDenied},
+		{"alice", "dm:alice", codes.PermissionDenied},
+		{"alice", "dm:alice:bob:mallory", codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user+" in "+tt.room, func(t *testing.T) {
+			stream, err := chat.Subscribe(context.Background(), &RoomRequest{RoomName: tt.room, InitialConnectionRequest: &ConnectionRequest{ServerID: tt.user}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != codes.OK {
+				if _, err := stream.Recv(); status.Code(err) != tt.want {
+					t.Errorf("Subscribe: %v, want %s", err, tt.want)
+				}
+			}
+			_, err = chat.SendMessage(context.Background(), &ChatMessage{Sender: tt.user, Recipient: tt.room, Content: []byte("hi " + tt.user), Timestamp: uint64(time.Now().Unix())})
+			if status.Code(err) != tt.want {
+				t.Errorf("SendMessage: %v, want %s", err, tt.want)
+			}
+		})
+	}
+	if got := receive(t, bob, 1)[0]; got.GetSender() != "alice" {
+		t.Errorf("bob received %q from %s, want alice's message", got.GetContent(), got.GetSender())
+	}
+}
@@ -0,0 +1,66 @@
+package proto
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Shutdown stops accepting new subscriptions, messages and heartbeats, waits for the messages
+// that are still queued to be sent, tells every subscriber that the server is going away and
+// ends their Subscribe calls. It returns early with the context's error if ctx is done before
+// the queues are flushed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining = true
+	rooms := make([]*Room, 0, len(s.roomsMap))
+	for _, room := range s.roomsMap {
+		rooms = append(rooms, room)
+	}
+	s.mu.Unlock()
+
+	flushed := make(chan struct{})
+	go func() {
+		for _, room := range rooms {
+			room.mu.Lock()
+			connections := append([]*ClientConnection{}, room.connections...)
+			room.mu.Unlock()
+			for _, conn := range connections {
+				conn.awaitSent()
+			}
+		}
+		close(flushed)
+	}()
+	var err error
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	goodbye := &ChatMessage{
+		Sender:    "GATEWAY",
+		Recipient: "",
+		Content:   []byte("server shutting down, reconnect"),
+		Timestamp: uint64(time.Now().Unix()),
+	}
+	for _, room := range rooms {
+		room.mu.Lock()
+		connections := room.connections
+		room.connections = []*ClientConnection{}
+		room.mu.Unlock()
+		for _, conn := range connections {
+			conn.enqueue(goodbye, nil)
+			conn.disconnect(status.Error(codes.Unavailable, "server shutting down, reconnect"))
+		}
+	}
+	return err
+}
+
+func (s *Server) isDraining() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.draining
+}
@@ -0,0 +1,48 @@
+package proto
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestShutdownSendsTheQueuedMessagesFirst(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) { cfg.Liveness.HeartbeatInterval = time.Millisecond })
+	chat := NewChatServiceClient(dialTestServer(t, s))
+	alice := subscribe(t, chat, "room", "alice")
+	waitFor(t, "the room to be created", func() bool { return connected(s, "room") == 1 })
+	for i := 0; i < 10; i++ {
+		send(t, chat, "alice", "room", fmt.Sprint(i))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	for i, msg := range receive(t, alice, 10) {
+		if string(msg.GetContent()) != fmt.Sprint(i) {
+			t.Fatalf("message %d is %q", i, msg.GetContent())
+		}
+	}
+	for {
+		msg, err := alice.Recv()
+		if err != nil {
+			if status.Code(err) != codes.Unavailable {
+				t.Errorf("the subscription ended with %v, want Unavailable", err)
+			}
+			break
+		}
+		if msg.GetContentType() != HeartbeatContentType && msg.GetSender() != "GATEWAY" {
+			t.Errorf("received %q after the queued messages", msg.GetContent())
+		}
+	}
+	_, err := chat.SendMessage(context.Background(), &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte("late")})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("SendMessage while shutting down: %v, want Unavailable", err)
+	}
+}
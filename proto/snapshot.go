@@ -0,0 +1,84 @@
+package proto
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// SaveSnapshot writes every room's settings, ACLs, history and read cursors, and the key
+// directory, to the snapshot file.
+// The file is replaced atomically, so a crash while saving leaves the previous snapshot intact.
+func (s *Server) SaveSnapshot() error {
+	s.mu.RLock()
+	snapshot := &Snapshot{Timestamp: uint64(time.Now().Unix())}
+	for _, room := range s.roomsMap {
+		snapshot.Rooms = append(snapshot.Rooms, room.exportState())
+	}
+	s.mu.RUnlock()
+	snapshot.Keys = s.exportKeys()
+	data, err := proto.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.snapshotPath), filepath.Base(s.snapshotPath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.snapshotPath)
+}
+
+// RestoreSnapshot loads the rooms saved by SaveSnapshot. A missing snapshot file is not an error.
+// Rooms that were handed over to this node in the meantime keep the messages they already have.
+// Restored rooms are kept by the cleanup until someone joins them, since their members have
+// yet to reconnect.
+func (s *Server) RestoreSnapshot() error {
+	data, err := os.ReadFile(s.snapshotPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	snapshot := &Snapshot{}
+	if err := proto.Unmarshal(data, snapshot); err != nil {
+		return err
+	}
+	for _, state := range snapshot.GetRooms() {
+		s.importRoom(state)
+		if room := s.getRoom(state.GetRoomName()); room != nil {
+			room.mu.Lock()
+			room.restored = len(room.connections) == 0
+			room.mu.Unlock()
+		}
+	}
+	s.importKeys(snapshot.GetKeys())
+	return nil
+}
+
+func (s *Server) performSnapshots(interval time.Duration) {
+	if interval == 0 {
+		return
+	}
+	<-s.ready
+	for {
+		time.Sleep(interval)
+		if err := s.SaveSnapshot(); err != nil {
+			s.logger.Load().Error("saving snapshot", "path", s.snapshotPath, "error", err.Error())
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package proto
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSnapshotRestoresHistoryAndSequence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.pb")
+	atPath := func(cfg *Config) { cfg.SnapshotFile = path }
+	before := newTestServer(t, atPath)
+	chat := NewChatServiceClient(dialTestServer(t, before))
+	alice := subscribe(t, chat, "room", "alice")
+	waitFor(t, "the room to be created", func() bool { return connected(before, "room") == 1 })
+	send(t, chat, "alice", "room", "one")
+	send(t, chat, "alice", "room", "two")
+	last := receive(t, alice, 2)[1].GetSequence()
+	if err := before.SaveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	after := newTestServer(t, atPath)
+	chat = NewChatServiceClient(dialTestServer(t, after))
+	carol := subscribe(t, chat, "room", "carol")
+	if got := receive(t, carol, 2); string(got[0].GetContent()) != "one" || string(got[1].GetContent()) != "two" {
+		t.Fatalf("carol caught up on %q and %q", got[0].GetContent(), got[1].GetContent())
+	}
+	send(t, chat, "carol", "room", "three")
+	if got := receive(t, carol, 1)[0]; got.GetSequence() <= last {
+		t.Errorf("the restored room numbered %q %d, after %d before the restart", got.GetContent(), got.GetSequence(), last)
+	}
+}
+
+func TestCallsWaitForTheRestore(t *testing.T) {
+	s := newTestServer(t)
+	restored := make(chan struct{})
+	s.ready = restored
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	msg := &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte("hi")}
+	if _, err := s.SendMessage(ctx, msg); status.Code(err) != codes.Unavailable {
+		t.Fatalf("SendMessage while restoring: %v, want Unavailable", err)
+	}
+	close(restored)
+	s.importRoom(&RoomState{RoomName: "room"})
+	if _, err := s.SendMessage(context.Background(), msg); err != nil {
+		t.Fatalf("SendMessage once restored: %v", err)
+	}
+}
+
+// savedSnapshot saves a snapshot of rooms, and returns its path.
+func savedSnapshot(t *testing.T, rooms ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "snapshot.pb")
+	s := newTestServer(t, func(cfg *Config) { cfg.SnapshotFile = path })
+	for _, room := range rooms {
+		s.importRoom(&RoomState{RoomName: room})
+	}
+	if err := s.SaveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSettersDuringTheRestore(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SnapshotFile = savedSnapshot(t, "one", "two", "three")
+	cfg.SnapshotInterval = 0
+	s := NewChatServer(cfg)
+	s.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	s.SetTracerProvider(sdktrace.NewTracerProvider())
+	<-s.Ready()
+	if connected(s, "three") != 0 || s.getRoom("three") == nil {
+		t.Fatal("the rooms were not restored")
+	}
+}
+
+func TestRestoredRoomsAreKeptUntilJoined(t *testing.T) {
+	path := savedSnapshot(t, "room")
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.SnapshotFile = path
+		cfg.RoomCleanupInterval = time.Millisecond
+		cfg.RoomGracePeriod = 0
+	})
+	time.Sleep(20 * time.Millisecond)
+	if s.getRoom("room") == nil {
+		t.Fatal("the cleanup removed the restored room before anyone rejoined it")
+	}
+	chat := NewChatServiceClient(dialTestServer(t, s))
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := chat.Subscribe(ctx, &RoomRequest{RoomName: "room", InitialConnectionRequest: &ConnectionRequest{ServerID: "alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "alice to join", func() bool { return connected(s, "room") == 1 })
+	cancel()
+	waitFor(t, "the room to be removed once left", func() bool { return s.getRoom("room") == nil })
+}
@@ -0,0 +1,125 @@
+package proto
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const tracerName = "grpc-chat"
+
+var propagator = propagation.TraceContext{}
+
+// metadataCarrier lets the propagator read and write gRPC metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// SetTracerProvider replaces the provider spans are created with. By default the global
+// provider is used, which records nothing until one is installed with otel.SetTracerProvider.
+func (s *Server) SetTracerProvider(tp trace.TracerProvider) {
+	tracer := tp.Tracer(tracerName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tracer.Store(&tracer)
+	for _, room := range s.roomsMap {
+		room.mu.Lock()
+		room.tracer = tracer
+		room.mu.Unlock()
+	}
+}
+
+// tracing returns the tracer the server's spans are started with.
+func (s *Server) tracing() trace.Tracer {
+	return *s.tracer.Load()
+}
+
+func defaultTracer() trace.Tracer {
+	return otel.GetTracerProvider().Tracer(tracerName)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, status.Convert(err).Message())
+	}
+	span.End()
+}
+
+func (s *Server) startRPCSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = propagator.Extract(ctx, metadataCarrier(md))
+	return s.tracing().Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("rpc.system", "grpc"), attribute.String("rpc.method", method)))
+}
+
+// TracingUnaryInterceptor starts a server span for every unary RPC, continuing the caller's
+// trace when its context is present in the request metadata.
+func (s *Server) TracingUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := s.startRPCSpan(ctx, info.FullMethod)
+		resp, err := handler(ctx, req)
+		endSpan(span, err)
+		return resp, err
+	}
+}
+
+type tracedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (t *tracedStream) Context() context.Context {
+	return t.ctx
+}
+
+// TracingStreamInterceptor starts a server span for every streaming RPC.
+func (s *Server) TracingStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := s.startRPCSpan(ss.Context(), info.FullMethod)
+		err := handler(srv, &tracedStream{ServerStream: ss, ctx: ctx})
+		endSpan(span, err)
+		return err
+	}
+}
+
+// injectTrace stores the trace context of ctx in the message metadata, so that the spans of
+// the deliveries, which may happen on other nodes, continue the sender's trace.
+func injectTrace(ctx context.Context, msg *ChatMessage) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+	if msg.Metadata == nil {
+		msg.Metadata = map[string]string{}
+	}
+	propagator.Inject(ctx, propagation.MapCarrier(msg.Metadata))
+}
+
+func extractTrace(msg *ChatMessage) context.Context {
+	return propagator.Extract(context.Background(), propagation.MapCarrier(msg.GetMetadata()))
+}
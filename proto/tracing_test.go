@@ -0,0 +1,102 @@
+package proto
+
+import (
+	"context"
+	"testing"
+
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// newTracedServer records the spans of a server serving the chat service with the tracing
+// interceptors.
+func newTracedServer(t *testing.T) (*Server, ChatServiceClient, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	s := newTestServer(t)
+	s.SetTracerProvider(provider)
+	conn := dialTestServerWith(t, s, []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.TracingUnaryInterceptor()),
+		grpc.ChainStreamInterceptor(s.TracingStreamInterceptor()),
+	})
+	return s, NewChatServiceClient(conn), exporter
+}
+
+func spanNamed(spans tracetest.SpanStubs, name string) (tracetest.SpanStub, bool) {
+	for _, span := range spans {
+		if span.Name == name {
+			return span, true
+		}
+	}
+	return tracetest.SpanStub{}, false
+}
+
+func TestTracingFollowsAMessageToItsDelivery(t *testing.T) {
+	s, chat, exporter := newTracedServer(t)
+	alice := subscribe(t, chat, "room", "alice")
+	waitFor(t, "the room to be created", func() bool { return connected(s, "room") == 1 })
+
+	// The caller's trace is continued from the traceparent metadata.
+	caller := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+	md := metadata.MD{}
+	propagator.Inject(trace.ContextWithSpanContext(context.Background(), caller), metadataCarrier(md))
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+	if _, err := chat.SendMessage(ctx, &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte("hi")}); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, alice, 1)
+	waitFor(t, "the delivery span to end", func() bool {
+		_, ended := spanNamed(exporter.GetSpans(), "deliver")
+		return ended
+	})
+
+	spans := exporter.GetSpans()
+	rpc, exists := spanNamed(spans, "/"+ChatService_ServiceDesc.ServiceName+"/SendMessage")
+	if !exists {
+		t.Fatal("no span for SendMessage")
+	}
+	if rpc.Parent.SpanID() != caller.SpanID() || rpc.SpanKind != trace.SpanKindServer {
+		t.Errorf("SendMessage span has parent %s and kind %s, want %s and server", rpc.Parent.SpanID(), rpc.SpanKind, caller.SpanID())
+	}
+	for _, name := range []string{"validate", "broker.publish", "persist", "deliver"} {
+		span, exists := spanNamed(spans, name)
+		if !exists {
+			t.Errorf("no %s span", name)
+			continue
+		}
+		if span.SpanContext.TraceID() != caller.TraceID() {
+			t.Errorf("%s span is in trace %s, want the caller's %s", name, span.SpanContext.TraceID(), caller.TraceID())
+		}
+	}
+	if validate, _ := spanNamed(spans, "validate"); validate.Parent.SpanID() != rpc.SpanContext.SpanID() {
+		t.Errorf("validate span is not a child of the SendMessage span")
+	}
+}
+
+func TestTracingRecordsRejections(t *testing.T) {
+	_, chat, exporter := newTracedServer(t)
+	if _, err := chat.SendMessage(context.Background(), &ChatMessage{Recipient: "room"}); err == nil {
+		t.Fatal("a message without a sender was accepted")
+	}
+	spans := exporter.GetSpans()
+	for _, name := range []string{"validate", "/" + ChatService_ServiceDesc.ServiceName + "/SendMessage"} {
+		span, exists := spanNamed(spans, name)
+		if !exists {
+			t.Errorf("no %s span", name)
+			continue
+		}
+		if span.Status.Code != otelcodes.Error || len(span.Events) == 0 {
+			t.Errorf("%s span has status %v and %d events, want an error recorded", name, span.Status, len(span.Events))
+		}
+	}
+}
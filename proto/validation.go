@@ -0,0 +1,114 @@
+package proto
+
+import (
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type ValidationConfig struct {
+	MaxContentBytes int           `yaml:"max_content_bytes" toml:"max_content_bytes"`
+	MaxClockSkew    time.Duration `yaml:"max_clock_skew" toml:"max_clock_skew"`
+}
+
+// A MessageValidator inspects a single aspect of a message and reports every field it rejects.
+type MessageValidator func(msg *ChatMessage, cfg ValidationConfig) []*errdetails.BadRequest_FieldViolation
+
+var defaultValidators = []MessageValidator{
+	validateParticipants,
+	validateContent,
+	validateTimestamp,
+}
+
+func violation(field, description string) *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{Field: field, Description: description}
+}
+
+func validateParticipants(msg *ChatMessage, _ ValidationConfig) []*errdetails.BadRequest_FieldViolation {
+	var violations []*errdetails.BadRequest_FieldViolation
+	if strings.TrimSpace(msg.GetSender()) == "" {
+		violations = append(violations, violation("sender", "must not be empty"))
+	}
+	if strings.TrimSpace(msg.GetRecipient()) == "" {
+		violations = append(violations, violation("recipient", "must not be empty"))
+	}
+	return violations
+}
+
+func isTextContent(contentType string) bool {
+	return contentType == "" || strings.HasPrefix(contentType, "text/")
+}
+
+func validateContent(msg *ChatMessage, cfg ValidationConfig) []*errdetails.BadRequest_FieldViolation {
+	var violations []*errdetails.BadRequest_FieldViolation
+	if len(msg.GetContent()) == 0 {
+		violations = append(violations, violation("content", "must not be empty"))
+	}
+	if len(msg.GetContent()) > cfg.MaxContentBytes {
+		violations = append(violations, violation("content",
+			fmt.Sprintf("must not exceed %d bytes, got %d", cfg.MaxContentBytes, len(msg.GetContent()))))
+	}
+	if contentType := msg.GetContentType(); contentType != "" {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			violations = append(violations, violation("contentType", "must be a MIME type, got "+strconv.Quote(contentType)))
+		}
+	}
+	if isTextContent(msg.GetContentType()) && !utf8.Valid(msg.GetContent()) {
+		violations = append(violations, violation("content", "must be valid UTF-8 for text content"))
+	}
+	return violations
+}
+
+// validateTimestamp stamps messages that arrive without a timestamp and rejects the ones
+// whose clock is too far off from the server's.
+func validateTimestamp(msg *ChatMessage, cfg ValidationConfig) []*errdetails.BadRequest_FieldViolation {
+	now := time.Now()
+	if msg.GetTimestamp() == 0 {
+		msg.Timestamp = uint64(now.Unix())
+		return nil
+	}
+	skew := now.Sub(time.Unix(int64(msg.GetTimestamp()), 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > cfg.MaxClockSkew {
+		return []*errdetails.BadRequest_FieldViolation{
+			violation("timestamp", fmt.Sprintf("differs from server time by more than %s", cfg.MaxClockSkew)),
+		}
+	}
+	return nil
+}
+
+// validateMessage runs every validator and folds the violations into a single InvalidArgument
+// status. Messages for rooms that don't exist are rejected with NotFound, unless the server is
+// part of a cluster and the room may live on another node.
+func (s *Server) validateMessage(msg *ChatMessage) error {
+	var violations []*errdetails.BadRequest_FieldViolation
+	cfg := s.config.Load().Validation
+	for _, validate := range s.validators {
+		violations = append(violations, validate(msg, cfg)...)
+	}
+	if len(violations) > 0 {
+		return statusWithViolations(codes.InvalidArgument, "invalid message", violations)
+	}
+	if !s.distributed && s.getRoom(msg.GetRecipient()) == nil {
+		return statusWithViolations(codes.NotFound, "room not found",
+			[]*errdetails.BadRequest_FieldViolation{violation("recipient", "room "+msg.GetRecipient()+" does not exist")})
+	}
+	return nil
+}
+
+func statusWithViolations(code codes.Code, msg string, violations []*errdetails.BadRequest_FieldViolation) error {
+	st := status.New(code, msg)
+	if detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
@@ -0,0 +1,62 @@
+package proto
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateMessage(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) { cfg.Validation.MaxContentBytes = 8 })
+	s.importRoom(&RoomState{RoomName: "room"})
+	now := uint64(time.Now().Unix())
+	tests := []struct {
+		name string
+		msg  *ChatMessage
+		want codes.Code
+		// fields are the fields reported in the BadRequest details, in order.
+		fields []string
+	}{
+		{"valid", &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte("hi"), Timestamp: now}, codes.OK, nil},
+		{"binary", &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte{0xff}, ContentType: "application/octet-stream", Timestamp: now}, codes.OK, nil},
+		{"no timestamp", &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte("hi")}, codes.OK, nil},
+		{"empty content", &ChatMessage{Sender: "alice", Recipient: "room", Timestamp: now}, codes.InvalidArgument, []string{"content"}},
+		{"oversized content", &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte("too long!"), Timestamp: now}, codes.InvalidArgument, []string{"content"}},
+		{"invalid UTF-8", &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte{0xff}, ContentType: "text/plain", Timestamp: now}, codes.InvalidArgument, []string{"content"}},
+		{"bad content type", &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte("hi"), ContentType: "text/", Timestamp: now}, codes.InvalidArgument, []string{"contentType"}},
+		{"no sender", &ChatMessage{Sender: " ", Recipient: "room", Content: []byte("hi"), Timestamp: now}, codes.InvalidArgument, []string{"sender"}},
+		{"no recipient", &ChatMessage{Sender: "alice", Content: []byte("hi"), Timestamp: now}, codes.InvalidArgument, []string{"recipient"}},
+		{"unknown room", &ChatMessage{Sender: "alice", Recipient: "nowhere", Content: []byte("hi"), Timestamp: now}, codes.NotFound, []string{"recipient"}},
+		{"clock skew", &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte("hi"), Timestamp: now - 3600}, codes.InvalidArgument, []string{"timestamp"}},
+		{"every violation", &ChatMessage{Content: []byte("too long!\xff"), Timestamp: now + 3600}, codes.InvalidArgument, []string{"sender", "recipient", "content", "content", "timestamp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.validateMessage(tt.msg)
+			st := status.Convert(err)
+			if st.Code() != tt.want {
+				t.Fatalf("validateMessage: %v, want %s", err, tt.want)
+			}
+			var fields []string
+			for _, detail := range st.Details() {
+				badRequest, ok := detail.(*errdetails.BadRequest)
+				if !ok {
+					t.Fatalf("unexpected detail %T", detail)
+				}
+				for _, v := range badRequest.GetFieldViolations() {
+					if v.GetDescription() == "" {
+						t.Errorf("the %s violation has no description", v.GetField())
+					}
+					fields = append(fields, v.GetField())
+				}
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("violations of %q, want %q", fields, tt.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,369 @@
+package proto
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = 25 * time.Second
+)
+
+type WebConfig struct {
+	// Port serves gRPC-Web and the WebSocket bridge over HTTP. They are disabled when it is empty.
+	Port string `yaml:"port" toml:"port"`
+	// AllowedOrigins are the origins browsers may call from, such as https://chat.example.com.
+	// "*" allows any origin. Requests without an Origin header don't come from browsers and are
+	// always allowed.
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins"`
+}
+
+func originAllowed(origin string, allowed []string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(strings.TrimSuffix(a, "/"), u.Scheme+"://"+u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewWebHandler serves the services of grpcServer over gRPC-Web, and the JSON WebSocket
+// bridge to srv at /ws. Both only accept browser requests from cfg.AllowedOrigins.
+func NewWebHandler(grpcServer *grpc.Server, srv *Server, cfg WebConfig) http.Handler {
+	allowed := func(origin string) bool { return originAllowed(origin, cfg.AllowedOrigins) }
+	wrapped := grpcweb.WrapServer(grpcServer,
+		grpcweb.WithOriginFunc(allowed),
+		grpcweb.WithWebsockets(true),
+		grpcweb.WithWebsocketOriginFunc(func(r *http.Request) bool { return allowed(r.Header.Get("Origin")) }))
+	bridge := &webSocketBridge{
+		server: srv,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return allowed(r.Header.Get("Origin")) },
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case wrapped.IsGrpcWebRequest(r), wrapped.IsAcceptableGrpcCorsRequest(r), wrapped.IsGrpcWebSocketRequest(r):
+			wrapped.ServeHTTP(w, r)
+		case r.URL.Path == "/ws":
+			bridge.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// webFrame is a message of the WebSocket bridge. Clients send join, send and leave frames;
+// the server sends message frames, error frames when a request fails and left frames when a
+// subscription ends.
+type webFrame struct {
+	Type    string      `json:"type"`
+	Room    string      `json:"room,omitempty"`
+	Content string      `json:"content,omitempty"`
+	Message *webMessage `json:"message,omitempty"`
+	Code    string      `json:"code,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// webMessage is a ChatMessage as JSON. Text content is sent as is and other content types
+// are base64 encoded.
+type webMessage struct {
+	Sender      string            `json:"sender"`
+	Room        string            `json:"room"`
+	Content     string            `json:"content"`
+	Encoding    string            `json:"encoding,omitempty"`
+	ContentType string            `json:"contentType,omitempty"`
+	Timestamp   uint64            `json:"timestamp"`
+	Sequence    uint64            `json:"sequence,omitempty"`
+	Sequencer   string            `json:"sequencer,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+func newWebMessage(msg *ChatMessage, room string) *webMessage {
+	m := &webMessage{
+		Sender:      msg.GetSender(),
+		Room:        room,
+		ContentType: msg.GetContentType(),
+		Timestamp:   msg.GetTimestamp(),
+		Sequence:    msg.GetSequence(),
+		Sequencer:   msg.GetSequencer(),
+		Metadata:    msg.GetMetadata(),
+	}
+	if isTextContent(msg.GetContentType()) {
+		m.Content = string(msg.GetContent())
+	} else {
+		m.Content = base64.StdEncoding.EncodeToString(msg.GetContent())
+		m.Encoding = "base64"
+	}
+	return m
+}
+
+type webSocketBridge struct {
+	server   *Server
+	upgrader websocket.Upgrader
+}
+
+// webSocketConn is one browser connected to the bridge, subscribed as a single user to any
+// number of rooms. Its requests go through the handlers and interceptors of the gRPC server,
+// so they are traced, logged and measured like gRPC calls.
+type webSocketConn struct {
+	server *Server
+	unary  grpc.UnaryServerInterceptor
+	stream grpc.StreamServerInterceptor
+	ws     *websocket.Conn
+	user   string
+	ctx    context.Context
+	writeM sync.Mutex
+	mu     sync.Mutex
+	rooms  map[string]context.CancelFunc
+}
+
+// ServeHTTP upgrades /ws?user=<name> to a WebSocket. Servers with user tokens also need
+// &token=<user token>.
+func (b *webSocketBridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user := r.URL.Query().Get("user")
+	if user == "" {
+		http.Error(w, "the user query parameter is required", http.StatusBadRequest)
+		return
+	}
+	ws, err := b.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(userTokenKey, token))
+	}
+	conn := &webSocketConn{
+		server: b.server,
+		unary:  chainUnary(b.server.UnaryInterceptors()),
+		stream: chainStream(b.server.StreamInterceptors()),
+		ws:     ws,
+		user:   user,
+		ctx:    ctx,
+		rooms:  map[string]context.CancelFunc{},
+	}
+	b.server.logger.Load().Info("websocket connected", "client_id", user, "peer", r.RemoteAddr)
+	conn.serve()
+	ws.Close()
+	b.server.logger.Load().Info("websocket disconnected", "client_id", user)
+}
+
+func (c *webSocketConn) write(frame *webFrame) error {
+	c.writeM.Lock()
+	defer c.writeM.Unlock()
+	_ = c.ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return c.ws.WriteJSON(frame)
+}
+
+func (c *webSocketConn) writeError(room string, err error) {
+	st := status.Convert(err)
+	_ = c.write(&webFrame{Type: "error", Room: room, Code: st.Code().String(), Error: st.Message()})
+}
+
+// serve reads frames until the browser goes away, then ends every subscription.
+func (c *webSocketConn) serve() {
+	defer c.leaveAll()
+	_ = c.ws.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	stopPings := make(chan struct{})
+	defer close(stopPings)
+	go func() {
+		ticker := time.NewTicker(wsPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.writeM.Lock()
+				err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+				c.writeM.Unlock()
+				if err != nil {
+					return
+				}
+			case <-stopPings:
+				return
+			}
+		}
+	}()
+	for {
+		var frame webFrame
+		if err := c.ws.ReadJSON(&frame); err != nil {
+			if _, ok := err.(*websocket.CloseError); ok || websocket.IsUnexpectedCloseError(err) {
+				return
+			}
+			if _, ok := err.(net.Error); ok {
+				return
+			}
+			c.writeError("", status.Error(codes.InvalidArgument, "malformed frame: "+err.Error()))
+			return
+		}
+		switch frame.Type {
+		case "join":
+			c.join(frame.Room)
+		case "send":
+			c.send(frame.Room, frame.Content)
+		case "leave":
+			c.leave(frame.Room)
+		default:
+			c.writeError(frame.Room, status.Errorf(codes.InvalidArgument, "unknown frame type %q", frame.Type))
+		}
+	}
+}
+
+func (c *webSocketConn) join(room string) {
+	c.mu.Lock()
+	if _, joined := c.rooms[room]; joined {
+		c.mu.Unlock()
+		c.writeError(room, status.Errorf(codes.AlreadyExists, "already joined %s", room))
+		return
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.rooms[room] = cancel
+	c.mu.Unlock()
+	go func() {
+		stream := &webSubscribeStream{ctx: ctx, conn: c, room: room, request: &RoomRequest{
+			RoomName:                 room,
+			InitialConnectionRequest: &ConnectionRequest{ServerID: c.user},
+		}}
+		info := &grpc.StreamServerInfo{FullMethod: "/ChatService/Subscribe", IsServerStream: true}
+		err := c.stream(c.server, stream, info, _ChatService_Subscribe_Handler)
+		c.mu.Lock()
+		delete(c.rooms, room)
+		c.mu.Unlock()
+		cancel()
+		frame := &webFrame{Type: "left", Room: room}
+		if err != nil && ctx.Err() == nil {
+			st := status.Convert(err)
+			frame.Code, frame.Error = st.Code().String(), st.Message()
+		}
+		_ = c.write(frame)
+	}()
+}
+
+func (c *webSocketConn) send(room, content string) {
+	msg := &ChatMessage{
+		Sender:    c.user,
+		Recipient: room,
+		Content:   []byte(content),
+		Timestamp: uint64(time.Now().Unix()),
+	}
+	decode := func(m interface{}) error {
+		proto.Merge(m.(*ChatMessage), msg)
+		return nil
+	}
+	if _, err := _ChatService_SendMessage_Handler(c.server, c.ctx, decode, c.unary); err != nil {
+		c.writeError(room, err)
+	}
+}
+
+func (c *webSocketConn) leave(room string) {
+	c.mu.Lock()
+	cancel, joined := c.rooms[room]
+	c.mu.Unlock()
+	if !joined {
+		c.writeError(room, status.Errorf(codes.NotFound, "not in %s", room))
+		return
+	}
+	cancel()
+}
+
+func (c *webSocketConn) leaveAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cancel := range c.rooms {
+		cancel()
+	}
+}
+
+// chainUnary runs interceptors around a handler, the first one outermost, like
+// grpc.ChainUnaryInterceptor.
+func chainUnary(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// chainStream is chainUnary for streaming RPCs.
+func chainStream(interceptors []grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(srv interface{}, ss grpc.ServerStream) error {
+				return interceptor(srv, ss, info, next)
+			}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// webSubscribeStream lets Subscribe deliver to a WebSocket as if it were a gRPC stream. It
+// receives request once, as a gRPC stream receives the client's request. Heartbeats are
+// dropped, since the bridge pings the browser at the WebSocket level.
+type webSubscribeStream struct {
+	ctx     context.Context
+	conn    *webSocketConn
+	room    string
+	request *RoomRequest
+}
+
+func (s *webSubscribeStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *webSubscribeStream) SendMsg(m interface{}) error {
+	msg := m.(*ChatMessage)
+	if msg.GetContentType() == HeartbeatContentType {
+		return nil
+	}
+	return s.conn.write(&webFrame{Type: "message", Room: s.room, Message: newWebMessage(msg, s.room)})
+}
+
+func (s *webSubscribeStream) RecvMsg(m interface{}) error {
+	if s.request == nil {
+		return io.EOF
+	}
+	proto.Merge(m.(*RoomRequest), s.request)
+	s.request = nil
+	return nil
+}
+
+func (s *webSubscribeStream) SetHeader(metadata.MD) error  { return nil }
+func (s *webSubscribeStream) SendHeader(metadata.MD) error { return nil }
+func (s *webSubscribeStream) SetTrailer(metadata.MD)       {}
@@ -0,0 +1,60 @@
+package proto
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+)
+
+func TestWebSocketBridgeIsInstrumented(t *testing.T) {
+	s := newTestServer(t)
+	server := httptest.NewServer(NewWebHandler(grpc.NewServer(), s, WebConfig{}))
+	defer server.Close()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?user=alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	if err := ws.WriteJSON(&webFrame{Type: "join", Room: "room"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the room to be created", func() bool { return connected(s, "room") == 1 })
+	for _, frame := range []*webFrame{
+		{Type: "send", Room: "room", Content: "hello"},
+		{Type: "send", Room: "nowhere", Content: "hello"},
+	} {
+		if err := ws.WriteJSON(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The message is delivered asynchronously, so it may come after the error.
+	received := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		var frame webFrame
+		if err := ws.ReadJSON(&frame); err != nil {
+			t.Fatal(err)
+		}
+		received[frame.Type] = true
+	}
+	if !received["message"] || !received["error"] {
+		t.Fatalf("received %v, want a message and an error", received)
+	}
+
+	sendMessage := "/" + ChatService_ServiceDesc.ServiceName + "/SendMessage"
+	families := scrape(t, s)
+	for _, code := range []string{"OK", "NotFound"} {
+		if got, _ := value(families, "grpc_server_handled_total", "method", sendMessage, "code", code); got != 1 {
+			t.Errorf("SendMessage calls handled with %s: %v, want 1", code, got)
+		}
+	}
+	ws.Close()
+	subscribe := "/" + ChatService_ServiceDesc.ServiceName + "/Subscribe"
+	waitFor(t, "the subscription to be measured", func() bool {
+		handled, _ := value(scrape(t, s), "grpc_server_handling_seconds", "method", subscribe)
+		return handled == 1
+	})
+}
@@ -0,0 +1,385 @@
+package proto
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WebhookMessage is the type of the events sent for messages. Joins, leaves and room creations
+// are sent with the type of their audit action.
+const WebhookMessage = "message"
+
+// Headers of a webhook request. The signature is the hex HMAC-SHA256 of the timestamp, a dot
+// and the body, keyed with the endpoint's secret.
+const (
+	WebhookEventHeader     = "X-Chat-Event"
+	WebhookDeliveryHeader  = "X-Chat-Delivery"
+	WebhookTimestampHeader = "X-Chat-Timestamp"
+	WebhookSignatureHeader = "X-Chat-Signature"
+)
+
+type WebhookConfig struct {
+	// Endpoints receive the events of one room, as room=url, or of every room, as a plain url.
+	Endpoints []string `yaml:"endpoints" toml:"endpoints"`
+	// Secret signs the requests sent to Endpoints.
+	Secret string `yaml:"secret" toml:"secret"`
+	// MaxAttempts bounds the requests made for one event before it is dead-lettered.
+	MaxAttempts    int           `yaml:"max_attempts" toml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff" toml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" toml:"max_backoff"`
+	Timeout        time.Duration `yaml:"timeout" toml:"timeout"`
+	// After BreakerThreshold consecutive failures an endpoint is skipped for BreakerCooldown,
+	// and its events are dead-lettered without being attempted.
+	BreakerThreshold int           `yaml:"breaker_threshold" toml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown" toml:"breaker_cooldown"`
+	// QueueSize is the number of events that may wait for each endpoint.
+	QueueSize int `yaml:"queue_size" toml:"queue_size"`
+	// DeadLetterFile is appended with the events that could not be delivered, one JSON object
+	// per line.
+	DeadLetterFile string `yaml:"dead_letter_file" toml:"dead_letter_file"`
+}
+
+// WebhookEvent is the JSON body of a webhook request.
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Room      string      `json:"room"`
+	Timestamp uint64      `json:"timestamp"`
+	Actor     string      `json:"actor,omitempty"`
+	Detail    string      `json:"detail,omitempty"`
+	Message   *webMessage `json:"message,omitempty"`
+}
+
+type webhookDelivery struct {
+	event *WebhookEvent
+	body  []byte
+}
+
+// webhookDeadLetter records an event that was given up on.
+type webhookDeadLetter struct {
+	Time     time.Time       `json:"time"`
+	Endpoint string          `json:"endpoint"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Event    json.RawMessage `json:"event"`
+}
+
+// webhookEndpoint delivers the events queued for one URL in order. failures and openUntil
+// belong to its worker.
+type webhookEndpoint struct {
+	url       string
+	room      string
+	secret    string
+	queue     chan *webhookDelivery
+	failures  int
+	openUntil time.Time
+}
+
+// Webhooks posts room events to HTTP endpoints. Each endpoint has its own queue and worker,
+// so that a slow or failing endpoint doesn't hold back the others.
+type Webhooks struct {
+	cfg    WebhookConfig
+	client *http.Client
+	// logger and metrics are replaced by SetWebhooks while the workers run.
+	logger  atomic.Pointer[slog.Logger]
+	metrics atomic.Pointer[Metrics]
+
+	mu        sync.RWMutex
+	endpoints []*webhookEndpoint
+	closed    bool
+	workers   sync.WaitGroup
+	// ctx is cancelled when Close gives up on the remaining deliveries.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	deadMu      sync.Mutex
+	deadLetters *os.File
+}
+
+// NewWebhooks registers the endpoints of cfg, which should have been checked with Validate.
+func NewWebhooks(cfg WebhookConfig) (*Webhooks, error) {
+	w := &Webhooks{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+	w.logger.Store(slog.Default())
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	if cfg.DeadLetterFile != "" {
+		f, err := os.OpenFile(cfg.DeadLetterFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		w.deadLetters = f
+	}
+	for _, spec := range cfg.Endpoints {
+		room, url := parseWebhookSpec(spec)
+		w.Register(room, url, cfg.Secret)
+	}
+	return w, nil
+}
+
+// parseWebhookSpec splits room=url. URLs may contain = in their query, so a room is only read
+// from before the scheme.
+func parseWebhookSpec(spec string) (room, url string) {
+	scheme := strings.Index(spec, "://")
+	if i := strings.Index(spec, "="); i >= 0 && (scheme < 0 || i < scheme) {
+		return spec[:i], spec[i+1:]
+	}
+	return "", spec
+}
+
+// Register sends the events of room to url, signed with secret. An empty room registers the
+// endpoint for every room.
+func (w *Webhooks) Register(room, url, secret string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	ep := &webhookEndpoint{url: url, room: room, secret: secret, queue: make(chan *webhookDelivery, w.cfg.QueueSize)}
+	w.endpoints = append(w.endpoints, ep)
+	w.workers.Add(1)
+	go w.run(ep)
+}
+
+// SetWebhooks sends the server's room events to w.
+func (s *Server) SetWebhooks(w *Webhooks) {
+	w.logger.Store(s.logger.Load().With("component", "webhooks"))
+	w.metrics.Store(s.metrics)
+	s.webhooks.Store(w)
+}
+
+func (w *Webhooks) publishMessage(room string, msg *ChatMessage) {
+	if w == nil {
+		return
+	}
+	w.publish(&WebhookEvent{
+		Type:      WebhookMessage,
+		Room:      room,
+		Timestamp: msg.GetTimestamp(),
+		Actor:     msg.GetSender(),
+		Message:   newWebMessage(msg, room),
+	})
+}
+
+func (w *Webhooks) publishAudit(event *AuditEvent) {
+	if w == nil {
+		return
+	}
+	switch event.GetAction() {
+	case AuditJoin, AuditLeave, AuditRoomCreated:
+	default:
+		return
+	}
+	w.publish(&WebhookEvent{
+		Type:      event.GetAction(),
+		Room:      event.GetRoomName(),
+		Timestamp: event.GetTimestamp(),
+		Actor:     event.GetActor(),
+		Detail:    event.GetDetail(),
+	})
+}
+
+// publish queues event for every endpoint registered for its room. It never blocks: an event
+// that finds an endpoint's queue full is dead-lettered for that endpoint.
+func (w *Webhooks) publish(event *WebhookEvent) {
+	event.ID = randomID()
+	body, err := json.Marshal(event)
+	if err != nil {
+		w.logger.Load().Error("encoding webhook event", "type", event.Type, "error", err.Error())
+		return
+	}
+	delivery := &webhookDelivery{event: event, body: body}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return
+	}
+	for _, ep := range w.endpoints {
+		if ep.room != "" && ep.room != event.Room {
+			continue
+		}
+		select {
+		case ep.queue <- delivery:
+		default:
+			w.deadLetter(ep, delivery, 0, errors.New("queue full"))
+		}
+	}
+}
+
+// randomID returns 128 random bits in hex.
+func randomID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func (w *Webhooks) run(ep *webhookEndpoint) {
+	defer w.workers.Done()
+	for delivery := range ep.queue {
+		w.deliver(ep, delivery)
+	}
+}
+
+// deliver posts delivery until it succeeds, is refused, runs out of attempts or the endpoint's
+// circuit opens. Only failures that may be temporary are retried and count towards the
+// circuit breaker.
+func (w *Webhooks) deliver(ep *webhookEndpoint, delivery *webhookDelivery) {
+	backoff := w.cfg.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		if time.Now().Before(ep.openUntil) {
+			w.deadLetter(ep, delivery, attempt-1, errors.New("circuit open"))
+			return
+		}
+		retry, err := w.post(ep, delivery)
+		if err == nil {
+			ep.failures = 0
+			w.metrics.Load().webhookDelivered("delivered")
+			return
+		}
+		if retry {
+			ep.failures++
+			if ep.failures >= w.cfg.BreakerThreshold {
+				// Once open, every failure keeps it open until a delivery succeeds.
+				ep.openUntil = time.Now().Add(w.cfg.BreakerCooldown)
+				if ep.failures == w.cfg.BreakerThreshold {
+					w.logger.Load().Warn("webhook circuit opened", "endpoint", ep.url, "cooldown", w.cfg.BreakerCooldown.String())
+				}
+			}
+		}
+		if !retry || attempt >= w.cfg.MaxAttempts {
+			w.deadLetter(ep, delivery, attempt, err)
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-w.ctx.Done():
+			w.deadLetter(ep, delivery, attempt, fmt.Errorf("shutting down after: %w", err))
+			return
+		}
+		if backoff *= 2; backoff > w.cfg.MaxBackoff {
+			backoff = w.cfg.MaxBackoff
+		}
+	}
+}
+
+// post makes one attempt at delivery, and reports whether a failure is worth retrying.
+func (w *Webhooks) post(ep *webhookEndpoint, delivery *webhookDelivery) (bool, error) {
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, ep.url, bytes.NewReader(delivery.body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, delivery.event.Type)
+	req.Header.Set(WebhookDeliveryHeader, delivery.event.ID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	if ep.secret != "" {
+		req.Header.Set(WebhookSignatureHeader, signWebhook(ep.secret, timestamp, delivery.body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusRequestTimeout:
+		return true, fmt.Errorf("endpoint responded %s", resp.Status)
+	default:
+		return false, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature reports whether body and the headers of a webhook request were signed
+// with secret. Receivers should also reject timestamps too far in the past, so that a captured
+// request can't be replayed later.
+func VerifyWebhookSignature(secret string, header http.Header, body []byte) bool {
+	expected := signWebhook(secret, header.Get(WebhookTimestampHeader), body)
+	return hmac.Equal([]byte(expected), []byte(header.Get(WebhookSignatureHeader)))
+}
+
+func (w *Webhooks) deadLetter(ep *webhookEndpoint, delivery *webhookDelivery, attempts int, err error) {
+	w.metrics.Load().webhookDelivered("dead_letter")
+	w.logger.Load().Warn("webhook delivery failed", "endpoint", ep.url, "event_id", delivery.event.ID,
+		"type", delivery.event.Type, "attempts", attempts, "error", err.Error())
+	if w.deadLetters == nil {
+		return
+	}
+	line, merr := json.Marshal(&webhookDeadLetter{
+		Time:     time.Now().UTC(),
+		Endpoint: ep.url,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Event:    delivery.body,
+	})
+	if merr != nil {
+		return
+	}
+	w.deadMu.Lock()
+	defer w.deadMu.Unlock()
+	if _, werr := w.deadLetters.Write(append(line, '\n')); werr != nil {
+		w.logger.Load().Error("writing webhook dead letter", "error", werr.Error())
+	}
+}
+
+// Close stops accepting events and waits for the queued ones to be delivered. When ctx is done
+// first, pending retries are abandoned and dead-lettered.
+func (w *Webhooks) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	for _, ep := range w.endpoints {
+		close(ep.queue)
+	}
+	w.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		w.workers.Wait()
+		close(drained)
+	}()
+	var err error
+	defer w.cancel()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+		w.cancel()
+		<-drained
+	}
+	if w.deadLetters != nil {
+		if cerr := w.deadLetters.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
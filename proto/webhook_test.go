@@ -0,0 +1,212 @@
+package proto
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "webhook secret"
+
+// newTestWebhooks delivers the events of every room to url, retrying quickly, and returns the
+// file events are dead-lettered to.
+func newTestWebhooks(t *testing.T, url string, configure ...func(*WebhookConfig)) (*Webhooks, string) {
+	t.Helper()
+	cfg := WebhookConfig{
+		Endpoints:        []string{url},
+		Secret:           testWebhookSecret,
+		MaxAttempts:      3,
+		InitialBackoff:   time.Millisecond,
+		MaxBackoff:       4 * time.Millisecond,
+		Timeout:          5 * time.Second,
+		BreakerThreshold: 10,
+		BreakerCooldown:  time.Hour,
+		QueueSize:        10,
+		DeadLetterFile:   filepath.Join(t.TempDir(), "dead_letters.log"),
+	}
+	for _, c := range configure {
+		c(&cfg)
+	}
+	w, err := NewWebhooks(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close(context.Background()) })
+	return w, cfg.DeadLetterFile
+}
+
+// respond answers the requests it serves with statuses in turn, repeating the last one, and
+// counts them.
+func respond(requests *atomic.Int32, statuses ...int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		i := int(requests.Add(1)) - 1
+		if i >= len(statuses) {
+			i = len(statuses) - 1
+		}
+		w.WriteHeader(statuses[i])
+	}
+}
+
+func readDeadLetters(t *testing.T, path string) []webhookDeadLetter {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var letters []webhookDeadLetter
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var letter webhookDeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			t.Fatalf("dead letter %q: %v", scanner.Text(), err)
+		}
+		letters = append(letters, letter)
+	}
+	return letters
+}
+
+func TestWebhookRequestsAreSigned(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+	}))
+	defer endpoint.Close()
+	w, _ := newTestWebhooks(t, endpoint.URL)
+	w.publish(&WebhookEvent{Type: WebhookMessage, Room: "room", Actor: "alice"})
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	r, body := <-requests, <-bodies
+	if !VerifyWebhookSignature(testWebhookSecret, r.Header, body) {
+		t.Errorf("the signature %q does not verify", r.Header.Get(WebhookSignatureHeader))
+	}
+	if VerifyWebhookSignature("guess", r.Header, body) {
+		t.Error("the signature verifies with another secret")
+	}
+	if VerifyWebhookSignature(testWebhookSecret, r.Header, append(body, ' ')) {
+		t.Error("the signature verifies another body")
+	}
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.ID == "" || r.Header.Get(WebhookDeliveryHeader) != event.ID {
+		t.Errorf("event %q delivered as %q", event.ID, r.Header.Get(WebhookDeliveryHeader))
+	}
+	if event.Type != WebhookMessage || r.Header.Get(WebhookEventHeader) != WebhookMessage || event.Actor != "alice" {
+		t.Errorf("delivered %+v with the event header %q", event, r.Header.Get(WebhookEventHeader))
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int32
+		// dead is the attempts of the dead-lettered event, or 0 if it was delivered.
+		dead int
+	}{
+		{"delivered", []int{http.StatusOK}, 1, 0},
+		{"retried until delivered", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusNoContent}, 3, 0},
+		{"refused", []int{http.StatusBadRequest}, 1, 1},
+		{"out of attempts", []int{http.StatusInternalServerError}, 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			endpoint := httptest.NewServer(respond(&requests, tt.statuses...))
+			defer endpoint.Close()
+			w, deadLetters := newTestWebhooks(t, endpoint.URL)
+			w.publish(&WebhookEvent{Type: WebhookMessage, Room: "room"})
+			if err := w.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if got := requests.Load(); got != tt.requests {
+				t.Errorf("%d requests, want %d", got, tt.requests)
+			}
+			letters := readDeadLetters(t, deadLetters)
+			switch {
+			case tt.dead == 0 && len(letters) > 0:
+				t.Errorf("the event was dead-lettered: %+v", letters)
+			case tt.dead > 0 && (len(letters) != 1 || letters[0].Attempts != tt.dead):
+				t.Errorf("dead letters %+v, want one after %d attempts", letters, tt.dead)
+			}
+		})
+	}
+}
+
+func TestWebhookBreakerSkipsFailingEndpoints(t *testing.T) {
+	var requests atomic.Int32
+	endpoint := httptest.NewServer(respond(&requests, http.StatusInternalServerError))
+	defer endpoint.Close()
+	w, deadLetters := newTestWebhooks(t, endpoint.URL, func(cfg *WebhookConfig) {
+		cfg.MaxAttempts = 5
+		cfg.BreakerThreshold = 2
+	})
+	w.publish(&WebhookEvent{Type: WebhookMessage, Room: "room"})
+	w.publish(&WebhookEvent{Type: WebhookMessage, Room: "room"})
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := requests.Load(); got != 2 {
+		t.Errorf("%d requests, want the 2 made before the circuit opened", got)
+	}
+	letters := readDeadLetters(t, deadLetters)
+	if len(letters) != 2 {
+		t.Fatalf("dead letters %+v, want both events", letters)
+	}
+	for i, attempts := range []int{2, 0} {
+		if letters[i].Attempts != attempts || !strings.Contains(letters[i].Error, "circuit open") {
+			t.Errorf("dead letter %d: %+v, want the circuit open after %d attempts", i, letters[i], attempts)
+		}
+	}
+}
+
+func TestSetWebhooksWhileDelivering(t *testing.T) {
+	var requests atomic.Int32
+	endpoint := httptest.NewServer(respond(&requests, http.StatusOK))
+	defer endpoint.Close()
+	w, _ := newTestWebhooks(t, endpoint.URL)
+	for i := 0; i < 5; i++ {
+		w.publish(&WebhookEvent{Type: WebhookMessage, Room: "room"})
+	}
+	s := newTestServer(t, func(cfg *Config) { cfg.RateLimit.Sender = RateLimit{Burst: 1} })
+	s.importRoom(&RoomState{RoomName: "room"})
+	// The server publishes its messages while the webhooks are set.
+	sent := make(chan error)
+	go func() {
+		for i := 0; i < 20; i++ {
+			if _, err := s.SendMessage(context.Background(), &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte("hi"), Timestamp: uint64(time.Now().Unix())}); err != nil {
+				sent <- err
+				return
+			}
+		}
+		sent <- nil
+	}()
+	s.SetWebhooks(w)
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	s.webhooks.Load().publishMessage("room", &ChatMessage{Sender: "alice", Recipient: "room", Content: []byte("last")})
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if delivered, _ := value(scrape(t, s), "chat_webhook_events_total", "result", "delivered"); delivered < 1 {
+		t.Errorf("%v deliveries counted after SetWebhooks, want at least 1", delivered)
+	}
+}